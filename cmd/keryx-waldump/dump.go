@@ -0,0 +1,329 @@
+package main
+
+// Copyright 2015 MediaMath <http://www.mediamath.com>.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/MediaMath/keryxlib/pg/wal"
+)
+
+// filter decides which records are printed, zero values match every record
+type filter struct {
+	transactionID uint32
+	relation      *relFileNode
+	recordType    *wal.RecordType
+}
+
+type relFileNode struct {
+	tablespaceID uint32
+	databaseID   uint32
+	relationID   uint32
+}
+
+func (f filter) matches(record *wal.Record) bool {
+	if f.transactionID != 0 && record.Header.TransactionID() != f.transactionID {
+		return false
+	}
+
+	if f.recordType != nil && record.Header.Type() != *f.recordType {
+		return false
+	}
+
+	if f.relation != nil {
+		heapData, err := record.Body.HeapData()
+		if err != nil {
+			return false
+		}
+
+		for _, data := range heapData {
+			if data.TablespaceID() == f.relation.tablespaceID && data.DatabaseID() == f.relation.databaseID && data.RelationID() == f.relation.relationID {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	return true
+}
+
+// parseRelFileNode reads a relfilenode written as tablespace/database/relation like 1663/16384/16385
+func parseRelFileNode(relation string) (*relFileNode, error) {
+	parts := strings.Split(relation, "/")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%v is not a relfilenode like 1663/16384/16385", relation)
+	}
+
+	var ids [3]uint32
+	for i, part := range parts {
+		id, err := strconv.ParseUint(part, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("%v is not a relfilenode like 1663/16384/16385: %v", relation, err)
+		}
+		ids[i] = uint32(id)
+	}
+
+	return &relFileNode{ids[0], ids[1], ids[2]}, nil
+}
+
+// parseRecordType reads the name of a record type as wal.RecordType prints it
+func parseRecordType(name string) (*wal.RecordType, error) {
+	for t := wal.RecordType(wal.Unknown); t <= wal.Drop; t++ {
+		if t.String() == name {
+			return &t, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%v is not a record type", name)
+}
+
+// recordTypeList names every record type parseRecordType knows as a list for the usage of the type flag
+func recordTypeList() string {
+	var names []string
+	for t := wal.RecordType(wal.Unknown); t < wal.Drop; t++ {
+		names = append(names, t.String())
+	}
+
+	return strings.Join(names, ", ") + " or " + wal.RecordType(wal.Drop).String()
+}
+
+// openCursor opens a cursor on a data directory or on a segment file and the segments next to it.  Without a start
+// it points at the first record of the oldest segment of a data directory or of the segment file.  The end is where a
+// dump of the segment file stops, it is zero for a data directory.
+func openCursor(path string, start uint64) (cursor *wal.Cursor, end uint64, err error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if info.IsDir() {
+		if start == 0 {
+			cursor, err = wal.NewCursorAtOldestSegment(path)
+		} else {
+			cursor, err = wal.NewCursorAtOrAfter(path, start)
+		}
+
+		return cursor, 0, err
+	}
+
+	name, ok := wal.ParseSegmentName(filepath.Base(path))
+	if !ok {
+		return nil, 0, fmt.Errorf("%v is neither a data directory nor a WAL segment", path)
+	}
+
+	header, err := readSegmentHeader(path)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// the long header of the first page has the geometry of the segment and where it starts
+	segment := header.Location().OnTimeline(name.TimelineID)
+	if segment.SegmentName() != name {
+		return nil, 0, fmt.Errorf("%v holds segment %v", path, segment.Filename())
+	}
+
+	if start < segment.Offset() {
+		start = segment.Offset()
+	}
+
+	cursor, err = wal.NewCursorAt(wal.NewDirectorySource(filepath.Dir(path)), segment.At(start))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return cursor, segment.StartOfNextFile().Offset(), nil
+}
+
+// readSegmentHeader reads the header of the first page of a segment file, which is long
+func readSegmentHeader(path string) (wal.Page, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return wal.Page{}, err
+	}
+	defer file.Close()
+
+	// a long header is at most 40 bytes
+	block := make([]byte, 40)
+	n, err := io.ReadFull(file, block)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return wal.Page{}, err
+	}
+
+	header := wal.NewPage(block[:n])
+	if !header.MagicValueIsValid() || !header.IsLong() {
+		return header, fmt.Errorf("%v does not start with the long page header of a WAL segment", path)
+	}
+
+	return header, nil
+}
+
+// dump prints the records from the cursor that match the filter until the end of the WAL or the first record at or
+// after end when end is not zero
+func dump(cursor *wal.Cursor, end uint64, f filter, printer recordPrinter) error {
+	next, err := cursor.ReadRecords(end, func(location wal.Location, record *wal.Record) error {
+		if f.matches(record) {
+			return printer.print(location, record)
+		}
+
+		return nil
+	})
+
+	*cursor = next
+	return err
+}
+
+// recordPrinter writes a record read at a location
+type recordPrinter interface {
+	print(location wal.Location, record *wal.Record) error
+}
+
+// dumpedRecord is what is printed of a record
+type dumpedRecord struct {
+	Location          string       `json:"location"`
+	Type              string       `json:"type"`
+	TotalLength       uint32       `json:"total_length"`
+	Length            uint32       `json:"length"`
+	Info              uint8        `json:"info"`
+	ResourceManagerID uint8        `json:"resource_manager_id"`
+	TransactionID     uint32       `json:"transaction_id"`
+	Previous          string       `json:"previous"`
+	Crc               uint32       `json:"crc"`
+	Page              dumpedPage   `json:"page"`
+	HeapData          []dumpedHeap `json:"heap_data,omitempty"`
+	HeapDataError     string       `json:"heap_data_error,omitempty"`
+}
+
+// dumpedPage is what is printed of the header of the page a record starts on
+type dumpedPage struct {
+	Location     string `json:"location"`
+	Magic        uint16 `json:"magic"`
+	Info         uint16 `json:"info"`
+	TimelineID   uint32 `json:"timeline_id"`
+	HeaderLength uint64 `json:"header_length"`
+	SystemID     uint64 `json:"system_id,omitempty"`
+	SegmentSize  uint32 `json:"segment_size,omitempty"`
+	BlockSize    uint32 `json:"block_size,omitempty"`
+}
+
+// dumpedHeap is what is printed of the heap data of a record
+type dumpedHeap struct {
+	Description  string `json:"description"`
+	TablespaceID uint32 `json:"tablespace_id"`
+	DatabaseID   uint32 `json:"database_id"`
+	RelationID   uint32 `json:"relation_id"`
+	FromBlock    uint32 `json:"from_block"`
+	FromOffset   uint16 `json:"from_offset"`
+	ToBlock      uint32 `json:"to_block"`
+	ToOffset     uint16 `json:"to_offset"`
+	NewTuple     string `json:"new_tuple,omitempty"`
+	OldTuple     string `json:"old_tuple,omitempty"`
+}
+
+func newDumpedRecord(location wal.Location, record *wal.Record) dumpedRecord {
+	header, page := record.Header, record.Page
+
+	dumped := dumpedRecord{
+		Location:          location.String(),
+		Type:              header.Type().String(),
+		TotalLength:       header.TotalLength(),
+		Length:            header.Length(),
+		Info:              header.Info(),
+		ResourceManagerID: header.ResourceManagerID(),
+		TransactionID:     header.TransactionID(),
+		Previous:          header.Previous().String(),
+		Crc:               header.Crc(),
+		Page: dumpedPage{
+			Location:     page.Location().String(),
+			Magic:        page.Magic(),
+			Info:         page.Info(),
+			TimelineID:   page.TimelineID(),
+			HeaderLength: page.HeaderLength(),
+			SystemID:     page.SystemID(),
+			SegmentSize:  page.SegmentSize(),
+			BlockSize:    page.BlockSize(),
+		},
+	}
+
+	heapData, err := record.Body.HeapData()
+	if err != nil {
+		dumped.HeapDataError = err.Error()
+	}
+
+	for _, data := range heapData {
+		dumped.HeapData = append(dumped.HeapData, dumpedHeap{
+			Description:  data.String(),
+			TablespaceID: data.TablespaceID(),
+			DatabaseID:   data.DatabaseID(),
+			RelationID:   data.RelationID(),
+			FromBlock:    data.FromBlock(),
+			FromOffset:   data.FromOffset(),
+			ToBlock:      data.ToBlock(),
+			ToOffset:     data.ToOffset(),
+			NewTuple:     fmt.Sprintf("%x", []byte(data.NewTuple())),
+			OldTuple:     fmt.Sprintf("%x", []byte(data.OldTuple())),
+		})
+	}
+
+	return dumped
+}
+
+// textPrinter prints a record on a line and its heap data on indented lines after it
+type textPrinter struct {
+	out io.Writer
+}
+
+func (p textPrinter) print(location wal.Location, record *wal.Record) error {
+	d := newDumpedRecord(location, record)
+	_, err := fmt.Fprintf(p.out, "%v: type %v, rmid %v, info 0x%.2X, xid %v, total length %v, length %v, previous %v, crc %.8X; page %v: magic %.4X, info 0x%.4X, timeline %v, header length %v",
+		d.Location, d.Type, d.ResourceManagerID, d.Info, d.TransactionID, d.TotalLength, d.Length, d.Previous, d.Crc,
+		d.Page.Location, d.Page.Magic, d.Page.Info, d.Page.TimelineID, d.Page.HeaderLength)
+	if err == nil && d.Page.SystemID != 0 {
+		_, err = fmt.Fprintf(p.out, ", system id %v, segment size %v, block size %v", d.Page.SystemID, d.Page.SegmentSize, d.Page.BlockSize)
+	}
+	if err == nil {
+		_, err = fmt.Fprintln(p.out)
+	}
+
+	for _, heap := range d.HeapData {
+		if err == nil {
+			_, err = fmt.Fprintf(p.out, "\t%v", heap.Description)
+		}
+		if err == nil && heap.NewTuple != "" {
+			_, err = fmt.Fprintf(p.out, ", new tuple %v", heap.NewTuple)
+		}
+		if err == nil && heap.OldTuple != "" {
+			_, err = fmt.Fprintf(p.out, ", old tuple %v", heap.OldTuple)
+		}
+		if err == nil {
+			_, err = fmt.Fprintln(p.out)
+		}
+	}
+
+	if err == nil && d.HeapDataError != "" {
+		_, err = fmt.Fprintf(p.out, "\theap data cannot be decoded: %v\n", d.HeapDataError)
+	}
+
+	return err
+}
+
+// jsonPrinter prints every record as a json object on its own line
+type jsonPrinter struct {
+	encoder *json.Encoder
+}
+
+func newJSONPrinter(out io.Writer) jsonPrinter {
+	return jsonPrinter{json.NewEncoder(out)}
+}
+
+func (p jsonPrinter) print(location wal.Location, record *wal.Record) error {
+	return p.encoder.Encode(newDumpedRecord(location, record))
+}
@@ -0,0 +1,261 @@
+package main
+
+// Copyright 2015 MediaMath <http://www.mediamath.com>.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MediaMath/keryxlib/pg/wal"
+	"github.com/MediaMath/keryxlib/pg/wal/waltest"
+)
+
+var (
+	relation = waltest.RelFileNode{TablespaceID: 1663, DatabaseID: 16384, RelationID: 16385}
+	other    = waltest.RelFileNode{TablespaceID: 1663, DatabaseID: 16384, RelationID: 16400}
+	now      = time.Date(2015, time.June, 1, 12, 0, 0, 0, time.UTC)
+)
+
+// writeDataDir writes the WAL of two transactions to a data directory and returns it with where the records start
+func writeDataDir(t *testing.T, version uint16) (string, []wal.Location) {
+	dir, err := ioutil.TempDir("", "waldump")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := waltest.NewWriter(version, wal.NewLocationWithDefaults(0x13000000))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	locations := []wal.Location{
+		w.Insert(100, relation, waltest.ItemPointer{Block: 0, Offset: 1}, waltest.NewTuple(1, []byte("keryx"))),
+		w.Insert(101, other, waltest.ItemPointer{Block: 0, Offset: 1}, waltest.NewTuple(1, []byte("other"))),
+		w.Delete(100, relation, waltest.ItemPointer{Block: 0, Offset: 1}),
+		w.Commit(100, now),
+		w.Abort(101, now),
+	}
+
+	if err := w.WriteDataDir(dir); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	return dir, locations
+}
+
+func dumpRecords(t *testing.T, path string, start, end uint64, f filter) []dumpedRecord {
+	cursor, segmentEnd, err := openCursor(path, start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cursor.Close()
+
+	if end == 0 {
+		end = segmentEnd
+	}
+
+	var out bytes.Buffer
+	if err := dump(cursor, end, f, newJSONPrinter(&out)); err != nil {
+		t.Fatal(err)
+	}
+
+	var records []dumpedRecord
+	decoder := json.NewDecoder(&out)
+	for decoder.More() {
+		var record dumpedRecord
+		if err := decoder.Decode(&record); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, record)
+	}
+
+	return records
+}
+
+func locationsOf(records []dumpedRecord) []string {
+	var locations []string
+	for _, record := range records {
+		locations = append(locations, record.Location)
+	}
+
+	return locations
+}
+
+func TestDumpDataDir(t *testing.T) {
+	for _, version := range []uint16{wal.Magic91, wal.Magic94} {
+		dir, locations := writeDataDir(t, version)
+		defer os.RemoveAll(dir)
+
+		records := dumpRecords(t, dir, 0, 0, filter{})
+		if len(records) != len(locations) {
+			t.Fatalf("%.4X: expected %v records but got %v", version, len(locations), locationsOf(records))
+		}
+
+		for i, location := range locations {
+			if records[i].Location != location.String() {
+				t.Errorf("%.4X: expected record %v at %v but got %v", version, i, location, records[i].Location)
+			}
+		}
+
+		insert := records[0]
+		if insert.Type != "insert" || insert.ResourceManagerID != waltest.RmHeap || insert.Info != waltest.HeapInsert || insert.TransactionID != 100 || insert.Previous != wal.NewLocationWithDefaults(0).String() {
+			t.Errorf("%.4X: expected the header of the insert but got %+v", version, insert)
+		}
+
+		if insert.Page.Magic != version || insert.Page.SystemID != waltest.SystemID || insert.Page.Location != locations[0].StartOfPage().String() {
+			t.Errorf("%.4X: expected the long header of the first page but got %+v", version, insert.Page)
+		}
+
+		if len(insert.HeapData) != 1 || insert.HeapData[0].RelationID != relation.RelationID || insert.HeapData[0].ToOffset != 1 || !strings.HasSuffix(insert.HeapData[0].NewTuple, "6b65727978") {
+			t.Errorf("%.4X: expected the heap data of the insert but got %+v", version, insert.HeapData)
+		}
+
+		if records[2].Previous != locations[1].String() || records[2].Type != "delete" {
+			t.Errorf("%.4X: expected the delete to follow the second insert but got %+v", version, records[2])
+		}
+	}
+}
+
+func TestDumpFilters(t *testing.T) {
+	dir, locations := writeDataDir(t, wal.Magic94)
+	defer os.RemoveAll(dir)
+
+	deleteType, err := parseRecordType("delete")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	otherRelation, err := parseRelFileNode("1663/16384/16400")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		f        filter
+		start    uint64
+		end      uint64
+		expected []wal.Location
+	}{
+		{filter{transactionID: 101}, 0, 0, []wal.Location{locations[1], locations[4]}},
+		{filter{recordType: deleteType}, 0, 0, []wal.Location{locations[2]}},
+		{filter{relation: otherRelation}, 0, 0, []wal.Location{locations[1]}},
+		{filter{}, locations[1].Offset(), locations[3].Offset(), []wal.Location{locations[1], locations[2]}},
+		{filter{}, locations[1].Offset() - 1, 0, []wal.Location{locations[1], locations[2], locations[3], locations[4]}},
+	} {
+		records := dumpRecords(t, dir, test.start, test.end, test.f)
+
+		var expected []string
+		for _, location := range test.expected {
+			expected = append(expected, location.String())
+		}
+
+		if strings.Join(locationsOf(records), " ") != strings.Join(expected, " ") {
+			t.Errorf("expected %v from %x to %x with %+v but got %v", expected, test.start, test.end, test.f, locationsOf(records))
+		}
+	}
+}
+
+func TestDumpSegmentFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "waldump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// small segments so that the records of the second transaction are in the next segment
+	w, err := waltest.NewWriter(wal.Magic94, wal.NewLocation(0x130000, 1, 0x10000, 0x2000, 8))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := w.Insert(1, relation, waltest.ItemPointer{Block: 0, Offset: 1}, waltest.NewTuple(1, []byte("keryx")))
+	w.Commit(1, now)
+	w.Record(0, 0, 1, make([]byte, 0x10000))
+	second := w.Insert(2, relation, waltest.ItemPointer{Block: 0, Offset: 2}, waltest.NewTuple(1, []byte("keryx")))
+	w.Commit(2, now)
+
+	if first.SegmentName() == second.SegmentName() {
+		t.Fatalf("expected the inserts in different segments but both are in %v", first.Filename())
+	}
+
+	if err := w.WriteSegments(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	// the second segment is dumped on its own, from the record that follows the continuation of the filler
+	records := dumpRecords(t, filepath.Join(dir, second.Filename()), 0, 0, filter{})
+	if len(records) != 2 || records[0].Location != second.String() || records[1].Type != "commit" {
+		t.Errorf("expected the second insert and its commit but got %v", locationsOf(records))
+	}
+
+	records = dumpRecords(t, filepath.Join(dir, first.Filename()), 0, 0, filter{})
+	if len(records) != 3 || records[0].Location != first.String() || records[0].Page.SegmentSize != 0x10000 {
+		t.Errorf("expected the first segment to end after the filler but got %v", locationsOf(records))
+	}
+
+	misnamed := filepath.Join(dir, "00000001000000000000000X")
+	if err := ioutil.WriteFile(misnamed, make([]byte, 0x10000), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := openCursor(misnamed, 0); err == nil {
+		t.Error("expected a file that is not named like a segment to not be dumped")
+	}
+}
+
+func TestParseFilters(t *testing.T) {
+	if node, err := parseRelFileNode("1663/16384/16385"); err != nil || *node != (relFileNode{1663, 16384, 16385}) {
+		t.Errorf("expected the relfilenode 1663/16384/16385 but got %v: %v", node, err)
+	}
+
+	for _, node := range []string{"1663/16384", "1663/16384/x"} {
+		if _, err := parseRelFileNode(node); err == nil {
+			t.Errorf("expected %q to not be a relfilenode", node)
+		}
+	}
+
+	if recordType, err := parseRecordType("multi insert"); err != nil || *recordType != wal.MultiInsert {
+		t.Errorf("expected the multi insert type but got %v: %v", recordType, err)
+	}
+
+	if _, err := parseRecordType("vacuum"); err == nil {
+		t.Error("expected vacuum to not be a record type")
+	}
+}
+
+func TestRecordTypeList(t *testing.T) {
+	expected := "unknown, insert, update, delete, commit, abort, multi insert, create, truncate or drop"
+	if list := recordTypeList(); list != expected {
+		t.Errorf("expected the record types %q but got %q", expected, list)
+	}
+}
+
+func TestDumpText(t *testing.T) {
+	dir, locations := writeDataDir(t, wal.Magic91)
+	defer os.RemoveAll(dir)
+
+	cursor, _, err := openCursor(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cursor.Close()
+
+	var out bytes.Buffer
+	if err := dump(cursor, locations[1].Offset(), filter{}, textPrinter{&out}); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], locations[0].String()+": type insert, rmid 10") || !strings.Contains(lines[0], "system id") || !strings.HasPrefix(lines[1], "\tInsert in 1663/16384/16385 to (0,1), new tuple") {
+		t.Errorf("expected the insert and its heap data but got %q", out.String())
+	}
+}
@@ -0,0 +1,120 @@
+// keryx-waldump prints the WAL records of a data directory or of a segment file the way keryxlib reads them, with the
+// fields of their headers, the header of the page they start on and their decoded heap data.
+package main
+
+// Copyright 2015 MediaMath <http://www.mediamath.com>.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/MediaMath/keryxlib/pg/wal"
+	"github.com/codegangsta/cli"
+)
+
+var (
+	startFlag = cli.StringFlag{
+		Name:  "start",
+		Usage: "LSN like 0/13000028 to start at, defaults to the start of the segment file or of the oldest segment of the data directory",
+	}
+
+	endFlag = cli.StringFlag{
+		Name:  "end",
+		Usage: "LSN to stop before, defaults to the end of the segment file or of the WAL of the data directory",
+	}
+
+	xidFlag = cli.IntFlag{
+		Name:  "xid",
+		Usage: "only print records of this transaction id",
+	}
+
+	relationFlag = cli.StringFlag{
+		Name:  "relation",
+		Usage: "only print records changing this relfilenode given as tablespace/database/relation",
+	}
+
+	typeFlag = cli.StringFlag{
+		Name:  "type",
+		Usage: "only print records of this type: " + recordTypeList(),
+	}
+
+	jsonFlag = cli.BoolFlag{
+		Name:  "json",
+		Usage: "will print a json object per record instead of text",
+	}
+)
+
+func main() {
+	app := cli.NewApp()
+	app.Name = "keryx-waldump"
+	app.Usage = "print the WAL records of a data directory or segment file as keryxlib reads them"
+	app.Flags = []cli.Flag{startFlag, endFlag, xidFlag, relationFlag, typeFlag, jsonFlag}
+
+	app.Action = func(ctx *cli.Context) {
+		if len(ctx.Args()) != 1 {
+			log.Fatalf("Expected a data directory or a segment file.")
+		}
+
+		var start uint64
+		var err error
+		if lsn := ctx.String(startFlag.Name); lsn != "" {
+			if start, err = wal.ParseLSN(lsn); err != nil {
+				log.Fatalf("Start error: %v", err)
+			}
+		}
+
+		f, err := filterFromFlags(ctx)
+		if err != nil {
+			log.Fatalf("Filter error: %v", err)
+		}
+
+		cursor, segmentEnd, err := openCursor(ctx.Args()[0], start)
+		if err != nil {
+			log.Fatalf("Open %s failed: %v", ctx.Args()[0], err)
+		}
+		defer cursor.Close()
+
+		end := segmentEnd
+		if lsn := ctx.String(endFlag.Name); lsn != "" {
+			if end, err = wal.ParseLSN(lsn); err != nil {
+				log.Fatalf("End error: %v", err)
+			}
+		}
+
+		var printer recordPrinter = textPrinter{os.Stdout}
+		if ctx.Bool(jsonFlag.Name) {
+			printer = newJSONPrinter(os.Stdout)
+		}
+
+		if err := dump(cursor, end, f, printer); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	app.Run(os.Args)
+}
+
+func filterFromFlags(ctx *cli.Context) (f filter, err error) {
+	xid := ctx.Int(xidFlag.Name)
+	if xid < 0 {
+		return f, fmt.Errorf("%v is not a transaction id", xid)
+	}
+	f.transactionID = uint32(xid)
+
+	if relation := ctx.String(relationFlag.Name); relation != "" {
+		if f.relation, err = parseRelFileNode(relation); err != nil {
+			return f, err
+		}
+	}
+
+	if recordType := ctx.String(typeFlag.Name); recordType != "" {
+		if f.recordType, err = parseRecordType(recordType); err != nil {
+			return f, err
+		}
+	}
+
+	return f, nil
+}
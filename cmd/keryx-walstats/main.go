@@ -0,0 +1,134 @@
+// keryx-walstats reports how many records and bytes of WAL each resource manager, record type, database and
+// relation of a data directory wrote, to find what generates the WAL keryx reads.
+package main
+
+// Copyright 2015 MediaMath <http://www.mediamath.com>.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+
+	keryxlib "github.com/MediaMath/keryxlib"
+	"github.com/MediaMath/keryxlib/pg"
+	"github.com/MediaMath/keryxlib/pg/wal"
+	"github.com/MediaMath/keryxlib/walstats"
+	"github.com/codegangsta/cli"
+)
+
+var (
+	configFlag = cli.StringFlag{
+		Name:   "config",
+		Usage:  "Path to a keryxlib config file whose data directory, archive directories and connections are used",
+		EnvVar: "WALSTATS_CONFIG",
+	}
+
+	startFlag = cli.StringFlag{
+		Name:  "start",
+		Usage: "LSN like 0/13000028 to start at, defaults to the start of the oldest segment",
+	}
+
+	endFlag = cli.StringFlag{
+		Name:  "end",
+		Usage: "LSN to stop before, defaults to the end of the WAL",
+	}
+
+	jsonFlag = cli.BoolFlag{
+		Name:  "json",
+		Usage: "will print the report as json instead of tables",
+	}
+)
+
+func main() {
+	app := cli.NewApp()
+	app.Name = "keryx-walstats"
+	app.Usage = "report the WAL volume of a data directory by resource manager, record type, database and relation"
+	app.Flags = []cli.Flag{configFlag, startFlag, endFlag, jsonFlag}
+
+	app.Action = func(ctx *cli.Context) {
+		config := &keryxlib.Config{}
+		if configFile := ctx.String(configFlag.Name); configFile != "" {
+			var err error
+			if config, err = keryxlib.ConfigFromFile(configFile); err != nil {
+				log.Fatalf("Load %s failed: %v", configFile, err)
+			}
+		}
+
+		if len(ctx.Args()) > 0 {
+			config.DataDir = ctx.Args()[0]
+		}
+
+		if config.DataDir == "" {
+			log.Fatalf("Expected a data directory or a config with one.")
+		}
+
+		start, err := lsnFlag(ctx, startFlag.Name)
+		if err != nil {
+			log.Fatalf("Start error: %v", err)
+		}
+
+		end, err := lsnFlag(ctx, endFlag.Name)
+		if err != nil {
+			log.Fatalf("End error: %v", err)
+		}
+
+		report, err := collect(config, start, end)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if ctx.Bool(jsonFlag.Name) {
+			js, err := json.Marshal(report)
+			if err != nil {
+				log.Fatal(err)
+			}
+			fmt.Printf("%s\n", js)
+		} else if err := report.WriteTable(os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	app.Run(os.Args)
+}
+
+func lsnFlag(ctx *cli.Context, name string) (uint64, error) {
+	if lsn := ctx.String(name); lsn != "" {
+		return wal.ParseLSN(lsn)
+	}
+
+	return 0, nil
+}
+
+// collect counts the WAL of the data directory of config from start to end, naming relations through its connections
+func collect(config *keryxlib.Config, start, end uint64) (walstats.Report, error) {
+	var cursor *wal.Cursor
+	var err error
+	if start == 0 {
+		cursor, err = wal.NewCursorAtOldestSegment(config.DataDir, config.ArchiveDirs...)
+	} else {
+		cursor, err = wal.NewCursorAtOrAfter(config.DataDir, start, config.ArchiveDirs...)
+	}
+	if err != nil {
+		return walstats.Report{}, err
+	}
+	defer cursor.Close()
+
+	stats := walstats.NewStats()
+	if err := stats.Collect(cursor, end); err != nil {
+		return walstats.Report{}, err
+	}
+
+	var names walstats.NameResolver
+	if len(config.PGConnStrings) > 0 {
+		schemaReader, err := pg.NewSchemaReader(config.PGConnStrings, "postgres", 0)
+		if err != nil {
+			return walstats.Report{}, err
+		}
+		names = schemaReader
+	}
+
+	return stats.Report(names), nil
+}
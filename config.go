@@ -2,10 +2,13 @@ package keryxlib
 
 import (
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"os"
+	"time"
 
 	"github.com/MediaMath/keryxlib/message"
+	"github.com/MediaMath/keryxlib/streams"
 )
 
 //Config contains necessary information to start a keryx stream
@@ -17,6 +20,11 @@ type Config struct {
 	IncludeRelations map[string][]string `json:"include,omitempty"`
 	BufferDirectory  string              `json:"buffer_directory"`
 	MaxMessagePerTxn uint                `json:"max_message_per_txn"`
+	OnCorruptRecord  string              `json:"on_corrupt_record,omitempty"`
+	PositionFile     string              `json:"position_file,omitempty"`
+	AckTransactions  bool                `json:"ack_transactions,omitempty"`
+	ArchiveDirs      []string            `json:"archive_dirs,omitempty"`
+	PollInterval     string              `json:"poll_interval,omitempty"`
 }
 
 //IncludedTables returns message.Tables from the config
@@ -62,6 +70,31 @@ func (config *Config) GetBufferDirectoryOrTemp() (bufferWorkingDirectory string,
 	return
 }
 
+//GetPositionStore returns a store keeping the position in the configured position file, or nil if there is none
+func (config *Config) GetPositionStore() streams.PositionStore {
+	if config.PositionFile == "" {
+		return nil
+	}
+
+	return streams.NewFilePositionStore(config.PositionFile)
+}
+
+//GetPollInterval parses the configured poll interval, like 250ms, which defaults to streams.DefaultPollInterval
+func (config *Config) GetPollInterval() (time.Duration, error) {
+	if config.PollInterval == "" {
+		return streams.DefaultPollInterval, nil
+	}
+
+	interval, err := time.ParseDuration(config.PollInterval)
+	if err != nil {
+		return 0, fmt.Errorf("invalid poll interval %q: %v", config.PollInterval, err)
+	} else if interval <= 0 {
+		return 0, fmt.Errorf("invalid poll interval %q: it must be positive", config.PollInterval)
+	}
+
+	return interval, nil
+}
+
 //ConfigFromFile loads a config object from a json file
 func ConfigFromFile(path string) (*Config, error) {
 	file, err := ioutil.ReadFile(path)
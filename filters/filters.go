@@ -25,6 +25,11 @@ func (f FilterNone) FilterColumn(rel string, col string) bool {
 	return false
 }
 
+//Invalidator is a filter that maps relfilenodes to relations and has to be told when a relation gets a new relfilenode
+type Invalidator interface {
+	InvalidateRelIDs()
+}
+
 //RelationNameConverter turns table names into a map from int to name
 type RelationNameConverter interface {
 	ConvertRelNamesToIds(names []string) map[uint32]string
@@ -36,6 +41,7 @@ type ColumnMapFiltering struct {
 	relations      map[string][]string
 	idMap          map[uint32]string
 	idUpdateTicker <-chan time.Time
+	invalidated    chan struct{}
 	exclusive      bool
 	relationNames  []string
 }
@@ -64,6 +70,7 @@ func newColumnMapFiltering(sr RelationNameConverter, relations map[string][]stri
 		relations:      relations,
 		idMap:          relIds,
 		idUpdateTicker: time.Tick(refresh),
+		invalidated:    make(chan struct{}, 1),
 		exclusive:      exclusive,
 		relationNames:  names,
 	}
@@ -73,6 +80,16 @@ func (f *ColumnMapFiltering) periodicallyUpdateIDMap() {
 	select {
 	case <-f.idUpdateTicker:
 		f.idMap = f.sr.ConvertRelNamesToIds(f.relationNames)
+	case <-f.invalidated:
+		f.idMap = f.sr.ConvertRelNamesToIds(f.relationNames)
+	default:
+	}
+}
+
+//InvalidateRelIDs makes the next FilterRelID read the name/id map again rather than wait for the periodic update.  A truncate or a rewrite gives a relation a new relfilenode which the map does not have yet.
+func (f *ColumnMapFiltering) InvalidateRelIDs() {
+	select {
+	case f.invalidated <- struct{}{}:
 	default:
 	}
 }
@@ -4,7 +4,10 @@ package filters
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
-import "testing"
+import (
+	"testing"
+	"time"
+)
 
 type i struct {
 	id      uint32
@@ -96,3 +99,30 @@ func columnFilter(exclusive bool, relation string, column string) bool {
 
 	return f.FilterColumn(relation, column)
 }
+
+type rewrittenMapping struct {
+	rewritten bool
+}
+
+func (f *rewrittenMapping) ConvertRelNamesToIds(names []string) map[uint32]string {
+	if f.rewritten {
+		return map[uint32]string{102: "moo"}
+	}
+
+	return map[uint32]string{101: "moo"}
+}
+
+func TestInvalidateRelIDs(t *testing.T) {
+	mapping := &rewrittenMapping{}
+	f := newColumnMapFiltering(mapping, relations, true, time.Hour)
+
+	mapping.rewritten = true
+	if f.FilterRelID(102) {
+		t.Errorf("expected the new relfilenode to be unknown until the map is read again")
+	}
+
+	f.InvalidateRelIDs()
+	if !f.FilterRelID(102) || f.FilterRelID(101) {
+		t.Errorf("expected the new relfilenode to replace the old one once invalidated")
+	}
+}
@@ -6,6 +6,8 @@ package keryxlib
 
 import (
 	"context"
+	"fmt"
+	"time"
 
 	"github.com/MediaMath/keryxlib/filters"
 	"github.com/MediaMath/keryxlib/message"
@@ -15,6 +17,10 @@ import (
 
 //StartSummaryChannel sets up a keryx symmary stream and schema reader with the provided configuration and returns a channel
 func StartSummaryChannel(ctx context.Context, serverVersion string, kc *Config) (<-chan message.TxnSummary, error) {
+	if err := checkPgVersion(kc.DataDir); err != nil {
+		return nil, err
+	}
+
 	schemaReader, err := pg.NewSchemaReader(kc.PGConnStrings, "postgres", 255)
 	if err != nil {
 		return nil, err
@@ -25,10 +31,30 @@ func StartSummaryChannel(ctx context.Context, serverVersion string, kc *Config)
 		return nil, err
 	}
 
+	corruptRecordPolicy, err := streams.ParseCorruptRecordPolicy(kc.OnCorruptRecord)
+	if err != nil {
+		return nil, err
+	}
+
+	pollInterval, err := kc.GetPollInterval()
+	if err != nil {
+		return nil, err
+	}
+
+	positionStore := kc.GetPositionStore()
+	resumeAfter, err := streams.LoadPosition(positionStore)
+	if err != nil {
+		return nil, err
+	}
+
 	walStream, err := streams.NewWalStream(kc.DataDir)
 	if err != nil {
 		return nil, err
 	}
+	walStream.OnCorruptRecord(corruptRecordPolicy)
+	walStream.ResumeAfter(resumeAfter)
+	walStream.ReadArchives(kc.ArchiveDirs...)
+	walStream.PollEvery(pollInterval)
 
 	wal, err := walStream.Start()
 	if err != nil {
@@ -45,14 +71,14 @@ func StartSummaryChannel(ctx context.Context, serverVersion string, kc *Config)
 		f = filters.Inclusive(schemaReader, kc.IncludeRelations)
 	}
 
-	txnBuffer := &streams.TxnBuffer{Filters: f, WorkingDirectory: bufferWorkingDirectory, SchemaReader: schemaReader}
+	txnBuffer := &streams.TxnBuffer{Filters: f, WorkingDirectory: bufferWorkingDirectory, SchemaReader: schemaReader, ResumeAfter: resumeAfter}
 	buffered, err := txnBuffer.Start(wal)
 	if err != nil {
 		walStream.Stop()
 		return nil, err
 	}
 
-	return streams.SummaryStream{SchemaMetaInformation: schemaReader}.Start(serverVersion, buffered)
+	return streams.SummaryStream{SchemaMetaInformation: schemaReader, PositionStore: positionStore}.Start(serverVersion, buffered)
 }
 
 //TransactionChannel sets up a keryx stream and schema reader with the provided configuration and returns
@@ -64,6 +90,10 @@ func TransactionChannel(serverVersion string, kc *Config) (<-chan *message.Trans
 //StartTransactionChannel sets up a keryx stream and schema reader with the provided configuration and return
 //it as a channel. The channel can be stopped with the provided stopper
 func StartTransactionChannel(serverVersion string, kc *Config, stopper WaitForStop) (<-chan *message.Transaction, error) {
+	if err := checkPgVersion(kc.DataDir); err != nil {
+		return nil, err
+	}
+
 	schemaReader, err := pg.NewSchemaReader(kc.PGConnStrings, "postgres", 255)
 	if err != nil {
 		return nil, err
@@ -74,12 +104,27 @@ func StartTransactionChannel(serverVersion string, kc *Config, stopper WaitForSt
 		return nil, err
 	}
 
+	corruptRecordPolicy, err := streams.ParseCorruptRecordPolicy(kc.OnCorruptRecord)
+	if err != nil {
+		return nil, err
+	}
+
+	pollInterval, err := kc.GetPollInterval()
+	if err != nil {
+		return nil, err
+	}
+
 	f := filters.Exclusive(schemaReader, kc.ExcludeRelations)
 	if len(kc.IncludeRelations) > 0 {
 		f = filters.Inclusive(schemaReader, kc.IncludeRelations)
 	}
 
 	stream := NewKeryxStream(schemaReader, kc.MaxMessagePerTxn)
+	stream.CorruptRecordPolicy = corruptRecordPolicy
+	stream.PositionStore = kc.GetPositionStore()
+	stream.AckTransactions = kc.AckTransactions
+	stream.ArchiveDirs = kc.ArchiveDirs
+	stream.PollInterval = pollInterval
 	if stopper != nil {
 		go func() {
 			stopper.Wait()
@@ -89,6 +134,14 @@ func StartTransactionChannel(serverVersion string, kc *Config, stopper WaitForSt
 	return stream.StartKeryxStream(serverVersion, f, kc.DataDir, bufferWorkingDirectory)
 }
 
+func checkPgVersion(dataDir string) error {
+	if err := pg.IsPgVersionSupported(dataDir); err != nil {
+		return fmt.Errorf("cannot read the WAL in %v: %v", dataDir, err)
+	}
+
+	return nil
+}
+
 //WaitForStop will wait
 type WaitForStop interface {
 	Wait()
@@ -117,14 +170,19 @@ func (t *TxnChannelStopper) Wait() {
 
 //FullStream is a facade around the full process of taking WAL entries and publishing them as txn messages.
 type FullStream struct {
-	walStream       *streams.WalStream
-	sr              *pg.SchemaReader
-	MaxMessageCount uint
+	walStream           *streams.WalStream
+	sr                  *pg.SchemaReader
+	MaxMessageCount     uint
+	CorruptRecordPolicy streams.CorruptRecordPolicy
+	PositionStore       streams.PositionStore
+	AckTransactions     bool
+	ArchiveDirs         []string
+	PollInterval        time.Duration
 }
 
 //NewKeryxStream takes a schema reader and returns a FullStream
 func NewKeryxStream(sr *pg.SchemaReader, maxMessageCount uint) *FullStream {
-	return &FullStream{nil, sr, maxMessageCount}
+	return &FullStream{nil, sr, maxMessageCount, streams.StopOnCorruptRecord, nil, false, nil, streams.DefaultPollInterval}
 }
 
 //Stop will end the reading on the WAL log and subsequent streams will therefore end.
@@ -134,27 +192,51 @@ func (fs *FullStream) Stop() {
 	}
 }
 
-//StartKeryxStream will start all the streams necessary to go from WAL entries to txn messages.
+//Gaps returns a channel of the parts of the WAL that were removed before the stream read them, or nil if the stream
+//was not started.
+func (fs *FullStream) Gaps() <-chan message.Gap {
+	if fs.walStream == nil {
+		return nil
+	}
+
+	return fs.walStream.Gaps()
+}
+
+//StartKeryxStream will start all the streams necessary to go from WAL entries to txn messages.  With a PositionStore
+//the stream resumes after the last transaction delivered and records every transaction it delivers, or with
+//AckTransactions every transaction that is acknowledged along with all the transactions before it.
 func (fs *FullStream) StartKeryxStream(serverVersion string, filters filters.MessageFilter, dataDir string, bufferWorkingDirectory string) (<-chan *message.Transaction, error) {
+	resumeAfter, err := streams.LoadPosition(fs.PositionStore)
+	if err != nil {
+		return nil, err
+	}
+
 	walStream, err := streams.NewWalStream(dataDir)
 	if err != nil {
 		return nil, err
 	}
 	fs.walStream = walStream
+	fs.walStream.OnCorruptRecord(fs.CorruptRecordPolicy)
+	fs.walStream.ResumeAfter(resumeAfter)
+	fs.walStream.ReadArchives(fs.ArchiveDirs...)
+	fs.walStream.PollEvery(fs.PollInterval)
 
 	wal, err := fs.walStream.Start()
 	if err != nil {
 		return nil, err
 	}
 
-	txnBuffer := &streams.TxnBuffer{Filters: filters, WorkingDirectory: bufferWorkingDirectory, SchemaReader: fs.sr}
+	txnBuffer := &streams.TxnBuffer{Filters: filters, WorkingDirectory: bufferWorkingDirectory, SchemaReader: fs.sr, ResumeAfter: resumeAfter}
 	buffered, err := txnBuffer.Start(wal)
 	if err != nil {
 		fs.Stop()
 		return nil, err
 	}
 
-	populated := &streams.PopulatedMessageStream{Filters: filters, SchemaReader: fs.sr, MaxMessageCount: fs.MaxMessageCount}
+	populated := &streams.PopulatedMessageStream{Filters: filters, SchemaReader: fs.sr, MaxMessageCount: fs.MaxMessageCount, PositionStore: fs.PositionStore}
+	if fs.AckTransactions {
+		populated.Watermark = streams.NewWatermark(fs.PositionStore)
+	}
 	keryx, err := populated.Start(serverVersion, buffered)
 	if err != nil {
 		fs.Stop()
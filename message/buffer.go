@@ -33,6 +33,11 @@ func NewBuffer(workingDirectory string, memoryLimit, itemSize uint64) *Buffer {
 	return &b
 }
 
+//NewVariableBuffer returns a new abstraction of data by transaction whose items can each be of a different size.
+func NewVariableBuffer(workingDirectory string, memoryLimit uint64) *Buffer {
+	return NewBuffer(workingDirectory, memoryLimit, 0)
+}
+
 func (b *Buffer) initialize() {
 	// wipe directory of buffer files
 	files, err := ioutil.ReadDir(b.workingDirectory)
@@ -52,7 +57,7 @@ func (b *Buffer) initialize() {
 
 //Add adds data to the buffer by transaction id
 func (b *Buffer) Add(key uint32, item []byte) {
-	if (b.memoryCounter + b.itemSize) <= b.memoryLimit {
+	if (b.memoryCounter + b.storedSize(item)) <= b.memoryLimit {
 		b.addInMemory(key, item)
 	} else {
 		b.addOnDisk(key, item)
@@ -69,10 +74,29 @@ func (b *Buffer) Remove(key uint32) (out [][]byte) {
 }
 
 func (b *Buffer) addInMemory(key uint32, src []byte) {
-	dst := make([]byte, b.itemSize)
-	copy(dst, src)
+	dst := b.toStored(src)
 	b.memoryBuffer[key] = append(b.memoryBuffer[key], dst...)
-	b.memoryCounter += b.itemSize
+	b.memoryCounter += uint64(len(dst))
+}
+
+func (b *Buffer) storedSize(item []byte) uint64 {
+	if b.itemSize == 0 {
+		return uint64(len(item)) + 4
+	}
+	return b.itemSize
+}
+
+//toStored pads or truncates fixed size items and prefixes variable size items with their length
+func (b *Buffer) toStored(item []byte) []byte {
+	dst := make([]byte, b.storedSize(item))
+	if b.itemSize == 0 {
+		size := len(item)
+		dst[0], dst[1], dst[2], dst[3] = byte(size>>24), byte(size>>16), byte(size>>8), byte(size)
+		copy(dst[4:], item)
+	} else {
+		copy(dst, item)
+	}
+	return dst
 }
 
 func (b *Buffer) removeFromMemory(key uint32) (out [][]byte, ok bool) {
@@ -96,11 +120,11 @@ func (b *Buffer) addOnDisk(key uint32, item []byte) {
 		memoryItems, ok := b.removeFromMemory(key)
 		if ok {
 			for _, memoryItem := range memoryItems {
-				writeToFile(memoryItem, file)
+				writeToFile(b.toStored(memoryItem), file)
 			}
 		}
 
-		writeToFile(item, file)
+		writeToFile(b.toStored(item), file)
 	}
 }
 
@@ -125,6 +149,19 @@ func (b *Buffer) removeFromDisk(key uint32) (out [][]byte) {
 
 func extractItems(itemBuffer []byte, itemSize uint64) (out [][]byte) {
 	iblen := uint64(len(itemBuffer))
+	if itemSize == 0 {
+		for start := uint64(0); start+4 <= iblen; {
+			size := uint64(itemBuffer[start])<<24 + uint64(itemBuffer[start+1])<<16 + uint64(itemBuffer[start+2])<<8 + uint64(itemBuffer[start+3])
+			end := start + 4 + size
+			if end > iblen {
+				break
+			}
+			out = append(out, itemBuffer[start+4:end])
+			start = end
+		}
+		return
+	}
+
 	for start, end := uint64(0), itemSize; end <= iblen; start, end = end, end+itemSize {
 		out = append(out, itemBuffer[start:end])
 	}
@@ -34,6 +34,46 @@ func TestGenerousMemoryLimit(t *testing.T) {
 	testAddWithLimit(t, 2000)
 }
 
+func TestVariableSizeItemsInMemory(t *testing.T) {
+	testAddVariableSizes(t, 1000)
+}
+
+func TestVariableSizeItemsOnDisk(t *testing.T) {
+	testAddVariableSizes(t, 20)
+}
+
+func testAddVariableSizes(t *testing.T, memoryLimit uint64) {
+	const itemKey = 1
+
+	b := NewVariableBuffer(".", memoryLimit)
+	defer b.initialize()
+
+	sizes := []int{0, 3, 17, 1, 40}
+	for _, size := range sizes {
+		item := make([]byte, size)
+		for i := range item {
+			item[i] = byte(size)
+		}
+		b.Add(itemKey, item)
+	}
+
+	out := b.Remove(itemKey)
+	if len(out) != len(sizes) {
+		t.Fatal("expected ", len(sizes), " items but got ", len(out))
+	}
+
+	for i, item := range out {
+		if len(item) != sizes[i] {
+			t.Fatal("expected item ", i, " to have ", sizes[i], " bytes but got ", len(item))
+		}
+		for _, b := range item {
+			if b != byte(sizes[i]) {
+				t.Error("incorrect contents of item", i, b)
+			}
+		}
+	}
+}
+
 func testAddWithSize(t *testing.T, originalSize uint64) {
 	const (
 		memoryLimit          = 100
@@ -36,6 +36,13 @@ const (
 	UpdateMessage Type = 4
 	//CommitMessage is a commit record.
 	CommitMessage Type = 5
+	//TruncateMessage is a relation truncated in place, which is how a TRUNCATE of a table created or truncated earlier
+	//in the same transaction is logged.  Block is the number of blocks it is left with.
+	TruncateMessage Type = 6
+	//RelationRewriteMessage is the storage of a relation replaced by a TRUNCATE, VACUUM FULL, CLUSTER or ALTER TABLE, or
+	//dropped with the relation.  RelationID is the relfilenode that was dropped and NewRelationID the one that replaced
+	//it, 0 when the relation was dropped.
+	RelationRewriteMessage Type = 7
 )
 
 func (messageType *Type) String() string {
@@ -48,6 +55,10 @@ func (messageType *Type) String() string {
 		return "UpdateMessage"
 	case CommitMessage:
 		return "CommitMessage"
+	case TruncateMessage:
+		return "TruncateMessage"
+	case RelationRewriteMessage:
+		return "RelationRewriteMessage"
 	}
 
 	return "UnknownMessage"
@@ -82,6 +93,15 @@ func KeyFromString(s string) Key {
 	return Key(s)
 }
 
+//ParseKey splits a Key into the timeline, log id and record offset of the LSN it was created from.
+func ParseKey(key Key) (timelineID uint32, logID uint32, recordOffset uint32, err error) {
+	if len(key) != len(BeginningKey) {
+		return 0, 0, 0, fmt.Errorf("key %q is not %v characters long", key, len(BeginningKey))
+	}
+
+	return parseMessageKey(key)
+}
+
 func parseMessageKey(key Key) (timelineID uint32, logID uint32, recordOffset uint32, err error) {
 	keyString := string(key)
 	if len(keyString) == 24 {
@@ -104,17 +124,45 @@ func parseMessageKey(key Key) (timelineID uint32, logID uint32, recordOffset uin
 	return
 }
 
-//Transaction is collection of messages all commited on the same postgres commit.
+//Transaction is collection of messages all commited on the same postgres commit.  CommitTime is when postgres
+//committed it and ParseTime when its commit was read from the WAL.
 type Transaction struct {
 	TransactionID   uint32    `json:"xid"`
+	Subtransactions []uint32  `json:"subxids,omitempty"`
 	FirstKey        Key       `json:"first"`
 	CommitKey       Key       `json:"commit"`
 	CommitTime      time.Time `json:"commit_time"`
+	ParseTime       time.Time `json:"parse_time"`
 	TransactionTime time.Time `json:"transaction_time"`
 	Messages        []Message `json:"messages,omitempty"`
 	Tables          []Table   `json:"tables,omitempty"`
 	MessageCount    int       `json:"message_count,omitempty"`
 	ServerVersion   string    `json:"server_version,omitempty"`
+	ack             func()
+}
+
+//Ack acknowledges that the transaction was durably processed.  When the stream is tracking acknowledgements its
+//resume position only moves past transactions that were acknowledged.  Calling it more than once does nothing.
+func (t *Transaction) Ack() {
+	if t.ack != nil {
+		t.ack()
+	}
+}
+
+//OnAck sets what Ack does.
+func (t *Transaction) OnAck(ack func()) {
+	t.ack = ack
+}
+
+//Gap reports that the WAL between two keys was removed before it was read, any transaction committed in it is missing.
+type Gap struct {
+	FromKey Key    `json:"from"`
+	ToKey   Key    `json:"to"`
+	Reason  string `json:"reason"`
+}
+
+func (g Gap) String() string {
+	return fmt.Sprintf("gap from %v to %v: %v", g.FromKey, g.ToKey, g.Reason)
 }
 
 //Table is the fully addressable form of a table
@@ -196,6 +244,7 @@ type Message struct {
 	TablespaceID     uint32        `json:"nsid,omitempty"`
 	DatabaseID       uint32        `json:"dbid,omitempty"`
 	RelationID       uint32        `json:"relid,omitempty"`
+	NewRelationID    uint32        `json:"new_relid,omitempty"`
 	Type             Type          `json:"type"`
 	Key              Key           `json:"key"`
 	Prev             Key           `json:"prev"`
@@ -208,6 +257,7 @@ type Message struct {
 	TupleID          string        `json:"ctid"`
 	PrevTupleID      string        `json:"prev_ctid,omitempty"`
 	Fields           []Field       `json:"fields"`
+	OldFields        []Field       `json:"old_fields,omitempty"`
 	PopulationError  string        `json:"population_error,omitempty"`
 	PopulateTime     time.Time     `json:"populate_time"`
 	ParseTime        time.Time     `json:"parse_time"`
@@ -218,7 +268,12 @@ type Message struct {
 
 //MissingFields returns true for any insert or update with no fields
 func (msg *Message) MissingFields() bool {
-	return msg.Type != DeleteMessage && len(msg.Fields) == 0
+	switch msg.Type {
+	case DeleteMessage, TruncateMessage, RelationRewriteMessage:
+		return false
+	}
+
+	return len(msg.Fields) == 0
 }
 
 //RelFullName is a full table address of the form db.ns.table
@@ -237,6 +292,11 @@ func (msg *Message) AppendField(name, kind, value string) {
 	msg.Fields = append(msg.Fields, Field{name, kind, value})
 }
 
+//AppendOldField adds a field of the old version of the row to the message.
+func (msg *Message) AppendOldField(name, kind, value string) {
+	msg.OldFields = append(msg.OldFields, Field{name, kind, value})
+}
+
 //LessThan determines based on the LSN whether one message is before the other.
 func (msg *Message) LessThan(that *Message) bool {
 	switch {
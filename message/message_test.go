@@ -42,6 +42,17 @@ func TestMessageStringOutputCommit(t *testing.T) {
 	FailIfTrue(t, message.String() != "CommitMessage 00000000/00000000/00000000 xid:0 .. (0:0)", "String() broken")
 }
 
+func TestMessageStringOutputRelationChanges(t *testing.T) {
+
+	truncate := Message{Type: TruncateMessage, Namespace: "public", Relation: "users"}
+	FailIfTrue(t, truncate.String() != "TruncateMessage 00000000/00000000/00000000 xid:0 .public.users (0:0)", "String() broken")
+	FailIfTrue(t, truncate.MissingFields(), "truncates have no fields to miss")
+
+	rewrite := Message{Type: RelationRewriteMessage}
+	FailIfTrue(t, rewrite.String() != "RelationRewriteMessage 00000000/00000000/00000000 xid:0 .. (0:0)", "String() broken")
+	FailIfTrue(t, rewrite.MissingFields(), "rewrites have no fields to miss")
+}
+
 func TestMessageAppendField(t *testing.T) {
 
 	message := &Message{}
@@ -5,6 +5,7 @@ package control
 // license that can be found in the LICENSE file.
 
 import (
+	"bytes"
 	"encoding/binary"
 	"fmt"
 	"io"
@@ -15,6 +16,10 @@ import (
 const (
 	controlSize      = 8192
 	floatFormatValue = 1234567.0
+
+	// 9.4 and 9.5 share pg_control version 942 but not its layout so the catalog version tells them apart
+	lastCatalogVersion94 = 201409291
+	layoutVersion95      = 950
 )
 
 // PgStateType describes the state that PostgreSQL is in.  See this link for details: https://github.com/postgres/postgres/blob/REL9_1_STABLE/src/include/catalog/pg_control.h#L69
@@ -153,6 +158,8 @@ type Control struct {
 
 	DataChecksumVersion uint32
 
+	MockAuthenticationNonce [32]byte
+
 	Crc uint32
 }
 
@@ -181,21 +188,157 @@ func NewControlFromFile(path string) (*Control, error) {
 
 // NewControl gets control from a reader
 func NewControl(reader io.Reader) (*Control, error) {
+	var pgData = new(Control)
+	initialFields, versionFields := controlFields(pgData)
+
+	for _, ftp := range initialFields {
+		err := binary.Read(reader, binary.LittleEndian, ftp.field)
+		if err != nil {
+			return nil, fmt.Errorf(ftp.errorFmt, err)
+		}
+	}
+
+	if fields, ok := versionFields[pgData.layoutVersion()]; ok {
+		for _, ftp := range fields {
+			err := binary.Read(reader, binary.LittleEndian, ftp.field)
+			if err != nil {
+				return nil, fmt.Errorf(ftp.errorFmt, err)
+			}
+		}
+	} else {
+		return nil, fmt.Errorf("unknown version %v", pgData.Version)
+	}
+
+	return pgData, nil
+}
+
+// Bytes encodes control in the layout of its Version the way NewControl reads it, padded to the size of a pg_control
+// file
+func (c *Control) Bytes() ([]byte, error) {
+	pgData := *c
+	initialFields, versionFields := controlFields(&pgData)
+
+	fields, ok := versionFields[pgData.layoutVersion()]
+	if !ok {
+		return nil, fmt.Errorf("unknown version %v", pgData.Version)
+	}
+
+	var buffer bytes.Buffer
+	for _, ftp := range append(initialFields, fields...) {
+		if err := binary.Write(&buffer, binary.LittleEndian, ftp.field); err != nil {
+			return nil, err
+		}
+	}
+
+	return append(buffer.Bytes(), make([]byte, controlSize-buffer.Len())...), nil
+}
+
+// layoutVersion is the pg_control version whose layout control is written in
+func (c *Control) layoutVersion() uint32 {
+	if c.Version == 942 && c.CatalogVersionNo > lastCatalogVersion94 {
+		return layoutVersion95
+	}
+
+	return c.Version
+}
+
+// controlFields lists the fields every pg_control starts with and the fields that follow them in each layout
+func controlFields(pgData *Control) ([]fieldToParse, map[uint32][]fieldToParse) {
 	var (
 		p8          uint8
 		paddingByte = fieldToParse{&p8, "failed to read padding byte: %v"}
 	)
 
-	var pgData = new(Control)
-
 	initialFields := []fieldToParse{
 		fieldToParse{&pgData.SystemIdentifier, "failed to read Database system identifier: %v"},
 		fieldToParse{&pgData.Version, "failed to read pg_control version number: %v"},
+		fieldToParse{&pgData.CatalogVersionNo, "failed to read catalog_version_no: %v"},
+	}
+
+	layout95 := []fieldToParse{
+		fieldToParse{&pgData.State, "failed to read Database cluster state: %v"},
+		fieldToParse{&pgData.Time, "failed to read pg_control last modified time: %v"},
+		fieldToParse{&pgData.CheckPointRecordOffset, "failed to read record offset of Latest checkpoint location: %v"},
+		fieldToParse{&pgData.CheckPointLogID, "failed to read log id of Latest checkpoint location: %v"},
+		fieldToParse{&pgData.PrevCheckPointRecordOffset, "failed to read record offset of Prior checkpoint location: %v"},
+		fieldToParse{&pgData.PrevCheckPointLogID, "failed to read log id of Prior checkpoint location: %v"},
+		fieldToParse{&pgData.CheckPointCopy.RedoRecordOffset, "failed to read record offset of Latest checkpoint's REDO location: %v"},
+		fieldToParse{&pgData.CheckPointCopy.RedoLogID, "failed to read log id of Latest checkpoint's REDO location: %v"},
+		fieldToParse{&pgData.CheckPointCopy.ThisTimeLineID, "failed to read Latest checkpoint's TimeLineID: %v"},
+		fieldToParse{&pgData.CheckPointCopy.PrevTimeLineID, "failed to read Latest checkpoint's prev TimeLineID: %v"},
+		fieldToParse{&pgData.CheckPointCopy.FullPageWrites, "failed to read Latest checkpoint's FullPageWrites: %v"},
+		paddingByte,
+		paddingByte,
+		paddingByte,
+		fieldToParse{&pgData.CheckPointCopy.NextXidEpoch, "failed to read Latest checkpoint's NextXID epoch: %v"},
+		fieldToParse{&pgData.CheckPointCopy.NextXid, "failed to read Latest checkpoint's NextXID: %v"},
+		fieldToParse{&pgData.CheckPointCopy.NextOid, "failed to read Latest checkpoint's NextOID: %v"},
+		fieldToParse{&pgData.CheckPointCopy.NextMulti, "failed to read Latest checkpoint's NextMultiXactId: %v"},
+		fieldToParse{&pgData.CheckPointCopy.NextMultiOffset, "failed to read Latest checkpoint's NextMultiOffset: %v"},
+		fieldToParse{&pgData.CheckPointCopy.OldestXid, "failed to read Latest checkpoint's oldestXID: %v"},
+		fieldToParse{&pgData.CheckPointCopy.OldestXidDB, "failed to read Latest checkpoint's oldestXID's DB: %v"},
+		fieldToParse{&pgData.CheckPointCopy.OldestMulti, "failed to read Latest checkpoint's OldestMulti: %v"},
+		fieldToParse{&pgData.CheckPointCopy.OldestMultiDB, "failed to read Latest checkpoint's OldestMultiDB: %v"},
+		fieldToParse{&pgData.CheckPointCopy.Time, "failed to read Time of latest checkpoint: %v"},
+		fieldToParse{&pgData.CheckPointCopy.OldestCommitTs, "failed to read Latest checkpoint's oldestCommitTsXid: %v"},
+		fieldToParse{&pgData.CheckPointCopy.NewestCommitTs, "failed to read Latest checkpoint's newestCommitTsXid: %v"},
+		fieldToParse{&pgData.CheckPointCopy.OldestActiveXid, "failed to read Latest checkpoint's oldestActiveXID: %v"},
+		paddingByte,
+		paddingByte,
+		paddingByte,
+		paddingByte,
+		fieldToParse{&pgData.UnloggedLSNRecordOffset, "failed to read record offset of unlogged LSN: %v"},
+		fieldToParse{&pgData.UnloggedLSNLogID, "failed to read log id of unlogged LSN: %v"},
+		fieldToParse{&pgData.MinRecoveryPointRecordOffset, "failed to read record offset of Minimum recovery ending location: %v"},
+		fieldToParse{&pgData.MinRecoveryPointLogID, "failed to read log id of Minimum recovery ending location: %v"},
+		fieldToParse{&pgData.MinRecoveryPointTLI, "failed to read log id of Minimum timeline ID: %v"},
+		paddingByte,
+		paddingByte,
+		paddingByte,
+		paddingByte,
+		fieldToParse{&pgData.BackupStartPointRecordOffset, "failed to read record offset of Backup start location: %v"},
+		fieldToParse{&pgData.BackupStartPointLogID, "failed to read log id of Backup start location: %v"},
+		fieldToParse{&pgData.BackupEndPointRecordOffset, "failed to read record offset of Backup end location: %v"},
+		fieldToParse{&pgData.BackupEndPointLogID, "failed to read log id of Backup end location: %v"},
+		fieldToParse{&pgData.BackupEndRequired, "failed to read Backup end required: %v"},
+		paddingByte,
+		paddingByte,
+		paddingByte,
+		fieldToParse{&pgData.WalLevel, "failed to read Current wal_level setting: %v"},
+		fieldToParse{&pgData.WalLogHints, "failed to read wal log hints: %v"},
+		paddingByte,
+		paddingByte,
+		paddingByte,
+		fieldToParse{&pgData.MaxConnections, "failed to read Current max_connections setting: %v"},
+		fieldToParse{&pgData.MaxWorkerProcesses, "failed to read Current max_worker_processes setting: %v"},
+		fieldToParse{&pgData.MaxPreparedXacts, "failed to read Current max_prepared_xacts setting: %v"},
+		fieldToParse{&pgData.MaxLocksPerXact, "failed to read current max_locks_per_xact setting: %v"},
+		fieldToParse{&pgData.TrackCommitTimestamp, "failed to read Current track_commit_timestamp setting: %v"},
+		fieldToParse{&pgData.MaxAlign, "failed to read Maximum data alignment: %v"},
+		paddingByte,
+		paddingByte,
+		paddingByte,
+		paddingByte,
+		fieldToParse{&pgData.FloatFormat, "%v"},
+		fieldToParse{&pgData.Blcksz, "failed to read database block size: %v"},
+		fieldToParse{&pgData.RelsegSize, "failed to read Blocks per segment of large relation: %v"},
+		fieldToParse{&pgData.XlogBlcksz, "failed to read WAL block size: %v"},
+		fieldToParse{&pgData.XlogSegSize, "failed to read Bytes per WAL segment: %v"},
+		fieldToParse{&pgData.NameDataLen, "failed to read Maximum length of identifiers: %v"},
+		fieldToParse{&pgData.IndexMaxKeys, "failed to read Maximum columns in an index: %v"},
+		fieldToParse{&pgData.ToastMaxChunkSize, "failed to read Maximum size of a TOAST chunk: %v"},
+		fieldToParse{&pgData.Loblksize, "failed to read chunk size in pg_largeobject: %v"},
+		fieldToParse{&pgData.EnableIntTimes, "%v"},
+		fieldToParse{&pgData.Float4ByVal, "%v"},
+		fieldToParse{&pgData.Float8ByVal, "%v"},
+		paddingByte,
+		fieldToParse{&pgData.DataChecksumVersion, "%v"},
 	}
+	crc := fieldToParse{&pgData.Crc, "%v"}
+	nonce := fieldToParse{&pgData.MockAuthenticationNonce, "failed to read Mock authentication nonce: %v"}
 
 	versionFields := map[uint32][]fieldToParse{
 		903: []fieldToParse{
-			fieldToParse{&pgData.CatalogVersionNo, "failed to read catalog_version_no: %v"},
 			fieldToParse{&pgData.State, "failed to read Database cluster state: %v"},
 			fieldToParse{&pgData.Time, "failed to read pg_control last modified time: %v"},
 			fieldToParse{&pgData.CheckPointLogID, "failed to read log id of Latest checkpoint location: %v"},
@@ -244,7 +387,6 @@ func NewControl(reader io.Reader) (*Control, error) {
 			fieldToParse{&pgData.Crc, "%v"},
 		},
 		942: []fieldToParse{
-			fieldToParse{&pgData.CatalogVersionNo, "failed to read catalog_version_no: %v"},
 			fieldToParse{&pgData.State, "failed to read Database cluster state: %v"},
 			fieldToParse{&pgData.Time, "failed to read pg_control last modified time: %v"},
 			fieldToParse{&pgData.CheckPointRecordOffset, "failed to read record offset of Latest checkpoint location: %v"},
@@ -316,25 +458,10 @@ func NewControl(reader io.Reader) (*Control, error) {
 			fieldToParse{&pgData.DataChecksumVersion, "%v"},
 			fieldToParse{&pgData.Crc, "%v"},
 		},
+		layoutVersion95: append(append([]fieldToParse{}, layout95...), crc),
+		960:             append(append([]fieldToParse{}, layout95...), crc),
+		1002:            append(append([]fieldToParse{}, layout95...), nonce, crc),
 	}
 
-	for _, ftp := range initialFields {
-		err := binary.Read(reader, binary.LittleEndian, ftp.field)
-		if err != nil {
-			return nil, fmt.Errorf(ftp.errorFmt, err)
-		}
-	}
-
-	if fields, ok := versionFields[pgData.Version]; ok {
-		for _, ftp := range fields {
-			err := binary.Read(reader, binary.LittleEndian, ftp.field)
-			if err != nil {
-				return nil, fmt.Errorf(ftp.errorFmt, err)
-			}
-		}
-	} else {
-		return nil, fmt.Errorf("unknown version %v", pgData.Version)
-	}
-
-	return pgData, nil
+	return initialFields, versionFields
 }
@@ -5,8 +5,11 @@ package control
 // license that can be found in the LICENSE file.
 
 import (
+	"bytes"
+	"encoding/binary"
 	"fmt"
 	"io/ioutil"
+	"math"
 	"path/filepath"
 	"testing"
 )
@@ -162,3 +165,48 @@ func readPGDataFile(t *testing.T) (*Control, *Control, *Control) {
 
 	return pgData1, pgData2, pgData3
 }
+
+func TestPg10ControlLayout(t *testing.T) {
+	bs := make([]byte, controlSize)
+	binary.LittleEndian.PutUint64(bs[0:], 6127242208946681587)
+	binary.LittleEndian.PutUint32(bs[8:], 1002)
+	binary.LittleEndian.PutUint32(bs[12:], 201707211)
+	binary.LittleEndian.PutUint64(bs[32:], 0x0000000103000028)
+	binary.LittleEndian.PutUint32(bs[56:], 2)
+	binary.LittleEndian.PutUint32(bs[200:], 8)
+	binary.LittleEndian.PutUint64(bs[208:], math.Float64bits(floatFormatValue))
+	binary.LittleEndian.PutUint32(bs[216:], 8192)
+	binary.LittleEndian.PutUint32(bs[224:], 8192)
+	binary.LittleEndian.PutUint32(bs[228:], 64*1024*1024)
+	binary.LittleEndian.PutUint32(bs[288:], 0xdeadbeef)
+
+	pgData, err := NewControl(bytes.NewReader(bs))
+	FailIfError(t, err)
+
+	FailIfTrue(t, pgData.CheckPointLogID != 1 || pgData.CheckPointRecordOffset != 0x03000028, "checkpoint location not read correctly")
+	FailIfTrue(t, pgData.CheckPointCopy.ThisTimeLineID != 2, "checkpoint timeline not read correctly")
+	FailIfTrue(t, pgData.MaxAlign != 8, "max align not read correctly")
+	FailIfTrue(t, pgData.FloatFormat != floatFormatValue, "float format not read correctly")
+	FailIfTrue(t, pgData.XlogBlcksz != 8192, "WAL Block size must be 8192")
+	FailIfTrue(t, pgData.XlogSegSize != 64*1024*1024, "WAL segment size must be 64MB")
+	FailIfTrue(t, pgData.Crc != 0xdeadbeef, "crc not read correctly")
+}
+
+func TestControlBytesRoundTrip(t *testing.T) {
+	pgData1, pgData2, pgData3 := readPGDataFile(t)
+	pg94 := &Control{SystemIdentifier: 6127242208946681587, Version: 942, CatalogVersionNo: lastCatalogVersion94, XlogBlcksz: 8192, XlogSegSize: 16 * 1024 * 1024}
+	pg10 := &Control{SystemIdentifier: 6127242208946681587, Version: 1002, CatalogVersionNo: 201707211, MaxAlign: 8, Crc: 0xdeadbeef}
+
+	for _, pgData := range []*Control{pgData1, pgData2, pgData3, pg94, pg10} {
+		bs, err := pgData.Bytes()
+		FailIfError(t, err)
+		FailIfTrue(t, len(bs) != controlSize, fmt.Sprintf("encoded control is %v bytes", len(bs)))
+
+		decoded, err := NewControl(bytes.NewReader(bs))
+		FailIfError(t, err)
+		FailIfTrue(t, *decoded != *pgData, fmt.Sprintf("version %v control did not round trip: %+v", pgData.Version, decoded))
+	}
+
+	_, err := (&Control{Version: 1}).Bytes()
+	FailIfTrue(t, err == nil, "expected unknown version to fail to encode")
+}
@@ -0,0 +1,38 @@
+package control
+
+// Copyright 2015 MediaMath <http://www.mediamath.com>.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"testing"
+)
+
+// FuzzNewControl checks that no pg_control file panics the parser, run it with go test -fuzz FuzzNewControl
+func FuzzNewControl(f *testing.F) {
+	for _, name := range dataFiles {
+		bs, err := ioutil.ReadFile(PGControlTestDir + name)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(bs)
+	}
+
+	pg10 := make([]byte, controlSize)
+	binary.LittleEndian.PutUint32(pg10[8:], 1002)
+	f.Add(pg10)
+	f.Add([]byte{})
+
+	f.Fuzz(func(t *testing.T, bs []byte) {
+		control, err := NewControl(bytes.NewReader(bs))
+		if err != nil {
+			return
+		}
+
+		_ = control.State.String()
+		_ = WalLevel(control.WalLevel).String()
+	})
+}
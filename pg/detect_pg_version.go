@@ -11,20 +11,83 @@ import (
 	"strings"
 )
 
+//VersionDetails describes what is needed to read the WAL of a supported postgres version.
+type VersionDetails struct {
+	Version        string
+	ControlVersion uint32
+	WalDirectory   string
+}
+
+//SupportedVersions is the matrix of postgres versions whose WAL can be read.
+var SupportedVersions = []VersionDetails{
+	{"9.1", 903, "pg_xlog"},
+	{"9.4", 942, "pg_xlog"},
+	{"9.5", 942, "pg_xlog"},
+	{"9.6", 960, "pg_xlog"},
+	{"10", 1002, "pg_wal"},
+}
+
 //ErrIncorrectVersion is returned when a non supported postgres is found.
-var ErrIncorrectVersion = errors.New("only postgres 9.1 is supported")
+var ErrIncorrectVersion = errors.New("only postgres " + strings.Join(supportedVersionNumbers(), ", ") + " are supported")
+
+func supportedVersionNumbers() (versionNumbers []string) {
+	for _, details := range SupportedVersions {
+		versionNumbers = append(versionNumbers, details.Version)
+	}
+	return
+}
+
+//GetVersionDetails returns the details of a supported postgres version.
+func GetVersionDetails(versionNumber string) (VersionDetails, bool) {
+	for _, details := range SupportedVersions {
+		if details.Version == versionNumber {
+			return details, true
+		}
+	}
+
+	return VersionDetails{}, false
+}
+
+//GetVersionDetailsFromControl returns the details of the newest supported postgres version that writes a pg_control version.
+func GetVersionDetailsFromControl(controlVersion uint32) (found VersionDetails, ok bool) {
+	for _, details := range SupportedVersions {
+		if details.ControlVersion == controlVersion {
+			found, ok = details, true
+		}
+	}
+
+	return
+}
 
 //IsPgVersionSupported returns an error if the postgres version is not supported currently.
 func IsPgVersionSupported(versionFilePath string) error {
 	versionNumber, err := DetectPgVersion(versionFilePath)
 
-	if err == nil && versionNumber != "9.1" {
-		err = ErrIncorrectVersion
+	if err == nil {
+		if _, ok := GetVersionDetails(versionNumber); !ok {
+			err = ErrIncorrectVersion
+		}
 	}
 
 	return err
 }
 
+//WalDirectory returns the path of the directory holding the WAL of a data directory.  PG_VERSION is used when present,
+//otherwise the pg_control version decides.
+func WalDirectory(dataDir string, controlVersion uint32) string {
+	name := "pg_xlog"
+
+	if versionNumber, err := DetectPgVersion(dataDir); err == nil {
+		if details, ok := GetVersionDetails(versionNumber); ok {
+			name = details.WalDirectory
+		}
+	} else if details, ok := GetVersionDetailsFromControl(controlVersion); ok {
+		name = details.WalDirectory
+	}
+
+	return path.Join(dataDir, name)
+}
+
 //DetectPgVersion attempts to determine what version of postgres a data directory is based on.
 func DetectPgVersion(versionFilePath string) (versionNumber string, err error) {
 
@@ -42,19 +42,46 @@ func TestPGVersion(t *testing.T) {
 
 func TestIsSupported(t *testing.T) {
 
-	tmpDir1 := writePgVersionFile(t, "9.4")
+	tmpDir1 := writePgVersionFile(t, "8.4")
 	defer os.RemoveAll(tmpDir1)
 
 	err := IsPgVersionSupported(tmpDir1)
-	if err == nil {
+	if err != ErrIncorrectVersion {
 		t.Error("Did not fail on unsupported version")
 	}
 
-	tmpDir2 := writePgVersionFile(t, "9.1")
+	for _, version := range []string{"9.1", "9.4", "9.5", "9.6", "10"} {
+		tmpDir := writePgVersionFile(t, version)
+		defer os.RemoveAll(tmpDir)
+
+		err = IsPgVersionSupported(tmpDir)
+		if err != nil {
+			t.Errorf("%v: %v", version, err)
+		}
+	}
+}
+
+func TestWalDirectory(t *testing.T) {
+
+	tmpDir1 := writePgVersionFile(t, "9.6")
+	defer os.RemoveAll(tmpDir1)
+
+	if dir := WalDirectory(tmpDir1, 1002); dir != path.Join(tmpDir1, "pg_xlog") {
+		t.Errorf("PG_VERSION 9.6 should use pg_xlog but got %v", dir)
+	}
+
+	tmpDir2 := writePgVersionFile(t, "10")
 	defer os.RemoveAll(tmpDir2)
 
-	err = IsPgVersionSupported(tmpDir2)
-	if err != nil {
-		t.Error(err)
+	if dir := WalDirectory(tmpDir2, 0); dir != path.Join(tmpDir2, "pg_wal") {
+		t.Errorf("PG_VERSION 10 should use pg_wal but got %v", dir)
+	}
+
+	if dir := WalDirectory("/nonexistent", 1002); dir != "/nonexistent/pg_wal" {
+		t.Errorf("pg_control version 1002 should use pg_wal but got %v", dir)
+	}
+
+	if dir := WalDirectory("/nonexistent", 903); dir != "/nonexistent/pg_xlog" {
+		t.Errorf("pg_control version 903 should use pg_xlog but got %v", dir)
 	}
 }
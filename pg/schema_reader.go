@@ -15,14 +15,18 @@ import (
 )
 
 const (
-	nameQuery   = "select pg_namespace.nspname, pg_class.relname from pg_class join pg_namespace on pg_namespace.oid = pg_class.relnamespace where pg_relation_filenode(pg_class.oid) = $1"
-	fieldsQuery = "select column_name, data_type, coalesce(character_maximum_length,numeric_precision, 0) as size from information_schema.columns where table_schema = $1 and table_name = $2 order by ordinal_position"
-	relIDName   = "select coalesce(pg_relation_filenode(rel.oid), rel.relfilenode) relation_id, concat_ws('.', current_database(), ns.nspname, rel.relname) relation_name from pg_class rel join pg_namespace ns on ns.oid = rel.relnamespace"
+	nameQuery       = "select pg_namespace.nspname, pg_class.relname from pg_class join pg_namespace on pg_namespace.oid = pg_class.relnamespace where pg_relation_filenode(pg_class.oid) = $1"
+	fieldsQuery     = "select column_name, data_type, coalesce(character_maximum_length,numeric_precision, 0) as size from information_schema.columns where table_schema = $1 and table_name = $2 order by ordinal_position"
+	attributesQuery = "select a.attname, a.atttypid, a.attlen, a.attalign, a.attbyval, a.attisdropped from pg_attribute a join pg_class c on c.oid = a.attrelid join pg_namespace n on n.oid = c.relnamespace where n.nspname = $1 and c.relname = $2 and a.attnum > 0 order by a.attnum"
+	filenodeQuery   = "select pg_relation_filenode(pg_class.oid) from pg_class join pg_namespace on pg_namespace.oid = pg_class.relnamespace where pg_namespace.nspname = $1 and pg_class.relname = $2"
+	relationByOID   = "select pg_class.oid, pg_namespace.nspname, pg_class.relname, pg_class.relkind, coalesce(pg_relation_filenode(pg_class.oid), 0) from pg_class join pg_namespace on pg_namespace.oid = pg_class.relnamespace where pg_class.oid = $1"
+	relationByNode  = "select pg_class.oid, pg_namespace.nspname, pg_class.relname, pg_class.relkind, coalesce(pg_relation_filenode(pg_class.oid), 0) from pg_class join pg_namespace on pg_namespace.oid = pg_class.relnamespace where pg_relation_filenode(pg_class.oid) = $1"
+	relIDName       = "select coalesce(pg_relation_filenode(rel.oid), rel.relfilenode) relation_id, concat_ws('.', current_database(), ns.nspname, rel.relname) relation_name from pg_class rel join pg_namespace ns on ns.oid = rel.relnamespace"
 )
 
 //NewSchema will create a new schema by querying the database
 func NewSchema(database, ns, table string, db *sql.DB) (*Schema, error) {
-	schema := &Schema{database, ns, table, make([]*SchemaField, 0)}
+	schema := &Schema{database, ns, table, make([]*SchemaField, 0), make([]*SchemaAttribute, 0)}
 
 	rs, err := db.Query(fieldsQuery, schema.Namespace, schema.Table)
 	if err != nil {
@@ -48,15 +52,60 @@ func NewSchema(database, ns, table string, db *sql.DB) (*Schema, error) {
 		}
 	}
 
+	attributes, err := readSchemaAttributes(schema.Namespace, schema.Table, db)
+	if err != nil {
+		return nil, err
+	}
+	schema.Attributes = attributes
+
 	return schema, nil
 }
 
+func readSchemaAttributes(ns, table string, db *sql.DB) ([]*SchemaAttribute, error) {
+	rs, err := db.Query(attributesQuery, ns, table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lookup table attributes: %v", err)
+	}
+	defer rs.Close()
+
+	var attributes []*SchemaAttribute
+	for rs.Next() {
+		var align string
+		attribute := new(SchemaAttribute)
+		if err := rs.Scan(&attribute.Column, &attribute.TypeID, &attribute.Length, &align, &attribute.ByValue, &attribute.Dropped); err != nil {
+			return nil, fmt.Errorf("failed to read table attributes row: %v", err)
+		}
+		if len(align) > 0 {
+			attribute.Align = align[0]
+		}
+		attributes = append(attributes, attribute)
+	}
+
+	if err := rs.Err(); err != nil {
+		return nil, fmt.Errorf("error while reading table attributes rows: %v", err)
+	}
+
+	return attributes, nil
+}
+
 //Schema is the full representation of a Table
 type Schema struct {
-	Database  string
-	Namespace string
-	Table     string
-	Fields    []*SchemaField
+	Database   string
+	Namespace  string
+	Table      string
+	Fields     []*SchemaField
+	Attributes []*SchemaAttribute
+}
+
+//Field returns the field of a column if the schema has one
+func (s *Schema) Field(column string) (*SchemaField, bool) {
+	for _, f := range s.Fields {
+		if f.Column == column {
+			return f, true
+		}
+	}
+
+	return nil, false
 }
 
 func (s *Schema) String() string {
@@ -109,6 +158,30 @@ func (sf SchemaField) String() string {
 	return kind
 }
 
+//SchemaAttribute describes how the values of a column are stored in a tuple, including dropped columns that still take up a slot
+type SchemaAttribute struct {
+	Column  string
+	TypeID  uint32
+	Length  int16
+	Align   byte
+	ByValue bool
+	Dropped bool
+}
+
+//Relation is a relation as the catalog has it, with the relfilenode its storage has now
+type Relation struct {
+	OID        uint32
+	Namespace  string
+	Table      string
+	Kind       string
+	RelationID uint32
+}
+
+//IsIndexOrToast is true for indexes and for the toast tables that hold the large values of a table
+func (r *Relation) IsIndexOrToast() bool {
+	return r.Kind == "i" || r.Kind == "t"
+}
+
 //DatabaseDetails represents a connection
 type DatabaseDetails struct {
 	Name string
@@ -159,6 +232,11 @@ func resolveDatabaseConnections(creds []string, driverName string) (map[uint32]D
 	return conns, nil
 }
 
+//FieldSizeLimit is the maximum number of characters kept of a field value, 0 means no limit.
+func (sr *SchemaReader) FieldSizeLimit() uint32 {
+	return sr.fieldSizeLimit
+}
+
 //LatestReplayLocation finds the last replicated WAL entry
 func (sr *SchemaReader) LatestReplayLocation() uint64 {
 	for _, dbDetails := range sr.conns {
@@ -222,8 +300,13 @@ func (sr *SchemaReader) HaveConnectionToDb(databaseID uint32) bool {
 	return ok
 }
 
-func (sr *SchemaReader) getSchema(databaseID uint32, relationID uint32) (*Schema, error) {
-	key := fmt.Sprintf("%v:%v", databaseID, relationID)
+func schemaKey(databaseID uint32, relationID uint32) string {
+	return fmt.Sprintf("%v:%v", databaseID, relationID)
+}
+
+//GetSchema returns the cached schema of a relation, reading it from the database the first time it is asked for.
+func (sr *SchemaReader) GetSchema(databaseID uint32, relationID uint32) (*Schema, error) {
+	key := schemaKey(databaseID, relationID)
 
 	schema, ok := sr.schemaCache[key]
 	if ok {
@@ -242,12 +325,102 @@ func (sr *SchemaReader) getSchema(databaseID uint32, relationID uint32) (*Schema
 	}
 
 	schema, err = NewSchema(dbDetails.Name, namespace, table, db)
+	if err != nil {
+		return nil, err
+	}
 
 	sr.schemaCache[key] = schema
 
 	return schema, nil
 }
 
+//Invalidate forgets the cached schema of a relation so that it is read from the database again the next time it is
+//asked for.  Relations are cached by relfilenode, which a truncate or a rewrite of the relation replaces.
+func (sr *SchemaReader) Invalidate(databaseID uint32, relationID uint32) {
+	delete(sr.schemaCache, schemaKey(databaseID, relationID))
+}
+
+//InvalidateRelation forgets the cached schema of the relation with an oid, or of every relation of the database when
+//the oid is 0.  The definition of a relation changes without a new relfilenode when a column is added or dropped.
+func (sr *SchemaReader) InvalidateRelation(databaseID uint32, oid uint32) error {
+	if oid == 0 {
+		prefix := fmt.Sprintf("%v:", databaseID)
+		for key := range sr.schemaCache {
+			if strings.HasPrefix(key, prefix) {
+				delete(sr.schemaCache, key)
+			}
+		}
+		return nil
+	}
+
+	rel, err := sr.GetRelationByOID(databaseID, oid)
+	if err != nil {
+		return err
+	} else if rel != nil {
+		sr.Invalidate(databaseID, rel.RelationID)
+	}
+
+	return nil
+}
+
+//CachedNamespaceAndTable returns the namespace and table names of a relation if its schema is cached, without asking
+//the database.  It names a relfilenode the database no longer has.
+func (sr *SchemaReader) CachedNamespaceAndTable(databaseID uint32, relationID uint32) (string, string) {
+	schema := sr.schemaCache[schemaKey(databaseID, relationID)]
+	if schema == nil {
+		return "", ""
+	}
+
+	return schema.Namespace, schema.Table
+}
+
+//GetRelationID returns the relfilenode a table has now, it is 0 when the database has no such table.
+func (sr *SchemaReader) GetRelationID(databaseID uint32, namespace string, table string) (uint32, error) {
+	dbDetails, ok := sr.conns[databaseID]
+	if !ok {
+		return 0, nil
+	}
+
+	var relationID uint32
+	err := dbDetails.Conn.QueryRow(filenodeQuery, namespace, table).Scan(&relationID)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	} else if err != nil {
+		return 0, fmt.Errorf("failed to lookup relfilenode of %v.%v: %v", namespace, table, err)
+	}
+
+	return relationID, nil
+}
+
+//GetRelationByOID returns the relation with an oid, it is nil when the database has no such relation.  A relation
+//keeps the relfilenode it is created with, which is its oid, until it is first rewritten.
+func (sr *SchemaReader) GetRelationByOID(databaseID uint32, oid uint32) (*Relation, error) {
+	return sr.getRelation(databaseID, relationByOID, oid)
+}
+
+//GetRelationByRelationID returns the relation whose storage is a relfilenode, it is nil when the database has no such
+//relation.
+func (sr *SchemaReader) GetRelationByRelationID(databaseID uint32, relationID uint32) (*Relation, error) {
+	return sr.getRelation(databaseID, relationByNode, relationID)
+}
+
+func (sr *SchemaReader) getRelation(databaseID uint32, query string, id uint32) (*Relation, error) {
+	dbDetails, ok := sr.conns[databaseID]
+	if !ok {
+		return nil, nil
+	}
+
+	rel := &Relation{}
+	err := dbDetails.Conn.QueryRow(query, id).Scan(&rel.OID, &rel.Namespace, &rel.Table, &rel.Kind, &rel.RelationID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to lookup relation %v: %v", id, err)
+	}
+
+	return rel, nil
+}
+
 func getNamespaceAndTable(database string, relationID uint32, db *sql.DB) (namespace string, table string, err error) {
 	rs, err := db.Query(nameQuery, relationID)
 	if err != nil {
@@ -283,7 +456,7 @@ func (sr *SchemaReader) GetDatabaseName(databaseID uint32) string {
 
 //GetNamespaceAndTable takes a database id and a relation id and returns the namespace and table names
 func (sr *SchemaReader) GetNamespaceAndTable(databaseID uint32, relationID uint32) (string, string) {
-	schema, err := sr.getSchema(databaseID, relationID)
+	schema, err := sr.GetSchema(databaseID, relationID)
 	if err != nil || schema == nil {
 		return "", ""
 	}
@@ -302,7 +475,7 @@ func (sr *SchemaReader) GetFieldValues(databaseID uint32, relationID uint32, blo
 
 	db := dbDetails.Conn
 
-	schema, err := sr.getSchema(databaseID, relationID)
+	schema, err := sr.GetSchema(databaseID, relationID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to retrieve schema: %v", err)
 	} else if schema == nil {
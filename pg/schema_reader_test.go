@@ -0,0 +1,51 @@
+package pg
+
+// Copyright 2015 MediaMath <http://www.mediamath.com>.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+import "testing"
+
+func TestInvalidateSchema(t *testing.T) {
+	sr := &SchemaReader{schemaCache: map[string]*Schema{
+		schemaKey(16384, 16385): {Database: "shop", Namespace: "public", Table: "users"},
+		schemaKey(16384, 16390): {Database: "shop", Namespace: "public", Table: "orders"},
+	}}
+
+	if ns, table := sr.CachedNamespaceAndTable(16384, 16385); ns != "public" || table != "users" {
+		t.Errorf("expected public.users to be cached but got %v.%v", ns, table)
+	}
+
+	sr.Invalidate(16384, 16385)
+
+	if ns, table := sr.CachedNamespaceAndTable(16384, 16385); ns != "" || table != "" {
+		t.Errorf("expected 16385 to be forgotten but got %v.%v", ns, table)
+	}
+
+	if _, table := sr.CachedNamespaceAndTable(16384, 16390); table != "orders" {
+		t.Errorf("expected other relations to stay cached but got %v", table)
+	}
+
+	// a reader without connections has no relfilenodes to look up
+	if id, err := sr.GetRelationID(16384, "public", "users"); id != 0 || err != nil {
+		t.Errorf("expected no relfilenode without a connection but got %v: %v", id, err)
+	}
+
+	if rel, err := sr.GetRelationByOID(16384, 16385); rel != nil || err != nil {
+		t.Errorf("expected no relation without a connection but got %v: %v", rel, err)
+	}
+
+	// every relation of a database is forgotten when the oid is 0
+	sr.schemaCache[schemaKey(16385, 16390)] = &Schema{Database: "other", Namespace: "public", Table: "orders"}
+	if err := sr.InvalidateRelation(16384, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, table := sr.CachedNamespaceAndTable(16384, 16390); table != "" {
+		t.Errorf("expected every relation of 16384 to be forgotten but got %v", table)
+	}
+
+	if _, table := sr.CachedNamespaceAndTable(16385, 16390); table != "orders" {
+		t.Errorf("expected the relations of other databases to stay cached but got %v", table)
+	}
+}
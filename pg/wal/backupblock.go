@@ -0,0 +1,269 @@
+package wal
+
+// Copyright 2015 MediaMath <http://www.mediamath.com>.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+import (
+	"fmt"
+
+	"github.com/MediaMath/keryxlib/pg"
+)
+
+// HeapPageSize is the size of the pages of relations, which is the block size postgres is built with by default.  The
+// images of the pages a record backs up are read with it when the size of the pages is not known.
+const HeapPageSize = 8192
+
+// These constants describe the backup blocks of 9.1 and 9.4 records, which follow the main data and are flagged in the
+// low bits of the info of the record
+const (
+	sizeOfBkpBlock    = 24
+	maxBackupBlocks91 = 4
+)
+
+// These constants describe the layout of a heap page and the line pointers that find the tuples on it
+const (
+	sizeOfPageHeader       = 24
+	sizeOfItemID           = 4
+	lpNormal               = 1
+	offsetOfTupleInfomask2 = 18
+)
+
+// BackupBlock is the full page image a record carries of a page it changes, in place of what it changed on the page.
+// The image leaves out the hole in the middle of the page, which is all zeros, and is compressed when Compressed is
+// set.  The page is PageSize bytes, or HeapPageSize when that is zero.
+type BackupBlock struct {
+	ID           uint8
+	TablespaceID uint32
+	DatabaseID   uint32
+	RelationID   uint32
+	ForkNumber   uint8
+	Block        uint32
+	HoleOffset   uint16
+	HoleLength   uint16
+	Compressed   bool
+	Image        []byte
+	PageSize     int
+}
+
+func (b BackupBlock) String() string {
+	return fmt.Sprintf("backup block #%v: rel %v/%v/%v fork %v blk %v hole %v/%v", b.ID, b.TablespaceID, b.DatabaseID, b.RelationID, b.ForkNumber, b.Block, b.HoleOffset, b.HoleLength)
+}
+
+// Page reconstructs the page the image is of, decompressing it and putting the hole back
+func (b BackupBlock) Page() ([]byte, error) {
+	pageSize := pageSizeOrDefault(b.PageSize)
+
+	image := b.Image
+	if b.Compressed {
+		var err error
+		if image, err = pglzDecompress(b.Image, pageSize-int(b.HoleLength)); err != nil {
+			return nil, fmt.Errorf("%v: %v", b, err)
+		}
+	}
+
+	holeEnd := int(b.HoleOffset) + int(b.HoleLength)
+	if holeEnd > pageSize || len(image) != pageSize-int(b.HoleLength) {
+		return nil, fmt.Errorf("%v: image of %v bytes does not make a page", b, len(image))
+	}
+
+	page := make([]byte, pageSize)
+	copy(page, image[:b.HoleOffset])
+	copy(page[holeEnd:], image[b.HoleOffset:])
+
+	return page, nil
+}
+
+// Tuple reads the tuple at an item number of the page the image is of the way a record logs it, it is false when the
+// item is not a tuple
+func (b BackupBlock) Tuple(offset uint16) (TupleData, bool) {
+	page, err := b.Page()
+	if err != nil {
+		return nil, false
+	}
+
+	return pageTuple(page, offset)
+}
+
+// pageTuple reads the tuple at an item number of a heap page
+func pageTuple(page []byte, offset uint16) (TupleData, bool) {
+	itemID := sizeOfPageHeader + (int(offset)-1)*sizeOfItemID
+	if offset == 0 || len(page) < sizeOfPageHeader || itemID+sizeOfItemID > int(pg.LUint(page[12:14])) || itemID+sizeOfItemID > len(page) {
+		return nil, false
+	}
+
+	item := uint32(pg.LUint(page[itemID : itemID+sizeOfItemID]))
+	start, flags, length := int(item&0x7FFF), item>>15&0x03, int(item>>17)
+	if flags != lpNormal || length < offsetOfTupleInfomask2+sizeOfHeapHeader || start+length > len(page) {
+		return nil, false
+	}
+
+	// the infomasks and t_hoff of a heap tuple header are laid out like an xl_heap_header and the null bitmap follows
+	return NewTupleData(page[start+offsetOfTupleInfomask2 : start+length])
+}
+
+// backupPages finds the tuples heap data does not log on the pages a record backs up, reconstructing each page once
+type backupPages struct {
+	blocks []BackupBlock
+	pages  map[int][]byte
+}
+
+func newBackupPages(body *RecordBody) *backupPages {
+	// a record whose backup blocks cannot be read has no tuples to find there, which is not an error for its entries
+	blocks, _ := body.BackupBlocks()
+	return &backupPages{blocks, make(map[int][]byte)}
+}
+
+// newTuple reads the new tuple of heap data from the image of the page it is on
+func (b *backupPages) newTuple(data HeapData) TupleData {
+	for i, block := range b.blocks {
+		if block.ForkNumber != 0 || block.Block != data.ToBlock() || block.RelationID != data.RelationID() || block.DatabaseID != data.DatabaseID() || block.TablespaceID != data.TablespaceID() {
+			continue
+		}
+
+		page, ok := b.pages[i]
+		if !ok {
+			page, _ = block.Page()
+			b.pages[i] = page
+		}
+
+		tuple, _ := pageTuple(page, data.ToOffset())
+		return tuple
+	}
+
+	return nil
+}
+
+// pageSizeOrDefault is the size of pages when it is known and HeapPageSize otherwise
+func pageSizeOrDefault(pageSize int) int {
+	if pageSize <= 0 {
+		return HeapPageSize
+	}
+
+	return pageSize
+}
+
+// newBackupBlocks91 reads the backup blocks of a 9.1 or 9.4 record that the info of the record flags, whose pages are
+// pageSize bytes
+func newBackupBlocks91(info uint8, bs []byte, pageSize int) ([]BackupBlock, error) {
+	pageSize = pageSizeOrDefault(pageSize)
+
+	var blocks []BackupBlock
+
+	pos := 0
+	for i := uint8(0); i < maxBackupBlocks91; i++ {
+		if info&(0x08>>i) == 0 {
+			continue
+		}
+
+		if pos+sizeOfBkpBlock > len(bs) {
+			return nil, shortRecordError(fmt.Sprintf("backup block %v", i), pos+sizeOfBkpBlock, len(bs))
+		}
+
+		block := BackupBlock{
+			ID:           i,
+			TablespaceID: uint32(pg.LUint(bs[pos : pos+4])),
+			DatabaseID:   uint32(pg.LUint(bs[pos+4 : pos+8])),
+			RelationID:   uint32(pg.LUint(bs[pos+8 : pos+12])),
+			ForkNumber:   uint8(pg.LUint(bs[pos+12 : pos+16])),
+			Block:        uint32(pg.LUint(bs[pos+16 : pos+20])),
+			HoleOffset:   uint16(pg.LUint(bs[pos+20 : pos+22])),
+			HoleLength:   uint16(pg.LUint(bs[pos+22 : pos+24])),
+			PageSize:     pageSize,
+		}
+		pos += sizeOfBkpBlock
+
+		if int(block.HoleOffset)+int(block.HoleLength) > pageSize {
+			return nil, fmt.Errorf("%v has a hole past the end of the page", block)
+		}
+
+		end := pos + pageSize - int(block.HoleLength)
+		if end > len(bs) {
+			return nil, shortRecordError(fmt.Sprintf("backup block %v", i), end, len(bs))
+		}
+
+		block.Image = bs[pos:end]
+		pos = end
+
+		blocks = append(blocks, block)
+	}
+
+	return blocks, nil
+}
+
+// newBackupBlocks reads the images of the block references of a 9.5+ record, whose pages are pageSize bytes
+func newBackupBlocks(record *BlockRecord, pageSize int) []BackupBlock {
+	pageSize = pageSizeOrDefault(pageSize)
+
+	var blocks []BackupBlock
+	for _, ref := range record.Blocks {
+		if ref.HasImage() {
+			blocks = append(blocks, BackupBlock{
+				ID:           ref.ID,
+				TablespaceID: ref.TablespaceID,
+				DatabaseID:   ref.DatabaseID,
+				RelationID:   ref.RelationID,
+				ForkNumber:   ref.ForkNumber,
+				Block:        ref.Block,
+				HoleOffset:   ref.HoleOffset,
+				HoleLength:   ref.ImageHoleLength(pageSize),
+				Compressed:   ref.IsImageCompressed(),
+				Image:        ref.Image,
+				PageSize:     pageSize,
+			})
+		}
+	}
+
+	return blocks
+}
+
+// pglzDecompress decompresses what postgres compressed with pglz to its raw size
+func pglzDecompress(bs []byte, rawSize int) ([]byte, error) {
+	out := make([]byte, 0, rawSize)
+
+	pos := 0
+	for pos < len(bs) && len(out) < rawSize {
+		control := bs[pos]
+		pos++
+
+		for bit := uint(0); bit < 8 && pos < len(bs); bit++ {
+			if control&(1<<bit) == 0 {
+				// a literal byte
+				out = append(out, bs[pos])
+				pos++
+				continue
+			}
+
+			// a tag copies length bytes from offset bytes back in the output
+			if pos+2 > len(bs) {
+				return nil, fmt.Errorf("pglz tag at %v is cut off", pos)
+			}
+
+			length := int(bs[pos]&0x0F) + 3
+			offset := int(bs[pos]&0xF0)<<4 | int(bs[pos+1])
+			pos += 2
+
+			if length == 18 {
+				if pos >= len(bs) {
+					return nil, fmt.Errorf("pglz tag at %v is cut off", pos)
+				}
+				length += int(bs[pos])
+				pos++
+			}
+
+			if offset == 0 || offset > len(out) || len(out)+length > rawSize {
+				return nil, fmt.Errorf("pglz tag at %v copies %v bytes from %v back in %v bytes", pos, length, offset, len(out))
+			}
+
+			for i := 0; i < length; i++ {
+				out = append(out, out[len(out)-offset])
+			}
+		}
+	}
+
+	if len(out) != rawSize || pos != len(bs) {
+		return nil, fmt.Errorf("pglz data of %v bytes decompresses to %v bytes instead of %v", len(bs), len(out), rawSize)
+	}
+
+	return out, nil
+}
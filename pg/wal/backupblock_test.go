@@ -0,0 +1,115 @@
+package wal
+
+// Copyright 2015 MediaMath <http://www.mediamath.com>.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestPglzDecompress(t *testing.T) {
+	// four literals and a tag copying 20 bytes from 4 back, whose length needs the extra byte
+	out, err := pglzDecompress([]byte{0x10, 'a', 'b', 'c', 'd', 0x0F, 0x04, 0x02}, 24)
+	if err != nil || string(out) != "abcdabcdabcdabcdabcdabcd" {
+		t.Errorf("expected abcd 6 times but got %q: %v", out, err)
+	}
+
+	for _, bad := range [][]byte{
+		{0x01, 0x0F, 0x04, 0x02},               // a tag copying from before the start
+		{0x10, 'a', 'b', 'c', 'd', 0x0F},       // a cut off tag
+		{0x10, 'a', 'b', 'c', 'd', 0x01, 0x04}, // too short a result
+	} {
+		if _, err := pglzDecompress(bad, 24); err == nil {
+			t.Errorf("expected %v to not decompress", bad)
+		}
+	}
+}
+
+func TestBackupBlockPage(t *testing.T) {
+	image := append(bytes.Repeat([]byte{1}, 100), bytes.Repeat([]byte{2}, 92)...)
+	page, err := BackupBlock{HoleOffset: 100, HoleLength: HeapPageSize - 192, Image: image}.Page()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(page) != HeapPageSize || page[99] != 1 || page[100] != 0 || page[HeapPageSize-93] != 0 || page[HeapPageSize-92] != 2 {
+		t.Errorf("expected the hole to be put back between the two parts of the image")
+	}
+
+	// a literal and a tag repeating it 191 times
+	compressed := BackupBlock{HoleOffset: 100, HoleLength: HeapPageSize - 192, Compressed: true, Image: []byte{0x02, 0x07, 0x0F, 0x01, 173}}
+	if page, err := compressed.Page(); err != nil || page[0] != 7 || page[99] != 7 || page[100] != 0 || page[HeapPageSize-1] != 7 {
+		t.Errorf("expected the compressed image to make a page but got %v", err)
+	}
+
+	if _, err := (BackupBlock{HoleOffset: 100, HoleLength: 8000, Image: image[:10]}).Page(); err == nil {
+		t.Error("expected an image too short for its hole to not make a page")
+	}
+}
+
+func TestBackupBlockTuple(t *testing.T) {
+	page := make([]byte, HeapPageSize)
+	tuple := append(make([]byte, offsetOfTupleInfomask2), 1, 0, 0, 0, 24, 0, 'k')
+	copy(page[8000:], tuple)
+
+	binary.LittleEndian.PutUint32(page[24:], 8000|lpNormal<<15|uint32(len(tuple))<<17)
+	binary.LittleEndian.PutUint32(page[28:], 0)
+	binary.LittleEndian.PutUint16(page[12:14], 32)
+
+	block := BackupBlock{Image: page}
+	if data, ok := block.Tuple(1); !ok || !bytes.Equal(data.UserData(), []byte("k")) || data.NumberOfAttributes() != 1 {
+		t.Errorf("expected the tuple at 1 but got %v (%v)", data, ok)
+	}
+
+	for _, offset := range []uint16{0, 2, 3} {
+		if _, ok := block.Tuple(offset); ok {
+			t.Errorf("expected no tuple at %v", offset)
+		}
+	}
+}
+
+func TestBackupBlocks91(t *testing.T) {
+	header := make([]byte, sizeOfBkpBlock)
+	binary.LittleEndian.PutUint32(header[8:12], 16385)
+	binary.LittleEndian.PutUint32(header[16:20], 7)
+	binary.LittleEndian.PutUint16(header[20:22], 40)
+	binary.LittleEndian.PutUint16(header[22:24], HeapPageSize-50)
+
+	bs := append(header, make([]byte, 50)...)
+
+	// the second flag is the second block
+	blocks, err := newBackupBlocks91(0x04, bs, HeapPageSize)
+	if err != nil || len(blocks) != 1 || blocks[0].ID != 1 || blocks[0].RelationID != 16385 || blocks[0].Block != 7 || len(blocks[0].Image) != 50 {
+		t.Errorf("expected block 1 of 16385 with a 50 byte image but got %v: %v", blocks, err)
+	}
+
+	if _, err := newBackupBlocks91(0x0C, bs, HeapPageSize); err == nil {
+		t.Error("expected a second block that is not there to be too short")
+	}
+}
+
+func TestUncompressedBlockImageHole(t *testing.T) {
+	// block 0 of the main fork with an image of 100 bytes that has a hole at 40 and no data
+	bs := []byte{0x00, blockHasImage, 0, 0, 100, 0, 40, 0, imageHasHole}
+	bs = append(bs, make([]byte, 16)...)
+	bs = append(bs, make([]byte, 100)...)
+
+	record, err := NewBlockRecord(bs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, pageSize := range []int{HeapPageSize, 2 * HeapPageSize} {
+		blocks := newBackupBlocks(record, pageSize)
+		if len(blocks) != 1 || blocks[0].HoleOffset != 40 || int(blocks[0].HoleLength) != pageSize-100 {
+			t.Fatalf("expected the hole to be the rest of a %v byte page but got %v", pageSize, blocks)
+		}
+
+		if page, err := blocks[0].Page(); err != nil || len(page) != pageSize {
+			t.Errorf("expected a %v byte page but got %v bytes: %v", pageSize, len(page), err)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package wal
+
+// Copyright 2015 MediaMath <http://www.mediamath.com>.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+import (
+	"container/list"
+	"io"
+	"sync"
+)
+
+// These are the defaults for the number of segments kept open, the number of pages kept and the number of pages read
+// at once by a cursor
+const (
+	DefaultCachedSegments = 4
+	DefaultCachedPages    = 256
+	DefaultReadAheadPages = 16
+)
+
+type pageKey struct {
+	segment SegmentName
+	offset  int64
+}
+
+type cachedSegment struct {
+	name    SegmentName
+	segment Segment
+}
+
+type cachedPage struct {
+	key  pageKey
+	page []byte
+}
+
+// blockCache keeps segments open and the pages read from them so that scanning a page byte by byte or moving
+// through a segment page by page does not go back to the source for every read.  Pages are read ahead of the one
+// asked for, but only pages that hold what postgres has written are kept.
+type blockCache struct {
+	lock sync.Mutex
+
+	segments    *list.List
+	segmentsBy  map[SegmentName]*list.Element
+	maxSegments int
+
+	pages    *list.List
+	pagesBy  map[pageKey]*list.Element
+	maxPages int
+
+	readAhead int
+}
+
+func newBlockCache(maxSegments, maxPages, readAhead int) *blockCache {
+	if readAhead < 1 {
+		readAhead = 1
+	}
+
+	return &blockCache{
+		segments:    list.New(),
+		segmentsBy:  make(map[SegmentName]*list.Element),
+		maxSegments: maxSegments,
+		pages:       list.New(),
+		pagesBy:     make(map[pageKey]*list.Element),
+		maxPages:    maxPages,
+		readAhead:   readAhead,
+	}
+}
+
+func newDefaultBlockCache() *blockCache {
+	return newBlockCache(DefaultCachedSegments, DefaultCachedPages, DefaultReadAheadPages)
+}
+
+// readPage returns the page at location, reading it and the pages after it in its segment from the source if it is
+// not cached
+func (c *blockCache) readPage(source SegmentSource, location Location, pageSize uint32, systemID uint64) ([]byte, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	key := pageKey{location.SegmentName(), int64(location.StartOfPage().FromStartOfFile())}
+	if element, ok := c.pagesBy[key]; ok {
+		c.pages.MoveToFront(element)
+		return element.Value.(*cachedPage).page, nil
+	}
+
+	segment, err := c.openSegment(source, key.segment)
+	if err != nil {
+		return nil, err
+	}
+
+	pages := c.readAhead
+	if remaining := int((uint64(location.FileSize()) - uint64(key.offset)) / uint64(pageSize)); remaining < pages {
+		pages = remaining
+	}
+	if pages < 1 {
+		pages = 1
+	}
+
+	bs := make([]byte, pages*int(pageSize))
+	count, err := segment.ReadAt(bs, key.offset)
+	if count < int(pageSize) {
+		c.closeSegment(key.segment)
+		if err == nil {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	for i := 0; (i+1)*int(pageSize) <= count; i++ {
+		page := bs[i*int(pageSize) : (i+1)*int(pageSize)]
+		pageLocation := location.StartOfPage().Add(uint64(i) * uint64(pageSize))
+		if (Page{page}).Validate(pageLocation, systemID) != nil {
+			break
+		}
+
+		c.addPage(pageKey{key.segment, key.offset + int64(i)*int64(pageSize)}, page)
+	}
+
+	return bs[:pageSize], nil
+}
+
+// forget drops the pages and the open segment of a segment, which is needed when what was read from it is wrong
+func (c *blockCache) forget(name SegmentName) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for key, element := range c.pagesBy {
+		if key.segment == name {
+			c.pages.Remove(element)
+			delete(c.pagesBy, key)
+		}
+	}
+
+	c.closeSegment(name)
+}
+
+// clear drops every page and closes every segment, the next read sees what is in the source now
+func (c *blockCache) clear() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.pages.Init()
+	c.pagesBy = make(map[pageKey]*list.Element)
+
+	for name := range c.segmentsBy {
+		c.closeSegment(name)
+	}
+}
+
+func (c *blockCache) openSegment(source SegmentSource, name SegmentName) (Segment, error) {
+	if element, ok := c.segmentsBy[name]; ok {
+		c.segments.MoveToFront(element)
+		return element.Value.(*cachedSegment).segment, nil
+	}
+
+	segment, err := source.OpenSegment(name)
+	if err != nil {
+		return nil, err
+	}
+
+	c.segmentsBy[name] = c.segments.PushFront(&cachedSegment{name, segment})
+	for c.segments.Len() > c.maxSegments {
+		c.closeSegment(c.segments.Back().Value.(*cachedSegment).name)
+	}
+
+	return segment, nil
+}
+
+func (c *blockCache) closeSegment(name SegmentName) {
+	if element, ok := c.segmentsBy[name]; ok {
+		element.Value.(*cachedSegment).segment.Close()
+		c.segments.Remove(element)
+		delete(c.segmentsBy, name)
+	}
+}
+
+func (c *blockCache) addPage(key pageKey, page []byte) {
+	if element, ok := c.pagesBy[key]; ok {
+		element.Value.(*cachedPage).page = page
+		c.pages.MoveToFront(element)
+		return
+	}
+
+	c.pagesBy[key] = c.pages.PushFront(&cachedPage{key, page})
+	for c.pages.Len() > c.maxPages {
+		oldest := c.pages.Back()
+		c.pages.Remove(oldest)
+		delete(c.pagesBy, oldest.Value.(*cachedPage).key)
+	}
+}
@@ -0,0 +1,131 @@
+package wal
+
+// Copyright 2015 MediaMath <http://www.mediamath.com>.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type countingSource struct {
+	SegmentSource
+	opens int
+}
+
+func (c *countingSource) OpenSegment(name SegmentName) (Segment, error) {
+	c.opens++
+	return c.SegmentSource.OpenSegment(name)
+}
+
+// writtenSegment is a segment starting at location with its first pages written
+func writtenSegment(location Location, pages, written int) []byte {
+	segment := make([]byte, pages*0x2000)
+	for i := 0; i < written; i++ {
+		page := segment[i*0x2000:]
+		copy(page, pageExpectations[1].bs)
+		binary.LittleEndian.PutUint32(page[12:16], uint32(location.Offset())+uint32(i*0x2000))
+	}
+
+	return segment
+}
+
+func TestBlockCacheReadsAhead(t *testing.T) {
+	location := NewLocationWithDefaults(0x0000000013000000)
+	memory := NewMemorySource()
+	memory.Add(location.SegmentName(), writtenSegment(location, 8, 4))
+
+	source := &countingSource{SegmentSource: memory}
+	reader := blockReader{blockSize: 0x2000, wordSize: 8, source: source, cache: newBlockCache(1, 16, 16)}
+
+	for i := 0; i < 4; i++ {
+		for j := 0; j < 3; j++ {
+			if _, err := reader.readBlockOnTimeline(location.Add(uint64(i * 0x2000))); err != nil {
+				t.Fatalf("expected page %v to be read but got %v", i, err)
+			}
+		}
+	}
+
+	if source.opens != 1 {
+		t.Errorf("expected the segment to be opened once but it was opened %v times", source.opens)
+	}
+
+	if _, err := reader.readBlockOnTimeline(location.Add(4 * 0x2000)); err == nil {
+		t.Fatal("expected unwritten page to fail")
+	} else if _, ok := err.(*PageNotWrittenError); !ok {
+		t.Fatalf("expected unwritten page to not be written but got %v", err)
+	}
+
+	memory.Add(location.SegmentName(), writtenSegment(location, 8, 5))
+	if _, err := reader.readBlockOnTimeline(location.Add(4 * 0x2000)); err != nil {
+		t.Errorf("expected page written since it was last read to be read but got %v", err)
+	}
+}
+
+func TestBlockCacheEvictsSegments(t *testing.T) {
+	first := NewLocationWithDefaults(0x0000000013000000)
+	second := first.StartOfNextFile()
+
+	memory := NewMemorySource()
+	memory.Add(first.SegmentName(), writtenSegment(first, 1, 1))
+	memory.Add(second.SegmentName(), writtenSegment(second, 1, 1))
+
+	source := &countingSource{SegmentSource: memory}
+	reader := blockReader{blockSize: 0x2000, wordSize: 8, source: source, cache: newBlockCache(1, 1, 1)}
+
+	for _, location := range []Location{first, second, first} {
+		if _, err := reader.readBlockOnTimeline(location); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if source.opens != 3 {
+		t.Errorf("expected each read to open its segment but there were %v opens", source.opens)
+	}
+
+	if len(reader.cache.segmentsBy) != 1 || len(reader.cache.pagesBy) != 1 {
+		t.Errorf("expected one segment and page to be kept but there were %v and %v", len(reader.cache.segmentsBy), len(reader.cache.pagesBy))
+	}
+}
+
+func benchmarkReadBlock(b *testing.B, cache *blockCache) {
+	dir, err := ioutil.TempDir("", "blockcache")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	const pages = 64
+	location := NewLocationWithDefaults(0x0000000013000000)
+	if err := ioutil.WriteFile(filepath.Join(dir, location.Filename()), writtenSegment(location, pages, pages), 0644); err != nil {
+		b.Fatal(err)
+	}
+
+	reader := blockReader{walDirPath: dir, blockSize: 0x2000, wordSize: 8, cache: cache}
+	b.ResetTimer()
+
+	// the scans read the page they are on again for every word they look at
+	for n := 0; n < b.N; n++ {
+		for i := 0; i < pages; i++ {
+			for j := 0; j < 32; j++ {
+				reader.readBlock(location.Add(uint64(i*0x2000 + j*8)))
+			}
+		}
+
+		if cache != nil {
+			cache.clear()
+		}
+	}
+}
+
+func BenchmarkReadBlockUncached(b *testing.B) {
+	benchmarkReadBlock(b, nil)
+}
+
+func BenchmarkReadBlockCached(b *testing.B) {
+	benchmarkReadBlock(b, newDefaultBlockCache())
+}
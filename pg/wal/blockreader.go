@@ -5,37 +5,105 @@ package wal
 // license that can be found in the LICENSE file.
 
 import (
+	"errors"
 	"fmt"
 	"os"
-	"path/filepath"
 )
 
 type blockReader struct {
-	dataDirPath string
-	blockSize   uint32
-	wordSize    uint32
+	walDirPath string
+	blockSize  uint32
+	wordSize   uint32
+	systemID   uint64
+	timelines  *Timelines
+	source     SegmentSource
+	cache      *blockCache
 }
 
-func (b *blockReader) readBlock(location Location) []byte {
-	filename := filepath.Join(b.dataDirPath, "pg_xlog", location.Filename())
+// segments is where segments are read from, the WAL directory unless another source is set
+func (b *blockReader) segments() SegmentSource {
+	if b.source == nil {
+		return dirSource(b.walDirPath)
+	}
+
+	return b.source
+}
+
+// onTimeline moves a location to the timeline holding it
+func (b *blockReader) onTimeline(location Location) Location {
+	if b.timelines == nil {
+		return location
+	}
+
+	return location.OnTimeline(b.timelines.TimelineAt(location.Offset()))
+}
+
+func (b *blockReader) readBlock(location Location) ([]byte, error) {
+	block, err := b.readBlockOnTimeline(b.onTimeline(location))
+
+	// a missing or unwritten page can be the end of a timeline that was left for a new one
+	var notWritten *PageNotWrittenError
+	if (errors.Is(err, ErrSegmentMissing) || errors.As(err, &notWritten)) && b.timelines != nil && b.timelines.Refresh() {
+		block, err = b.readBlockOnTimeline(b.onTimeline(location))
+	}
+
+	return block, err
+}
+
+func (b *blockReader) readBlockOnTimeline(location Location) ([]byte, error) {
+	if b.cache == nil {
+		return b.readUncachedBlock(location)
+	}
+
+	block, err := b.cache.readPage(b.segments(), location, b.pageSize(location), b.systemID)
+	if err == nil {
+		err = (Page{block}).Validate(location, b.systemID)
+	}
 
-	file, err := os.Open(filename)
 	if err != nil {
-		panic(err)
+		// the open segment can have been recycled since it was opened, what it holds now is checked against the source
+		b.cache.forget(location.SegmentName())
+		return b.readUncachedBlock(location)
+	}
+
+	return block, nil
+}
+
+func (b *blockReader) pageSize(location Location) uint32 {
+	if location.PageSize() != 0 {
+		return location.PageSize()
+	}
+
+	return b.blockSize
+}
+
+func (b *blockReader) readUncachedBlock(location Location) ([]byte, error) {
+	filename := location.Filename()
+
+	file, err := b.segments().OpenSegment(location.SegmentName())
+	if os.IsNotExist(err) {
+		return nil, &SegmentMissingError{location.SegmentName(), err}
+	} else if err != nil {
+		return nil, err
 	}
 
 	pageOffset := int64(location.StartOfPage().FromStartOfFile())
 
-	block := make([]byte, b.blockSize)
+	blockSize := b.pageSize(location)
+	block := make([]byte, blockSize)
 
 	count, err := file.ReadAt(block, pageOffset)
 	file.Close()
 
 	if err != nil {
-		panic(fmt.Errorf("failed to read block at 0x%.8X from %q: %v", pageOffset, filename, err))
-	} else if int64(count) < int64(b.blockSize) {
-		panic(fmt.Errorf("failed to read full block from %q: only read %v bytes", filename, count))
+		return nil, fmt.Errorf("failed to read block at 0x%.8X from %q: %v", pageOffset, filename, err)
+	} else if int64(count) < int64(blockSize) {
+		return nil, fmt.Errorf("failed to read full block from %q: only read %v bytes", filename, count)
+	}
+
+	if err := (Page{block}).Validate(location, b.systemID); err != nil {
+		return nil, err
 	}
 
-	return block
+	return block, nil
 }
@@ -3,3 +3,39 @@ package wal
 // Copyright 2015 MediaMath <http://www.mediamath.com>.  All rights reserved.
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadBlockValidatesPage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blockreader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	location := NewLocationWithDefaults(0x0000000013002010)
+	segment := make([]byte, 0x4000)
+	copy(segment[0x2000:], pageExpectations[1].bs)
+	if err := ioutil.WriteFile(filepath.Join(dir, location.Filename()), segment, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	reader := blockReader{walDirPath: dir, blockSize: 0x2000, wordSize: 8, systemID: 0x55085653550bf6f3}
+	if block, err := reader.readBlock(location); err != nil || block[0] != 0x66 {
+		t.Errorf("expected written page but got %v", err)
+	}
+
+	if _, err := reader.readBlock(location.Subtract(0x2000)); !errors.As(err, new(*PageNotWrittenError)) {
+		t.Errorf("expected zeroed page to not be written but got %v", err)
+	}
+
+	if _, err := reader.readBlock(location.StartOfNextFile()); !errors.Is(err, ErrSegmentMissing) || !os.IsNotExist(errors.Unwrap(err)) {
+		t.Errorf("expected segment to be missing but got %v", err)
+	}
+}
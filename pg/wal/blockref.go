@@ -0,0 +1,219 @@
+package wal
+
+// Copyright 2015 MediaMath <http://www.mediamath.com>.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+import (
+	"fmt"
+
+	"github.com/MediaMath/keryxlib/pg"
+)
+
+// These constants are the special block ids and flags found in the block headers of a 9.5+ record
+const (
+	blockIDMaxBlock  = 32
+	blockIDOrigin    = 253
+	blockIDDataLong  = 254
+	blockIDDataShort = 255
+
+	blockForkMask   = 0x0F
+	blockHasImage   = 0x10
+	blockHasData    = 0x20
+	blockWillInit   = 0x40
+	blockSameRel    = 0x80
+	imageHasHole    = 0x01
+	imageCompressed = 0x02
+)
+
+// BlockReference describes one of the blocks a 9.5+ record touches
+type BlockReference struct {
+	ID           uint8
+	ForkNumber   uint8
+	Flags        uint8
+	TablespaceID uint32
+	DatabaseID   uint32
+	RelationID   uint32
+	Block        uint32
+	ImageLength  uint16
+	HoleOffset   uint16
+	HoleLength   uint16
+	ImageInfo    uint8
+	Image        []byte
+	Data         []byte
+}
+
+// HasImage indicates if a full page image of the block is included in the record
+func (b BlockReference) HasImage() bool { return b.Flags&blockHasImage > 0 }
+
+// HasData indicates if resource manager specific data for the block is included in the record
+func (b BlockReference) HasData() bool { return b.Flags&blockHasData > 0 }
+
+// WillInit indicates if replaying the record reinitializes the block
+func (b BlockReference) WillInit() bool { return b.Flags&blockWillInit > 0 }
+
+// IsImageCompressed indicates if the full page image is compressed
+func (b BlockReference) IsImageCompressed() bool { return b.ImageInfo&imageCompressed > 0 }
+
+// ImageHoleLength is the length of the hole the full page image leaves out of a page of pageSize bytes.  A compressed
+// image logs it as HoleLength, an image that is not compressed is the page without its hole.
+func (b BlockReference) ImageHoleLength(pageSize int) uint16 {
+	if b.ImageInfo&imageHasHole == 0 || b.IsImageCompressed() || int(b.ImageLength) >= pageSize {
+		return b.HoleLength
+	}
+
+	return uint16(pageSize - int(b.ImageLength))
+}
+
+func (b BlockReference) String() string {
+	return fmt.Sprintf("blkref #%v: rel %v/%v/%v fork %v blk %v", b.ID, b.TablespaceID, b.DatabaseID, b.RelationID, b.ForkNumber, b.Block)
+}
+
+// BlockRecord is the body of a 9.5+ record split into its block references and main data
+type BlockRecord struct {
+	Blocks   []BlockReference
+	MainData []byte
+	Origin   uint16
+}
+
+// Block returns the block reference with the given id if the record has one
+func (r BlockRecord) Block(id uint8) (BlockReference, bool) {
+	for _, b := range r.Blocks {
+		if b.ID == id {
+			return b, true
+		}
+	}
+
+	return BlockReference{}, false
+}
+
+// NewBlockRecord splits the body of a 9.5+ record into its block references and main data
+func NewBlockRecord(bs []byte) (*BlockRecord, error) {
+	var (
+		record      = &BlockRecord{}
+		pos         uint64
+		size        = uint64(len(bs))
+		mainLen     uint64
+		dataTotal   uint64
+		dataLengths []uint64
+	)
+
+	need := func(n uint64) error {
+		if pos+n > size {
+			return fmt.Errorf("%w: block header at %v needs %v bytes but only %v remain", ErrShortRecord, pos, n, size-pos)
+		}
+		return nil
+	}
+
+	for size-pos > dataTotal {
+		id := bs[pos]
+		pos++
+
+		switch {
+		case id == blockIDDataShort:
+			if err := need(1); err != nil {
+				return nil, err
+			}
+			mainLen = uint64(bs[pos])
+			dataTotal += mainLen
+			pos++
+
+		case id == blockIDDataLong:
+			if err := need(4); err != nil {
+				return nil, err
+			}
+			mainLen = pg.LUint(bs[pos : pos+4])
+			dataTotal += mainLen
+			pos += 4
+
+		case id == blockIDOrigin:
+			if err := need(2); err != nil {
+				return nil, err
+			}
+			record.Origin = uint16(pg.LUint(bs[pos : pos+2]))
+			pos += 2
+
+		case id <= blockIDMaxBlock:
+			if err := need(3); err != nil {
+				return nil, err
+			}
+
+			ref := BlockReference{ID: id, ForkNumber: bs[pos] & blockForkMask, Flags: bs[pos] &^ blockForkMask}
+			dataLength := uint16(pg.LUint(bs[pos+1 : pos+3]))
+			pos += 3
+
+			if ref.HasImage() {
+				if err := need(5); err != nil {
+					return nil, err
+				}
+				ref.ImageLength = uint16(pg.LUint(bs[pos : pos+2]))
+				ref.HoleOffset = uint16(pg.LUint(bs[pos+2 : pos+4]))
+				ref.ImageInfo = bs[pos+4]
+				pos += 5
+
+				if ref.ImageInfo&imageHasHole > 0 && ref.IsImageCompressed() {
+					if err := need(2); err != nil {
+						return nil, err
+					}
+					ref.HoleLength = uint16(pg.LUint(bs[pos : pos+2]))
+					pos += 2
+				}
+			}
+
+			if ref.Flags&blockSameRel > 0 {
+				if len(record.Blocks) == 0 {
+					return nil, fmt.Errorf("block %v refers to the same relation but no previous block exists", id)
+				}
+				previous := record.Blocks[len(record.Blocks)-1]
+				ref.TablespaceID, ref.DatabaseID, ref.RelationID = previous.TablespaceID, previous.DatabaseID, previous.RelationID
+			} else {
+				if err := need(12); err != nil {
+					return nil, err
+				}
+				ref.TablespaceID = uint32(pg.LUint(bs[pos : pos+4]))
+				ref.DatabaseID = uint32(pg.LUint(bs[pos+4 : pos+8]))
+				ref.RelationID = uint32(pg.LUint(bs[pos+8 : pos+12]))
+				pos += 12
+			}
+
+			if err := need(4); err != nil {
+				return nil, err
+			}
+			ref.Block = uint32(pg.LUint(bs[pos : pos+4]))
+			pos += 4
+
+			dataTotal += uint64(dataLength) + uint64(ref.ImageLength)
+			dataLengths = append(dataLengths, uint64(dataLength))
+			record.Blocks = append(record.Blocks, ref)
+
+		default:
+			return nil, fmt.Errorf("invalid block id %v at %v", id, pos-1)
+		}
+	}
+
+	for i := range record.Blocks {
+		ref := &record.Blocks[i]
+
+		if ref.HasImage() {
+			if err := need(uint64(ref.ImageLength)); err != nil {
+				return nil, err
+			}
+			ref.Image = bs[pos : pos+uint64(ref.ImageLength)]
+			pos += uint64(ref.ImageLength)
+		}
+
+		dataLength := dataLengths[i]
+		if err := need(dataLength); err != nil {
+			return nil, err
+		}
+		ref.Data = bs[pos : pos+dataLength]
+		pos += dataLength
+	}
+
+	if err := need(mainLen); err != nil {
+		return nil, err
+	}
+	record.MainData = bs[pos : pos+mainLen]
+
+	return record, nil
+}
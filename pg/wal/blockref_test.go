@@ -0,0 +1,52 @@
+package wal
+
+// Copyright 2015 MediaMath <http://www.mediamath.com>.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+import "testing"
+
+func TestBlockRecordWithImageAndData(t *testing.T) {
+	bs := []byte{
+		0x00, 0x30, 0x02, 0x00, 0x04, 0x00, 0x10, 0x00, 0x03, 0x02, 0x00, 0x7f, 0x06, 0x00, 0x00, 0x00,
+		0x40, 0x00, 0x00, 0x03, 0x40, 0x00, 0x00, 0x0d, 0x00, 0x00, 0x00, 0x01, 0x80, 0x00, 0x00, 0x0e,
+		0x00, 0x00, 0x00, 0xff, 0x03, 0xaa, 0xbb, 0xcc, 0xdd, 0x11, 0x22, 0x1b, 0x00, 0x00}
+
+	record, err := NewBlockRecord(bs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(record.Blocks) != 2 {
+		t.Fatalf("expected 2 blocks but got %v", len(record.Blocks))
+	}
+
+	first := record.Blocks[0]
+	if !first.HasImage() || !first.HasData() || !first.IsImageCompressed() {
+		t.Errorf("expected image and data flags on %v", first)
+	}
+	if first.ImageLength != 4 || first.HoleOffset != 16 || first.HoleLength != 2 {
+		t.Errorf("unexpected image header %v/%v/%v", first.ImageLength, first.HoleOffset, first.HoleLength)
+	}
+	if first.RelationID != 16387 || first.Block != 13 {
+		t.Errorf("unexpected block reference %v", first)
+	}
+	if !continuationsMatch(first.Image, []byte{0xaa, 0xbb, 0xcc, 0xdd}) || !continuationsMatch(first.Data, []byte{0x11, 0x22}) {
+		t.Errorf("unexpected image %v or data %v", first.Image, first.Data)
+	}
+
+	second := record.Blocks[1]
+	if second.RelationID != 16387 || second.DatabaseID != 16384 || second.Block != 14 {
+		t.Errorf("same rel block did not inherit relation: %v", second)
+	}
+
+	if !continuationsMatch(record.MainData, []byte{0x1b, 0x00, 0x00}) {
+		t.Errorf("unexpected main data %v", record.MainData)
+	}
+}
+
+func TestBlockRecordTooShort(t *testing.T) {
+	if _, err := NewBlockRecord([]byte{0x00, 0x00, 0x00, 0x00, 0x7f, 0x06}); err == nil {
+		t.Error("expected error for truncated block header")
+	}
+}
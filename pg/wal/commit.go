@@ -0,0 +1,255 @@
+package wal
+
+// Copyright 2015 MediaMath <http://www.mediamath.com>.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/MediaMath/keryxlib/pg"
+)
+
+// These constants are the sizes of the fixed portion of commit and abort records, before 9.5 and of the compact commit
+// 9.2 to 9.4 log when a transaction drops no relations and sends no invalidations
+const (
+	sizeOfXactCommit91      = 32
+	sizeOfXactAbort91       = 16
+	sizeOfXactCommitCompact = 12
+	sizeOfXactTime          = 8
+	sizeOfInvalidation      = 16
+)
+
+// These constants are the flags of the info of a 9.5+ commit or abort record and of the xinfo that follows its time,
+// which mark the parts of the record that are there
+const (
+	xactHasInfo              = 0x80
+	xactInfoHasDbInfo        = 0x01
+	xactInfoHasSubxacts      = 0x02
+	xactInfoHasRelFileNode   = 0x04
+	xactInfoHasInvalidations = 0x08
+)
+
+// sharedInvalRelcacheID is the id of the shared invalidation messages that tell backends to forget what they cache of
+// a relation
+const sharedInvalRelcacheID = -2
+
+// These constants are the info of the records of the transaction resource manager that CommitData reads
+const (
+	xactAbort         = 0x20
+	xactCompactCommit = 0x60
+)
+
+// CommitData is what a commit or abort record logs about the transaction it ends
+type CommitData struct {
+	Time                 time.Time
+	Subtransactions      []uint32
+	DroppedRelations     []RelFileNode
+	Invalidations        int
+	InvalidatedRelations []RelationInvalidation
+}
+
+// RelationInvalidation is an invalidation a commit sends when its transaction changed the definition of a relation, like
+// adding or dropping a column.  A RelationOID of 0 is every relation of the database.
+type RelationInvalidation struct {
+	DatabaseID  uint32
+	RelationOID uint32
+}
+
+// NewCommitData reads the data of a commit or abort record, it fails with ErrShortRecord when the data is too short for
+// what it says it holds
+func NewCommitData(info uint8, data []byte, version uint16) (*CommitData, error) {
+	if HasBlockReferences(version) {
+		record, err := NewBlockRecord(data)
+		if err != nil {
+			return nil, err
+		}
+		return newCommitData(info, record.MainData)
+	}
+
+	switch {
+	case info&0x70 == xactAbort:
+		return newAbortData91(data)
+	case version == Magic94 && info&0x70 == xactCompactCommit:
+		return newCompactCommitData(data)
+	}
+
+	return newCommitData91(data)
+}
+
+// newCommitData91 reads a 9.1 or 9.4 commit, whose counts follow the time and whose relfilenodes, subtransactions and
+// invalidations follow the counts
+func newCommitData91(data []byte) (*CommitData, error) {
+	if len(data) < sizeOfXactCommit91 {
+		return nil, shortRecordError("commit", sizeOfXactCommit91, len(data))
+	}
+
+	commit := &CommitData{Time: xactTime(data)}
+
+	relations, pos, err := readRelFileNodes(data, 12, sizeOfXactCommit91)
+	if err != nil {
+		return nil, err
+	}
+	commit.DroppedRelations = relations
+
+	if commit.Subtransactions, pos, err = readXids(data, 16, pos); err != nil {
+		return nil, err
+	}
+
+	if commit.Invalidations, commit.InvalidatedRelations, err = readInvalidations(data, 20, pos); err != nil {
+		return nil, err
+	}
+
+	return commit, nil
+}
+
+// newCompactCommitData reads a 9.4 compact commit, which only logs its time and subtransactions
+func newCompactCommitData(data []byte) (*CommitData, error) {
+	if len(data) < sizeOfXactCommitCompact {
+		return nil, shortRecordError("compact commit", sizeOfXactCommitCompact, len(data))
+	}
+
+	subxacts, _, err := readXids(data, 8, sizeOfXactCommitCompact)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CommitData{Time: xactTime(data), Subtransactions: subxacts}, nil
+}
+
+// newAbortData91 reads a 9.1 or 9.4 abort, whose relfilenodes come before its subtransactions
+func newAbortData91(data []byte) (*CommitData, error) {
+	if len(data) < sizeOfXactAbort91 {
+		return nil, shortRecordError("abort", sizeOfXactAbort91, len(data))
+	}
+
+	abort := &CommitData{Time: xactTime(data)}
+
+	relations, pos, err := readRelFileNodes(data, 8, sizeOfXactAbort91)
+	if err != nil {
+		return nil, err
+	}
+	abort.DroppedRelations = relations
+
+	if abort.Subtransactions, _, err = readXids(data, 12, pos); err != nil {
+		return nil, err
+	}
+
+	return abort, nil
+}
+
+// newCommitData reads the main data of a 9.5+ commit or abort record, where each part the xinfo flags follows the one
+// before it and starts with its count
+func newCommitData(info uint8, main []byte) (*CommitData, error) {
+	if len(main) < sizeOfXactTime {
+		return nil, shortRecordError("commit", sizeOfXactTime, len(main))
+	}
+
+	commit := &CommitData{Time: xactTime(main)}
+	if info&xactHasInfo == 0 {
+		return commit, nil
+	}
+
+	pos := sizeOfXactTime
+	if len(main) < pos+4 {
+		return nil, shortRecordError("commit xinfo", pos+4, len(main))
+	}
+	xinfo := uint32(pg.LUint(main[pos : pos+4]))
+	pos += 4
+
+	if xinfo&xactInfoHasDbInfo > 0 {
+		pos += 8
+	}
+
+	var err error
+	if xinfo&xactInfoHasSubxacts > 0 {
+		if commit.Subtransactions, pos, err = readXids(main, pos, pos+4); err != nil {
+			return nil, err
+		}
+	}
+
+	if xinfo&xactInfoHasRelFileNode > 0 {
+		if commit.DroppedRelations, pos, err = readRelFileNodes(main, pos, pos+4); err != nil {
+			return nil, err
+		}
+	}
+
+	if xinfo&xactInfoHasInvalidations > 0 {
+		if commit.Invalidations, commit.InvalidatedRelations, err = readInvalidations(main, pos, pos+4); err != nil {
+			return nil, err
+		}
+	}
+
+	return commit, nil
+}
+
+// xactTime reads the time a transaction ended, which starts every commit and abort record
+func xactTime(bs []byte) time.Time {
+	micros := int64(pg.LUint(bs[0:sizeOfXactTime]))
+	return postgresEpoch.Add(time.Duration(micros) * time.Microsecond)
+}
+
+// readCount reads a count of items of size bytes at countAt whose items start at start, and returns where they end
+func readCount(bs []byte, what string, countAt, start, size int) (int, int, error) {
+	if len(bs) < countAt+4 || len(bs) < start {
+		return 0, 0, shortRecordError(what, start, len(bs))
+	}
+
+	count := int(int32(pg.LUint(bs[countAt : countAt+4])))
+	end := start + count*size
+	if count < 0 || end > len(bs) {
+		return 0, 0, fmt.Errorf("%w: %v %v need %v bytes but have %v", ErrShortRecord, count, what, end, len(bs))
+	}
+
+	return count, end, nil
+}
+
+// readRelFileNodes reads the relfilenodes at start whose count is at countAt, and returns where they end
+func readRelFileNodes(bs []byte, countAt, start int) ([]RelFileNode, int, error) {
+	_, end, err := readCount(bs, "relations", countAt, start, sizeOfRelFileNode)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var relations []RelFileNode
+	for pos := start; pos < end; pos += sizeOfRelFileNode {
+		relations = append(relations, newRelFileNode(bs[pos:pos+sizeOfRelFileNode]))
+	}
+
+	return relations, end, nil
+}
+
+// readXids reads the transaction ids at start whose count is at countAt, and returns where they end
+func readXids(bs []byte, countAt, start int) ([]uint32, int, error) {
+	_, end, err := readCount(bs, "subtransactions", countAt, start, 4)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var xids []uint32
+	for pos := start; pos < end; pos += 4 {
+		xids = append(xids, uint32(pg.LUint(bs[pos:pos+4])))
+	}
+
+	return xids, end, nil
+}
+
+// readInvalidations counts the shared invalidation messages at start whose count is at countAt, and returns the
+// relations they invalidate
+func readInvalidations(bs []byte, countAt, start int) (int, []RelationInvalidation, error) {
+	count, end, err := readCount(bs, "invalidations", countAt, start, sizeOfInvalidation)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	// a relcache message is its id followed by the database and relation oids aligned to 4 bytes
+	var relations []RelationInvalidation
+	for pos := start; pos < end; pos += sizeOfInvalidation {
+		if int8(bs[pos]) == sharedInvalRelcacheID {
+			relations = append(relations, RelationInvalidation{uint32(pg.LUint(bs[pos+4 : pos+8])), uint32(pg.LUint(bs[pos+8 : pos+12]))})
+		}
+	}
+
+	return count, relations, nil
+}
@@ -0,0 +1,140 @@
+package wal
+
+// Copyright 2015 MediaMath <http://www.mediamath.com>.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestCommitDataDroppedRelations(t *testing.T) {
+	// the time, xinfo with dbinfo, subxacts and relfilenodes, the dbinfo, 2 subxacts and 1 relfilenode
+	main := []byte{
+		0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x07, 0x00, 0x00, 0x00, 0x00, 0x40, 0x00, 0x00,
+		0x7f, 0x06, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00, 0xe9, 0x03, 0x00, 0x00, 0xea, 0x03, 0x00, 0x00,
+		0x01, 0x00, 0x00, 0x00, 0x7f, 0x06, 0x00, 0x00, 0x00, 0x40, 0x00, 0x00, 0x03, 0x40, 0x00, 0x00}
+	data := append([]byte{0xff, byte(len(main))}, main...)
+
+	commit, err := NewCommitData(xactHasInfo, data, Magic96)
+	if err != nil || len(commit.DroppedRelations) != 1 || commit.DroppedRelations[0] != (RelFileNode{1663, 16384, 16387}) {
+		t.Errorf("expected 1663/16384/16387 to be dropped but got %v: %v", commit, err)
+	}
+
+	if commit, err := NewCommitData(0, data, Magic96); err != nil || len(commit.DroppedRelations) != 0 {
+		t.Errorf("expected a commit without xinfo to drop nothing but got %v: %v", commit, err)
+	}
+
+	short := append([]byte{0xff, byte(len(main) - 4)}, main[:len(main)-4]...)
+	if _, err := NewCommitData(xactHasInfo, short, Magic96); !errors.Is(err, ErrShortRecord) {
+		t.Errorf("expected a commit missing part of a relfilenode to be a short record but got %v", err)
+	}
+}
+
+func TestCommitData94(t *testing.T) {
+	// the time, xinfo, 1 relation, no subxacts or messages, the database, the tablespace and the relation
+	data := []byte{
+		0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x40, 0x00, 0x00, 0x7f, 0x06, 0x00, 0x00,
+		0x7f, 0x06, 0x00, 0x00, 0x00, 0x40, 0x00, 0x00, 0x03, 0x40, 0x00, 0x00}
+
+	for _, version := range []uint16{Magic91, Magic94} {
+		commit, err := NewCommitData(0, data, version)
+		if err != nil || len(commit.DroppedRelations) != 1 || commit.DroppedRelations[0].String() != "1663/16384/16387" {
+			t.Errorf("%.4X: expected 1663/16384/16387 to be dropped but got %v: %v", version, commit, err)
+		}
+
+		if _, err := NewCommitData(0, data[:40], version); !errors.Is(err, ErrShortRecord) {
+			t.Errorf("%.4X: expected a commit missing part of a relfilenode to be a short record but got %v", version, err)
+		}
+	}
+
+	// a compact commit drops nothing
+	if commit, err := NewCommitData(xactCompactCommit, data[:12], Magic94); err != nil || len(commit.DroppedRelations) != 0 {
+		t.Errorf("expected a compact commit to drop nothing but got %v: %v", commit, err)
+	}
+}
+
+func TestCommitDataTimeSubtransactionsAndInvalidations(t *testing.T) {
+	committed := time.Date(2015, time.June, 1, 12, 0, 0, 0, time.UTC)
+	micros := make([]byte, 8)
+	binary.LittleEndian.PutUint64(micros, uint64(committed.Sub(postgresEpoch)/time.Microsecond))
+
+	words := func(values ...uint32) []byte {
+		bs := make([]byte, 4*len(values))
+		for i, value := range values {
+			binary.LittleEndian.PutUint32(bs[4*i:], value)
+		}
+		return bs
+	}
+	concat := func(parts ...[]byte) []byte {
+		var bs []byte
+		for _, part := range parts {
+			bs = append(bs, part...)
+		}
+		return bs
+	}
+	// a catalog cache message and a relcache message for relation 16385 of database 16384
+	invalidations := concat(bytes.Repeat([]byte{0xee}, sizeOfInvalidation), []byte{0xfe, 0, 0, 0}, words(16384, 16385, 0))
+	relcache := []RelationInvalidation{{16384, 16385}}
+
+	// xinfo with subxacts and invalidations, 2 subxacts and 2 invalidations
+	main := concat(micros, words(xactInfoHasSubxacts|xactInfoHasInvalidations, 2, 1001, 1002, 2), invalidations)
+	block := append([]byte{0xff, byte(len(main))}, main...)
+
+	// 9.4 abort with no relations and 1 subxact
+	abortMain := concat(micros, words(0, 1, 1003))
+	abortBlock := append([]byte{0xff, byte(len(abortMain))}, abortMain...)
+
+	cases := []struct {
+		name          string
+		info          uint8
+		data          []byte
+		version       uint16
+		subxacts      []uint32
+		invalidations int
+		relations     []RelationInvalidation
+	}{
+		{"commit", xactHasInfo, block, Magic96, []uint32{1001, 1002}, 2, relcache},
+		{"commit without xinfo", 0, block, Magic96, nil, 0, nil},
+		{"abort", xactAbort, abortBlock, Magic96, nil, 0, nil},
+		{"9.4 commit", 0, concat(micros, words(0, 0, 2, 2, 1663, 16384, 1001, 1002), invalidations), Magic94, []uint32{1001, 1002}, 2, relcache},
+		{"9.1 commit", 0, concat(micros, words(0, 0, 1, 0, 1663, 16384, 1001)), Magic91, []uint32{1001}, 0, nil},
+		{"compact commit", xactCompactCommit, concat(micros, words(2, 1001, 1002)), Magic94, []uint32{1001, 1002}, 0, nil},
+		{"9.4 abort", xactAbort, abortMain, Magic94, []uint32{1003}, 0, nil},
+	}
+
+	for _, c := range cases {
+		commit, err := NewCommitData(c.info, c.data, c.version)
+		if err != nil {
+			t.Errorf("%v: %v", c.name, err)
+			continue
+		}
+
+		if !commit.Time.Equal(committed) {
+			t.Errorf("%v: expected the time to be %v but got %v", c.name, committed, commit.Time)
+		}
+
+		if fmt.Sprint(commit.Subtransactions) != fmt.Sprint(c.subxacts) || commit.Invalidations != c.invalidations {
+			t.Errorf("%v: expected %v and %v invalidations but got %v and %v", c.name, c.subxacts, c.invalidations, commit.Subtransactions, commit.Invalidations)
+		}
+
+		if fmt.Sprint(commit.InvalidatedRelations) != fmt.Sprint(c.relations) {
+			t.Errorf("%v: expected relations %v to be invalidated but got %v", c.name, c.relations, commit.InvalidatedRelations)
+		}
+	}
+
+	// a 9.4 commit that counts more subxacts than it holds is short, as is a compact commit without its count
+	if _, err := NewCommitData(0, concat(micros, words(0, 0, 3, 0, 1663, 16384, 1001)), Magic94); !errors.Is(err, ErrShortRecord) {
+		t.Errorf("expected a commit missing subtransactions to be a short record but got %v", err)
+	}
+
+	if _, err := NewCommitData(xactCompactCommit, micros, Magic94); !errors.Is(err, ErrShortRecord) {
+		t.Errorf("expected a compact commit without its count to be a short record but got %v", err)
+	}
+}
@@ -0,0 +1,67 @@
+package wal
+
+// Copyright 2015 MediaMath <http://www.mediamath.com>.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+import (
+	"fmt"
+	"hash/crc32"
+)
+
+var castagnoliTable = crc32.MakeTable(crc32.Castagnoli)
+
+// CorruptRecordError is returned when the crc stored in a record does not match the crc of its contents
+type CorruptRecordError struct {
+	Location Location
+	Expected uint32
+	Actual   uint32
+	next     Location
+}
+
+func (e *CorruptRecordError) Error() string {
+	return fmt.Sprintf("corrupt record at %v: expected crc %.8X but computed %.8X", e.Location, e.Expected, e.Actual)
+}
+
+// RecordCrc computes the crc of a record the way the release that wrote it does.  Before 9.5 this is the legacy
+// variant of CRC-32 postgres used, from 9.5 on it is CRC-32C.  Both cover the body first and the header after it.
+func RecordCrc(header *RecordHeader, body []byte) uint32 {
+	switch header.version {
+	case Magic91:
+		padding := make([]byte, header.AlignedSize()-header.Size())
+		crc := legacyCrc32(0xFFFFFFFF, body)
+		crc = legacyCrc32(crc, header.bs[4:])
+		return legacyCrc32(crc, padding) ^ 0xFFFFFFFF
+	case Magic94:
+		crc := legacyCrc32(0xFFFFFFFF, body)
+		return legacyCrc32(crc, header.bs[0:24]) ^ 0xFFFFFFFF
+	case Magic95, Magic96, Magic10:
+		crc := crc32.Update(0, castagnoliTable, body)
+		return crc32.Update(crc, castagnoliTable, header.bs[0:20])
+	}
+
+	return 0
+}
+
+// legacyCrc32 accumulates bytes into a crc the way postgres did up to 9.4, indexing the CRC-32 lookup table with
+// the high byte of the crc instead of the low byte.
+func legacyCrc32(crc uint32, bs []byte) uint32 {
+	for _, b := range bs {
+		crc = crc32.IEEETable[byte(crc>>24)^b] ^ (crc << 8)
+	}
+
+	return crc
+}
+
+func verifyRecordCrc(header *RecordHeader, body *RecordBody) *CorruptRecordError {
+	bs := body.bs
+	if body.whatsNeeded < uint64(len(bs)) {
+		bs = bs[:body.whatsNeeded]
+	}
+
+	if actual := RecordCrc(header, bs); actual != header.Crc() {
+		return &CorruptRecordError{Location: header.readFrom, Expected: header.Crc(), Actual: actual}
+	}
+
+	return nil
+}
@@ -0,0 +1,61 @@
+package wal
+
+// Copyright 2015 MediaMath <http://www.mediamath.com>.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"testing"
+)
+
+func TestRecordCrcIsCastagnoliFrom95(t *testing.T) {
+	header := &RecordHeader{bs: make([]byte, 24), version: Magic95}
+	copy(header.bs, []byte{0x2a, 0x00, 0x00, 0x00, 0xce, 0x07, 0x00, 0x00, 0x48, 0xec, 0x8c, 0x03, 0x00, 0x00, 0x00, 0x00, 0x00, 0x0a})
+	body := []byte{0xff, 0x03, 0x01, 0x02, 0x03, 0x04}
+
+	expected := crc32.Checksum(append(append([]byte{}, body...), header.bs[0:20]...), castagnoliTable)
+	if actual := RecordCrc(header, body); actual != expected {
+		t.Errorf("expected %.8X but got %.8X", expected, actual)
+	}
+}
+
+func TestLegacyCrcDiffersFromCrc32(t *testing.T) {
+	bs := []byte("123456789")
+	if legacy, standard := legacyCrc32(0xFFFFFFFF, bs)^0xFFFFFFFF, crc32.ChecksumIEEE(bs); legacy == standard {
+		t.Errorf("expected legacy crc to differ from crc-32 but both are %.8X", legacy)
+	}
+}
+
+func TestVerifyRecordCrc(t *testing.T) {
+	for _, version := range []uint16{Magic91, Magic94, Magic95} {
+		header := &RecordHeader{readFrom: NewLocationWithDefaults(0x038cec90), version: version}
+		header.bs = make([]byte, header.Size())
+		body := &RecordBody{bs: []byte{0x01, 0x02, 0x03, 0x04, 0xde, 0xad}, whatsNeeded: 4}
+
+		crc := RecordCrc(header, body.bs[:4])
+		switch version {
+		case Magic91:
+			binary.LittleEndian.PutUint32(header.bs[0:4], crc)
+		case Magic94:
+			binary.LittleEndian.PutUint32(header.bs[24:28], crc)
+		default:
+			binary.LittleEndian.PutUint32(header.bs[20:24], crc)
+		}
+
+		if corrupt := verifyRecordCrc(header, body); corrupt != nil {
+			t.Errorf("%X: expected matching crc but got %v", version, corrupt)
+		}
+
+		body.bs[2] = 0xff
+		corrupt := verifyRecordCrc(header, body)
+		if corrupt == nil {
+			t.Fatalf("%X: expected changed body to fail crc check", version)
+		}
+
+		if corrupt.Location != header.readFrom || corrupt.Expected != crc || corrupt.Actual == crc {
+			t.Errorf("%X: corrupt record error not filled in: %+v", version, corrupt)
+		}
+	}
+}
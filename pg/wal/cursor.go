@@ -5,67 +5,261 @@ package wal
 // license that can be found in the LICENSE file.
 
 import (
+	"errors"
 	"fmt"
 
+	"github.com/MediaMath/keryxlib/pg"
 	"github.com/MediaMath/keryxlib/pg/control"
 )
 
 // NewCursorAtCheckpoint creates a new cursor pointing at the current checkpoint
-func NewCursorAtCheckpoint(path string) (cursor *Cursor, err error) {
+func NewCursorAtCheckpoint(path string, archiveDirs ...string) (cursor *Cursor, err error) {
 	control, err := control.NewControlFromDataDir(path)
 	if err == nil {
-		blockReader := blockReader{path, control.XlogBlcksz, control.MaxAlign}
-		checkPointLocation := LocationFromUint32s(control.CheckPointLogID, control.CheckPointRecordOffset)
-
-		cursor = &Cursor{checkPointLocation, blockReader}
+		cursor, err = newCursorFromControl(path, control, uint64(control.CheckPointLogID)<<32+uint64(control.CheckPointRecordOffset), archiveDirs)
 	}
 
 	return
 }
 
 // NewCursorAtPrevCheckpoint creates a new cursor pointing at the current checkpoint
-func NewCursorAtPrevCheckpoint(path string) (cursor *Cursor, err error) {
+func NewCursorAtPrevCheckpoint(path string, archiveDirs ...string) (cursor *Cursor, err error) {
 	control, err := control.NewControlFromDataDir(path)
 	if err == nil {
-		blockReader := blockReader{path, control.XlogBlcksz, control.MaxAlign}
-		checkPointLocation := LocationFromUint32s(control.PrevCheckPointLogID, control.PrevCheckPointRecordOffset)
-
-		cursor = &Cursor{checkPointLocation, blockReader}
+		cursor, err = newCursorFromControl(path, control, uint64(control.PrevCheckPointLogID)<<32+uint64(control.PrevCheckPointRecordOffset), archiveDirs)
 	}
 
 	return
 }
 
+// NewCursorAtRedoBefore creates a new cursor pointing at the latest of the current checkpoint's redo point, the current
+// checkpoint and the previous checkpoint that is at or before offset.  When all of them are after offset the cursor
+// points at the earliest of them.
+func NewCursorAtRedoBefore(path string, offset uint64, archiveDirs ...string) (cursor *Cursor, err error) {
+	control, err := control.NewControlFromDataDir(path)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := []uint64{
+		uint64(control.PrevCheckPointLogID)<<32 + uint64(control.PrevCheckPointRecordOffset),
+		uint64(control.CheckPointLogID)<<32 + uint64(control.CheckPointRecordOffset),
+		uint64(control.CheckPointCopy.RedoLogID)<<32 + uint64(control.CheckPointCopy.RedoRecordOffset),
+	}
+
+	startAt := candidates[0]
+	for _, candidate := range candidates {
+		if candidate < startAt {
+			startAt = candidate
+		}
+	}
+
+	for _, candidate := range candidates {
+		if candidate <= offset && candidate > startAt {
+			startAt = candidate
+		}
+	}
+
+	return newCursorFromControl(path, control, startAt, archiveDirs)
+}
+
+// NewCursorAtOrAfter creates a new cursor pointing at the first record that starts at or after offset, which does not
+// need to be the start of a record
+func NewCursorAtOrAfter(path string, offset uint64, archiveDirs ...string) (*Cursor, error) {
+	control, err := control.NewControlFromDataDir(path)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := newCursorFromControl(path, control, offset, archiveDirs)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.firstRecordAtOrAfter(offset)
+}
+
+// NewCursorAtOldestSegment creates a new cursor pointing at the first record that starts in the oldest segment it can
+// read
+func NewCursorAtOldestSegment(path string, archiveDirs ...string) (*Cursor, error) {
+	control, err := control.NewControlFromDataDir(path)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := newCursorFromControl(path, control, uint64(control.CheckPointLogID)<<32+uint64(control.CheckPointRecordOffset), archiveDirs)
+	if err != nil {
+		return nil, err
+	}
+
+	oldest, _, ok, err := c.SegmentBounds()
+	if err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, fmt.Errorf("there are no WAL segments in %v", c.reader.walDirPath)
+	}
+
+	return c.MoveTo(oldest).firstRecordAtOrAfter(oldest.Offset())
+}
+
+// NewCursorAt creates a new cursor pointing at the first record that starts at or after location reading segments from
+// source, without pg_control.  The segment size, page size, system identifier and release come from the header of the
+// segment holding location, the timeline and alignment come from location.
+func NewCursorAt(source SegmentSource, location Location) (*Cursor, error) {
+	if location.WordSize() == 0 {
+		location = location.WithGeometry(0, 0, 8)
+	}
+
+	c := Cursor{location, blockReader{blockSize: location.PageSize(), wordSize: location.WordSize(), source: source, cache: newDefaultBlockCache()}}
+
+	// the segment size is needed to find the start of the segment and is only known once it is read from there
+	for attempt := 0; ; attempt++ {
+		header, err := c.segmentHeader()
+		if err != nil {
+			return nil, err
+		}
+		c.location = c.location.SkippingLastSegment(SkipsLastSegment(header.Magic()))
+
+		if header.SegmentSize() == c.location.FileSize() && header.BlockSize() == c.location.PageSize() {
+			c.reader.blockSize, c.reader.systemID = header.BlockSize(), header.SystemID()
+			break
+		}
+
+		if attempt > 0 || header.BlockSize() == 0 || header.SegmentSize()%header.BlockSize() != 0 {
+			return nil, fmt.Errorf("segment %v has invalid segment size %v and page size %v", c.location.Filename(), header.SegmentSize(), header.BlockSize())
+		}
+
+		c.location = c.location.WithGeometry(header.SegmentSize(), header.BlockSize(), 0)
+	}
+
+	return c.firstRecordAtOrAfter(location.Offset())
+}
+
+func newCursorFromControl(path string, control *control.Control, offset uint64, archiveDirs []string) (*Cursor, error) {
+	walDirPath := pg.WalDirectory(path, control.Version)
+	location := NewLocationFromControl(offset, control)
+
+	timelines, err := NewTimelines(walDirPath, location.TimelineID(), location.FileSize())
+	if err != nil {
+		return nil, err
+	}
+
+	reader := blockReader{walDirPath, control.XlogBlcksz, control.MaxAlign, control.SystemIdentifier, timelines, newSegmentSource(walDirPath, archiveDirs), newDefaultBlockCache()}
+	return &Cursor{reader.onTimeline(location), reader}, nil
+}
+
 // Cursor models a position in the WAL of a PostgreSQL system
 type Cursor struct {
 	location Location
 	reader   blockReader
 }
 
+// Location is where the cursor points in the WAL
+func (c Cursor) Location() Location {
+	return c.location
+}
+
 func (c Cursor) String() string {
 	return fmt.Sprintf("%.8X%.16X", c.location.timelineID, c.location.Offset())
 }
 
-// MoveTo sets the cursor to point at the specified location in the WAL even if its invalid
+// MoveTo sets the cursor to point at the specified location in the WAL even if its invalid, on the timeline holding it
 func (c Cursor) MoveTo(location Location) Cursor {
-	return Cursor{location, c.reader}
+	return Cursor{c.reader.onTimeline(location), c.reader}
 }
 
-// ReadEntries will read the XLogRecord at the current location and if successful return the entries and a new cursor at the next location
+// Close closes the segments the cursor and the cursors moved from it keep open
+func (c Cursor) Close() {
+	if c.reader.cache != nil {
+		c.reader.cache.clear()
+	}
+}
+
+// ReadEntries will read the XLogRecord at the current location and if successful return the entries and a new cursor at the next location.
+// Errors are a *RecordError wrapping what went wrong reading or decoding the record.
 func (c Cursor) ReadEntries() (entries []Entry, cur Cursor, err error) {
-	defer func() {
-		if r := recover(); r != nil {
-			if e, ok := r.(error); ok {
-				err = e
-			}
+	record, cur, err := c.ReadRecord()
+	if record != nil {
+		entries = record.Entries
+	}
+
+	return
+}
+
+// Record is a record as a cursor reads it, the page it starts on, its header and body and the entries decoded from them
+type Record struct {
+	Page    Page
+	Header  *RecordHeader
+	Body    *RecordBody
+	Entries []Entry
+}
+
+// ReadRecord reads the XLogRecord at the current location the way ReadEntries does and returns all of it.  The record
+// is nil when there is none at the location yet, and its entries are nil when they are not ready to be read yet.
+func (c Cursor) ReadRecord() (record *Record, cur Cursor, err error) {
+	record, cur, err = c.readRecord()
+	if c.reader.cache == nil || (err == nil && cur.location != c.location) {
+		return
+	}
+
+	// at the end of the wal the cached pages can be older than what postgres has written since, so they are read again
+	c.reader.cache.clear()
+	var corrupt *CorruptRecordError
+	if errors.As(err, &corrupt) {
+		record, cur, err = c.readRecord()
+	}
+
+	return
+}
+
+// ReadRecords reads the records from the cursor on and passes each to read with the location it is read at, until the
+// end of the WAL or the first record at or after end when end is not zero.  It stops at the first error reading a record
+// or returned by read, and returns a cursor at the record it stopped at.
+func (c Cursor) ReadRecords(end uint64, read func(location Location, record *Record) error) (Cursor, error) {
+	for end == 0 || c.location.Offset() < end {
+		record, next, err := c.ReadRecord()
+		if err != nil {
+			return c, err
+		} else if record == nil {
+			return c, nil
+		}
+
+		if err := read(c.location, record); err != nil {
+			return c, err
 		}
-	}()
 
+		// nothing follows the last record yet, so it is read again without moving the cursor
+		if next.location == c.location {
+			return c, nil
+		}
+
+		c = next
+	}
+
+	return c, nil
+}
+
+func (c Cursor) readRecord() (record *Record, cur Cursor, err error) {
 	cur = c
-	block := cur.reader.readBlock(cur.location)
+	block, err := cur.reader.readBlock(cur.location)
+	if err != nil {
+		return nil, c, newRecordError(c.location, nil, err)
+	}
 	page := &Page{block}
 
-	recordHeader := NewRecordHeader(block, cur.location, page.Magic(), cur.reader)
+	if page.IsLong() {
+		cur = cur.MoveTo(cur.location.WithGeometry(page.SegmentSize(), page.BlockSize(), 0))
+	}
+
+	recordHeader, err := NewRecordHeader(block, cur.location, page.Magic(), cur.reader)
+	if err != nil {
+		return nil, c, newRecordError(c.location, nil, err)
+	} else if recordHeader == nil {
+		return nil, c, newRecordError(c.location, nil, fmt.Errorf("%w: its header continues on a page without a continuation", ErrIncompleteRecord))
+	} else if err := recordHeader.checkLength(); err != nil {
+		return nil, c, newRecordError(c.location, recordHeader, err)
+	}
+
 	afterRecordHeader := cur.MoveTo(recordHeader.afterHeader)
 	recordBody := NewRecordBody(recordHeader)
 
@@ -79,96 +273,256 @@ func (c Cursor) ReadEntries() (entries []Entry, cur Cursor, err error) {
 	for !recordBody.IsComplete() {
 		cur = cur.MoveTo(cur.location.StartOfNextPage())
 
-		nextBlock := cur.reader.readBlock(cur.location)
+		nextBlock, err := cur.reader.readBlock(cur.location)
+		if err != nil {
+			var notWritten *PageNotWrittenError
+			if errors.As(err, &notWritten) {
+				err = fmt.Errorf("%w: %v", ErrIncompleteRecord, err)
+			}
+			return nil, c, newRecordError(c.location, recordHeader, err)
+		}
 		nextPage := Page{nextBlock}
 
 		cur = cur.MoveTo(cur.location.Add(nextPage.HeaderLength()))
 
 		bytesRead = recordBody.AppendContinuation(nextPage)
 		if bytesRead == 0 {
-			return nil, c, nil
+			return nil, c, newRecordError(c.location, recordHeader, fmt.Errorf("%w: page at %v holds no continuation of it", ErrIncompleteRecord, cur.location.StartOfPage()))
 		}
 	}
 
-	entries = NewEntries(page, recordHeader, recordBody)
+	entries, err := NewEntries(page, recordHeader, recordBody)
 	cur = cur.MoveTo(cur.location.Add(bytesRead).Aligned())
+	corrupt := verifyRecordCrc(recordHeader, recordBody)
+
+	nextRecord, scanErr := scanForRecordWithPrevious(c, cur, recordHeader.Size())
+	if scanErr != nil {
+		return nil, c, newRecordError(c.location, recordHeader, scanErr)
+	}
 
-	nextRecord := scanForRecordWithPrevious(c, cur, recordHeader.Size())
 	if nextRecord != nil {
 		cur = *nextRecord
+
+		if corrupt != nil {
+			corrupt.next = cur.location
+			return nil, c, newRecordError(c.location, recordHeader, corrupt)
+		}
 	} else {
 		cur = c
 
-		if len(entries) > 0 {
-			entryType := entries[0].Type
-			if entryType != Commit && entryType != Abort {
-				entries = nil
-			}
+		if corrupt != nil {
+			// nothing follows the record yet so it is more likely still being written than corrupt
+			return nil, c, nil
+		}
+
+		if recordType := recordHeader.Type(); recordType != Commit && recordType != Abort {
+			entries = nil
 		}
 	}
 
-	return
+	// a record that cannot be decoded is only reported once the record after it shows it is complete
+	if err != nil {
+		return nil, c, newRecordError(c.location, recordHeader, err)
+	}
+
+	return &Record{*page, recordHeader, recordBody, entries}, cur, nil
+}
+
+// SkipCorruptRecord moves past a record that failed its crc check to the record that follows it
+func (c Cursor) SkipCorruptRecord(corrupt *CorruptRecordError) Cursor {
+	return c.MoveTo(corrupt.next)
+}
+
+// RescanFromNextPage moves to the first record that starts on a page after the current location
+func (c Cursor) RescanFromNextPage() (Cursor, error) {
+	startAt := c
+	for {
+		startAt = startAt.MoveTo(startAt.location.StartOfNextPage())
+		next, err := cursorAtFirstRecordOnPage(startAt, 0)
+		if err != nil {
+			return c, err
+		} else if next != nil {
+			return *next, nil
+		}
+	}
 }
 
-func scanForRecordWithPrevious(previous, startAt Cursor, recordHeaderSize uint64) *Cursor {
-	out := samePageScanForRecordWithPrevious(previous, startAt)
-	if out == nil {
-		out = multiPageScanForRecordWithPrevious(previous, startAt, recordHeaderSize)
+// segmentHeader reads the long header of the first page of the segment holding the cursor
+func (c Cursor) segmentHeader() (Page, error) {
+	block, err := c.reader.readBlock(c.location.StartOfFile())
+	if err != nil {
+		return Page{}, err
+	}
+
+	header := Page{block}
+	if !header.IsLong() {
+		return header, fmt.Errorf("segment %v does not start with a long page header", c.location.Filename())
+	}
+
+	return header, nil
+}
+
+// firstRecordAtOrAfter finds the first record starting at or after offset whose previous record, when it can be read,
+// is followed by it.  A record that does not chain back is a false start so the search goes on from the next page.
+func (c Cursor) firstRecordAtOrAfter(offset uint64) (*Cursor, error) {
+	for {
+		cur, err := c.seekRecordAtOrAfter(offset)
+		if err != nil {
+			return nil, err
+		}
+
+		if cur.followsPrevious() {
+			return &cur, nil
+		}
+
+		offset = cur.location.StartOfNextPage().Offset()
 	}
-	return out
 }
 
-func samePageScanForRecordWithPrevious(previous, startAt Cursor) *Cursor {
-	block := startAt.reader.readBlock(startAt.location)
+// followsPrevious checks that reading the record the cursor's record points back to leads to the cursor's record
+func (c Cursor) followsPrevious() bool {
+	block, err := c.reader.readBlock(c.location)
+	if err != nil {
+		return false
+	}
+
+	header, err := NewRecordHeader(block, c.location, Page{block}.Magic(), c.reader)
+	if err != nil || header == nil {
+		return false
+	}
+
+	previous := header.Previous()
+	if previous.Offset() == 0 {
+		return true
+	} else if previous.Offset() >= c.location.Offset() {
+		return false
+	}
+
+	_, next, err := c.MoveTo(previous).ReadEntries()
+	if errors.Is(err, ErrSegmentMissing) {
+		// the previous record was removed, which leaves nothing to check against
+		return true
+	}
+
+	return err == nil && next.location.Offset() == c.location.Offset()
+}
+
+// seekRecordAtOrAfter finds the first record on the page holding offset, or on the pages after it when a record from
+// an earlier page fills the page, and reads records from there until one starts at or after offset
+func (c Cursor) seekRecordAtOrAfter(offset uint64) (Cursor, error) {
+	startAt := c.MoveTo(c.location.At(offset))
+	first, err := cursorAtFirstRecordOnPage(startAt, 0)
+	for err == nil && first == nil {
+		startAt = startAt.MoveTo(startAt.location.StartOfNextPage())
+		first, err = cursorAtFirstRecordOnPage(startAt, 0)
+	}
+
+	if err != nil {
+		return startAt, err
+	}
+
+	cur := *first
+	for cur.location.Offset() < offset {
+		_, next, err := cur.ReadEntries()
+		if err != nil {
+			return cur, err
+		} else if next.location == cur.location {
+			return cur, fmt.Errorf("the wal ends at %v before %v", cur.location, c.location.At(offset))
+		}
+
+		cur = next
+	}
+
+	return cur, nil
+}
+
+// scanForRecordWithPrevious looks for the record following previous from startAt, it is nil when there is none yet
+func scanForRecordWithPrevious(previous, startAt Cursor, recordHeaderSize uint64) (*Cursor, error) {
+	out, err := samePageScanForRecordWithPrevious(previous, startAt)
+	if err == nil && out == nil {
+		out, err = multiPageScanForRecordWithPrevious(previous, startAt, recordHeaderSize)
+	}
+
+	// a page that is not written yet cannot hold the next record, anything else is a real failure
+	var notWritten *PageNotWrittenError
+	if errors.As(err, &notWritten) {
+		return nil, nil
+	}
+
+	return out, err
+}
+
+func samePageScanForRecordWithPrevious(previous, startAt Cursor) (*Cursor, error) {
+	block, err := startAt.reader.readBlock(startAt.location)
+	if err != nil {
+		return nil, err
+	}
 	page := &Page{block}
 
 	cur := startAt.MoveTo(startAt.location.Aligned())
 
 	for cur.location.IsOnSamePageAs(startAt.location) {
-		maybeHeader := NewRecordHeader(block, cur.location, page.Magic(), cur.reader)
-		if maybeHeader != nil && maybeHeader.Previous().Offset() == previous.location.Offset() {
-			return &cur
+		maybeHeader, err := NewRecordHeader(block, cur.location, page.Magic(), cur.reader)
+		if err != nil {
+			return nil, err
+		} else if maybeHeader != nil && maybeHeader.Previous().Offset() == previous.location.Offset() {
+			return &cur, nil
 		}
 
 		cur = cur.MoveTo(cur.location.Add(1).Aligned())
 	}
 
-	return nil
+	return nil, nil
 }
 
-func multiPageScanForRecordWithPrevious(previous, startAt Cursor, recordHeaderSize uint64) (out *Cursor) {
+func multiPageScanForRecordWithPrevious(previous, startAt Cursor, recordHeaderSize uint64) (*Cursor, error) {
 	var cur *Cursor
 	for cur == nil {
+		var err error
 		startAt = startAt.MoveTo(startAt.location.StartOfNextPage())
-		cur = cursorAtFirstRecordOnPage(startAt, recordHeaderSize)
+		if cur, err = cursorAtFirstRecordOnPage(startAt, recordHeaderSize); err != nil {
+			return nil, err
+		}
 	}
 
-	block := cur.reader.readBlock(cur.location)
+	block, err := cur.reader.readBlock(cur.location)
+	if err != nil {
+		return nil, err
+	}
 	page := &Page{block}
 
-	maybeHeader := NewRecordHeader(block, cur.location, page.Magic(), cur.reader)
-	if maybeHeader != nil && maybeHeader.Previous().Offset() == previous.location.Offset() {
-		out = cur
+	maybeHeader, err := NewRecordHeader(block, cur.location, page.Magic(), cur.reader)
+	if err != nil || maybeHeader == nil || maybeHeader.Previous().Offset() != previous.location.Offset() {
+		return nil, err
 	}
 
-	return
+	return cur, nil
 }
 
-func cursorAtFirstRecordOnPage(startAt Cursor, recordHeaderSize uint64) (out *Cursor) {
-	block := startAt.reader.readBlock(startAt.location)
+func cursorAtFirstRecordOnPage(startAt Cursor, recordHeaderSize uint64) (*Cursor, error) {
+	block, err := startAt.reader.readBlock(startAt.location)
+	if err != nil {
+		return nil, err
+	}
 	page := Page{block}
 
 	cur := startAt.MoveTo(startAt.location.StartOfPage().Add(page.HeaderLength()).Aligned())
 
 	if cont := page.Continuation(); cont != nil {
-		afterCont := cur.location.Add(uint64(len(cont) + 4)).Aligned()
-		if afterCont.IsOnSamePageAs(cur.location) && (afterCont.ToEndOfPage() >= recordHeaderSize || page.Is94()) {
+		// before 9.4 the continuation starts after the length of what remains of the record
+		contLength := uint64(len(cont))
+		if page.Is91() {
+			contLength += 4
+		}
+
+		afterCont := cur.location.Add(contLength).Aligned()
+		if afterCont.IsOnSamePageAs(cur.location) && (afterCont.ToEndOfPage() >= recordHeaderSize || page.Is94() || page.Is95()) {
 			curAfterCont := cur.MoveTo(afterCont)
-			out = &curAfterCont
+			return &curAfterCont, nil
 		}
-	} else {
-		out = &cur
+
+		return nil, nil
 	}
 
-	return
+	return &cur, nil
 }
@@ -5,6 +5,7 @@ package wal
 // license that can be found in the LICENSE file.
 
 import (
+	"errors"
 	"os"
 	"testing"
 )
@@ -54,3 +55,72 @@ func skipIfTestDataDirMissing(t *testing.T) {
 		t.Skipf("you must make the test data directory with %q", prepareTestDataDir)
 	}
 }
+
+func TestCursorAtOrAfterStartsAtARecord(t *testing.T) {
+	skipIfTestDataDirMissing(t)
+
+	prev, err := NewCursorAtPrevCheckpoint(testDataDir)
+	if err != nil {
+		t.Fatalf("error creating cursor: %v", err)
+	}
+
+	_, next, err := prev.ReadEntries()
+	if err != nil {
+		t.Fatalf("error reading checkpoint: %v", err)
+	}
+
+	cur, err := NewCursorAtOrAfter(testDataDir, prev.Location().Offset()+1)
+	if err != nil {
+		t.Fatalf("error creating cursor: %v", err)
+	}
+
+	if cur.Location().Offset() != next.Location().Offset() {
+		t.Errorf("expected cursor at the record after the checkpoint %v but got %v", next.Location(), cur.Location())
+	}
+}
+
+func TestCursorAtWithoutControl(t *testing.T) {
+	skipIfTestDataDirMissing(t)
+
+	prev, err := NewCursorAtPrevCheckpoint(testDataDir)
+	if err != nil {
+		t.Fatalf("error creating cursor: %v", err)
+	}
+
+	source, err := NewDataDirSource(testDataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cur, err := NewCursorAt(source, NewLocationWithDefaults(prev.Location().Offset()).OnTimeline(prev.Location().TimelineID()))
+	if err != nil {
+		t.Fatalf("error creating cursor: %v", err)
+	}
+
+	if cur.Location().Offset() != prev.Location().Offset() {
+		t.Errorf("expected cursor at the checkpoint %v but got %v", prev.Location(), cur.Location())
+	}
+}
+
+func TestCursorAtChecksSegmentHeader(t *testing.T) {
+	location := NewLocationWithDefaults(0x0000000013000010)
+	memory := NewMemorySource()
+
+	if _, err := NewCursorAt(memory, location); !errors.Is(err, ErrSegmentMissing) {
+		t.Errorf("expected missing segment to not exist but got %v", err)
+	}
+
+	segment := make([]byte, 0x4000)
+	copy(segment, pageExpectations[1].bs)
+	copy(segment[12:16], []byte{0x00, 0x00, 0x00, 0x13})
+	memory.Add(location.SegmentName(), segment)
+	if _, err := NewCursorAt(memory, location); err == nil {
+		t.Error("expected segment without a long header to be an error")
+	}
+
+	copy(segment, pageExpectations[0].bs)
+	copy(segment[24:28], []byte{0x00, 0x10, 0x00, 0x00})
+	if _, err := NewCursorAt(memory, location); err == nil {
+		t.Error("expected segment smaller than a page to be an error")
+	}
+}
@@ -26,15 +26,19 @@ type Entry struct {
 	ToBlock       uint32
 	ToOffset      uint16
 	ParseTime     int64
+	Tuple         TupleData
+	OldTuple      TupleData
+	CommitData    *CommitData
 }
 
-//EntryBytesSize is the size of the entries.
-const EntryBytesSize = 61
+//EntryBytesSize is the size of the entries without their tuples.
+const EntryBytesSize = 73
 
-// ToBytes converts an entry to a slice of bytes
+// ToBytes converts an entry to a slice of bytes, the length of the tuple, the tuple and the old tuple follow the fixed size fields.
+// The commit data is left out, commits and aborts are not buffered.
 func (e Entry) ToBytes() []byte {
 	timePtr := (*uint64)(unsafe.Pointer(&e.ParseTime))
-	return []byte{
+	bs := []byte{
 		byte(e.Type),
 		byte(e.ReadFrom.offset >> 56),
 		byte(e.ReadFrom.offset >> 48),
@@ -96,17 +100,56 @@ func (e Entry) ToBytes() []byte {
 		byte(*timePtr >> 16),
 		byte(*timePtr >> 8),
 		byte(*timePtr),
+		byte(e.ReadFrom.fileSize >> 24),
+		byte(e.ReadFrom.fileSize >> 16),
+		byte(e.ReadFrom.fileSize >> 8),
+		byte(e.ReadFrom.fileSize),
+		byte(e.ReadFrom.pageSize >> 24),
+		byte(e.ReadFrom.pageSize >> 16),
+		byte(e.ReadFrom.pageSize >> 8),
+		byte(e.ReadFrom.pageSize),
+		byte(e.ReadFrom.wordSize >> 24),
+		byte(e.ReadFrom.wordSize >> 16),
+		byte(e.ReadFrom.wordSize >> 8),
+		byte(e.ReadFrom.wordSize),
 	}
+
+	if len(e.Tuple) > 0 || len(e.OldTuple) > 0 {
+		tupleLen := uint32(len(e.Tuple))
+		bs = append(bs, byte(tupleLen>>24), byte(tupleLen>>16), byte(tupleLen>>8), byte(tupleLen))
+		bs = append(bs, e.Tuple...)
+		bs = append(bs, e.OldTuple...)
+	}
+
+	return bs
 }
 
 // EntryFromBytes reconstructs an entry from a slice of bytes
 func EntryFromBytes(bs []byte) Entry {
 	parseTime := uint64(bs[53])<<56 + uint64(bs[54])<<48 + uint64(bs[55])<<40 + uint64(bs[56])<<32 + uint64(bs[57])<<24 + uint64(bs[58])<<16 + uint64(bs[59])<<8 + uint64(bs[60])
 
+	geometry := NewLocationWithDefaults(0)
+	if len(bs) >= EntryBytesSize {
+		geometry = geometry.WithGeometry(
+			uint32(bs[61])<<24+uint32(bs[62])<<16+uint32(bs[63])<<8+uint32(bs[64]),
+			uint32(bs[65])<<24+uint32(bs[66])<<16+uint32(bs[67])<<8+uint32(bs[68]),
+			uint32(bs[69])<<24+uint32(bs[70])<<16+uint32(bs[71])<<8+uint32(bs[72]))
+	}
+
+	var tuple, oldTuple TupleData
+	if len(bs) >= EntryBytesSize+4 {
+		tuples := bs[EntryBytesSize+4:]
+		tupleLen := uint32(bs[73])<<24 + uint32(bs[74])<<16 + uint32(bs[75])<<8 + uint32(bs[76])
+		if int(tupleLen) <= len(tuples) {
+			tuple = append(tuple, tuples[:tupleLen]...)
+			oldTuple = append(oldTuple, tuples[tupleLen:]...)
+		}
+	}
+
 	return Entry{
 		Type:          RecordType(bs[0]),
-		ReadFrom:      NewLocationWithDefaults(uint64(bs[1])<<56 + uint64(bs[2])<<48 + uint64(bs[3])<<40 + uint64(bs[4])<<32 + uint64(bs[5])<<24 + uint64(bs[6])<<16 + uint64(bs[7])<<8 + uint64(bs[8])),
-		Previous:      NewLocationWithDefaults(uint64(bs[9])<<56 + uint64(bs[10])<<48 + uint64(bs[11])<<40 + uint64(bs[12])<<32 + uint64(bs[13])<<24 + uint64(bs[14])<<16 + uint64(bs[15])<<8 + uint64(bs[16])),
+		ReadFrom:      geometry.At(uint64(bs[1])<<56 + uint64(bs[2])<<48 + uint64(bs[3])<<40 + uint64(bs[4])<<32 + uint64(bs[5])<<24 + uint64(bs[6])<<16 + uint64(bs[7])<<8 + uint64(bs[8])),
+		Previous:      geometry.At(uint64(bs[9])<<56 + uint64(bs[10])<<48 + uint64(bs[11])<<40 + uint64(bs[12])<<32 + uint64(bs[13])<<24 + uint64(bs[14])<<16 + uint64(bs[15])<<8 + uint64(bs[16])),
 		TimelineID:    uint32(bs[17])<<24 + uint32(bs[18])<<16 + uint32(bs[19])<<8 + uint32(bs[20]),
 		LogID:         uint32(bs[21])<<24 + uint32(bs[22])<<16 + uint32(bs[23])<<8 + uint32(bs[24]),
 		TransactionID: uint32(bs[25])<<24 + uint32(bs[26])<<16 + uint32(bs[27])<<8 + uint32(bs[28]),
@@ -118,16 +161,31 @@ func EntryFromBytes(bs []byte) Entry {
 		ToBlock:       uint32(bs[47])<<24 + uint32(bs[48])<<16 + uint32(bs[49])<<8 + uint32(bs[50]),
 		ToOffset:      uint16(bs[51])<<8 + uint16(bs[52]),
 		ParseTime:     int64(parseTime),
+		Tuple:         tuple,
+		OldTuple:      oldTuple,
 	}
 }
 
 // NewEntries builds an entry from a page, record header, record body and a location
-func NewEntries(page *Page, recordHeader *RecordHeader, recordBody *RecordBody) (entries []Entry) {
+func NewEntries(page *Page, recordHeader *RecordHeader, recordBody *RecordBody) (entries []Entry, err error) {
 	var now = time.Now().UnixNano()
 
-	heapData := recordBody.HeapData()
+	heapData, err := recordBody.HeapData()
+	if err != nil {
+		return nil, err
+	}
 	if len(heapData) > 0 {
+		var backups *backupPages
 		for _, heapData := range heapData {
+			// a tuple the record leaves out because it backs up the page is read from the image of the page
+			tuple := heapData.NewTuple()
+			if tuple == nil && (recordHeader.Type() == Insert || recordHeader.Type() == Update || recordHeader.Type() == MultiInsert) {
+				if backups == nil {
+					backups = newBackupPages(recordBody)
+				}
+				tuple = backups.newTuple(heapData)
+			}
+
 			entries = append(entries, Entry{
 				Type:          recordHeader.Type(),
 				ReadFrom:      recordHeader.readFrom,
@@ -143,9 +201,34 @@ func NewEntries(page *Page, recordHeader *RecordHeader, recordBody *RecordBody)
 				ToBlock:       heapData.ToBlock(),
 				ToOffset:      heapData.ToOffset(),
 				ParseTime:     now,
+				Tuple:         tuple,
+				OldTuple:      heapData.OldTuple(),
 			})
 		}
 	} else {
+		commitData, err := recordBody.CommitData()
+		if err != nil {
+			return nil, err
+		}
+
+		// the storage a transaction drops is dropped as it commits, so its entries come before the commit
+		if commitData != nil && recordHeader.Type() == Commit {
+			for _, dropped := range commitData.DroppedRelations {
+				entries = append(entries, Entry{
+					Type:          Drop,
+					ReadFrom:      recordHeader.readFrom,
+					Previous:      recordHeader.Previous(),
+					TimelineID:    page.TimelineID(),
+					LogID:         page.Location().LogID(),
+					TransactionID: recordHeader.TransactionID(),
+					TablespaceID:  dropped.TablespaceID,
+					DatabaseID:    dropped.DatabaseID,
+					RelationID:    dropped.RelationID,
+					ParseTime:     now,
+				})
+			}
+		}
+
 		entries = append(entries, Entry{
 			Type:          recordHeader.Type(),
 			ReadFrom:      recordHeader.readFrom,
@@ -154,6 +237,7 @@ func NewEntries(page *Page, recordHeader *RecordHeader, recordBody *RecordBody)
 			LogID:         page.Location().LogID(),
 			TransactionID: recordHeader.TransactionID(),
 			ParseTime:     now,
+			CommitData:    commitData,
 		})
 	}
 
@@ -175,6 +259,15 @@ func (e Entry) String() string {
 		return fmt.Sprintf("Commit of transaction id %v read from %v/%v", e.TransactionID, e.TimelineID, e.ReadFrom)
 	case Abort:
 		return fmt.Sprintf("Abort of transaction id %v read from %v/%v", e.TransactionID, e.TimelineID, e.ReadFrom)
+	case Create:
+		return fmt.Sprintf("Create of %v/%v/%v on transaction id %v read from %v/%v",
+			e.TablespaceID, e.DatabaseID, e.RelationID, e.TransactionID, e.TimelineID, e.ReadFrom)
+	case Truncate:
+		return fmt.Sprintf("Truncate of %v/%v/%v to %v blocks on transaction id %v read from %v/%v",
+			e.TablespaceID, e.DatabaseID, e.RelationID, e.ToBlock, e.TransactionID, e.TimelineID, e.ReadFrom)
+	case Drop:
+		return fmt.Sprintf("Drop of %v/%v/%v on transaction id %v read from %v/%v",
+			e.TablespaceID, e.DatabaseID, e.RelationID, e.TransactionID, e.TimelineID, e.ReadFrom)
 	}
 
 	return fmt.Sprintf("Unknown WAL Entry read from %v/%v", e.TimelineID, e.ReadFrom)
@@ -0,0 +1,42 @@
+package wal
+
+// Copyright 2015 MediaMath <http://www.mediamath.com>.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEntryBytesRoundTripKeepsGeometry(t *testing.T) {
+	readFrom := NewLocationWithDefaults(0x000000010c123456).WithGeometry(64*1024*1024, 16*1024, 4)
+	entry := Entry{Type: Insert, ReadFrom: readFrom, Previous: readFrom.At(0x000000010c123400), TransactionID: 42, RelationID: 16387, ToBlock: 7, ToOffset: 3, ParseTime: 1234}
+
+	bs := entry.ToBytes()
+	if len(bs) != EntryBytesSize {
+		t.Fatalf("expected %v bytes but got %v", EntryBytesSize, len(bs))
+	}
+
+	act := EntryFromBytes(bs)
+	if !reflect.DeepEqual(act, entry) {
+		t.Errorf("expected %+v but got %+v", entry, act)
+	}
+}
+
+func TestEntryBytesRoundTripKeepsTuples(t *testing.T) {
+	entry := Entry{Type: Update, ReadFrom: NewLocationWithDefaults(0x000000010c123456), TransactionID: 42, Tuple: TupleData{0x01, 0x00, 0x02, 0x08, 0x18, 0x00, 0x2a, 0x00, 0x00, 0x00}, OldTuple: TupleData{0x01, 0x00, 0x00, 0x00, 0x18, 0x00, 0x2b, 0x00, 0x00, 0x00}}
+
+	bs := entry.ToBytes()
+	if len(bs) != EntryBytesSize+4+len(entry.Tuple)+len(entry.OldTuple) {
+		t.Fatalf("expected %v bytes but got %v", EntryBytesSize+4+len(entry.Tuple)+len(entry.OldTuple), len(bs))
+	}
+
+	act := EntryFromBytes(bs)
+	if !reflect.DeepEqual(act.Tuple, entry.Tuple) {
+		t.Errorf("expected tuple %v but got %v", entry.Tuple, act.Tuple)
+	}
+	if !reflect.DeepEqual(act.OldTuple, entry.OldTuple) {
+		t.Errorf("expected old tuple %v but got %v", entry.OldTuple, act.OldTuple)
+	}
+}
@@ -0,0 +1,71 @@
+package wal
+
+// Copyright 2015 MediaMath <http://www.mediamath.com>.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+import (
+	"errors"
+	"fmt"
+)
+
+// These errors are wrapped by the errors reading the WAL returns so callers can tell with errors.Is what went wrong
+var (
+	// ErrIncompleteRecord means a record continues on a page that does not hold the rest of it yet
+	ErrIncompleteRecord = errors.New("record is incomplete")
+	// ErrSegmentMissing means a segment a record is read from does not exist
+	ErrSegmentMissing = errors.New("segment is missing")
+	// ErrShortRecord means a record is shorter than what its type needs to be decoded
+	ErrShortRecord = errors.New("record is too short")
+)
+
+// RecordError is an error reading or decoding the record at a location.  The type and resource manager are those of
+// the record's header, zero when the header could not be read.
+type RecordError struct {
+	Location          Location
+	Type              RecordType
+	ResourceManagerID uint8
+	Err               error
+}
+
+func (e *RecordError) Error() string {
+	return fmt.Sprintf("%v record of resource manager %v at %v: %v", e.Type, e.ResourceManagerID, e.Location, e.Err)
+}
+
+// Unwrap is the error reading or decoding the record
+func (e *RecordError) Unwrap() error {
+	return e.Err
+}
+
+func newRecordError(location Location, header *RecordHeader, err error) error {
+	if header == nil {
+		return &RecordError{Location: location, Err: err}
+	}
+
+	return &RecordError{location, header.Type(), header.ResourceManagerID(), err}
+}
+
+// SegmentMissingError is returned when a segment cannot be found, it is ErrSegmentMissing and wraps the error of the
+// source, which satisfies os.IsNotExist
+type SegmentMissingError struct {
+	Segment SegmentName
+	Err     error
+}
+
+func (e *SegmentMissingError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap is the error of the source
+func (e *SegmentMissingError) Unwrap() error {
+	return e.Err
+}
+
+// Is matches ErrSegmentMissing
+func (e *SegmentMissingError) Is(target error) bool {
+	return target == ErrSegmentMissing
+}
+
+func shortRecordError(what string, need, have int) error {
+	return fmt.Errorf("%w: %v needs %v bytes but has %v", ErrShortRecord, what, need, have)
+}
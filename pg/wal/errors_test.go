@@ -0,0 +1,40 @@
+package wal
+
+// Copyright 2015 MediaMath <http://www.mediamath.com>.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestReadEntriesWrapsErrors(t *testing.T) {
+	location := NewLocationWithDefaults(0x0000000013002010)
+	memory := NewMemorySource()
+	cursor := Cursor{location, blockReader{blockSize: 0x2000, wordSize: 8, source: memory}}
+
+	_, cur, err := cursor.ReadEntries()
+	if !errors.Is(err, ErrSegmentMissing) {
+		t.Errorf("expected segment to be missing but got %v", err)
+	}
+
+	var recordErr *RecordError
+	if !errors.As(err, &recordErr) || recordErr.Location != location || recordErr.Type != Unknown {
+		t.Errorf("expected error for the record at %v but got %v", location, err)
+	}
+
+	if cur.location != location {
+		t.Errorf("expected cursor to stay at %v but got %v", location, cur.location)
+	}
+
+	// a 9.1 header that does not fit on its page can only be read once the page after it is written
+	segment := make([]byte, 0x4000)
+	copy(segment[0x2000:], pageExpectations[1].bs)
+	memory.Add(location.SegmentName(), segment)
+
+	_, _, err = cursor.MoveTo(location.StartOfNextPage().Subtract(16)).ReadEntries()
+	if !errors.Is(err, ErrIncompleteRecord) {
+		t.Errorf("expected record to be incomplete but got %v", err)
+	}
+}
@@ -0,0 +1,116 @@
+package wal
+
+// Copyright 2015 MediaMath <http://www.mediamath.com>.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+import "testing"
+
+// These fuzz targets check that no input read from disk panics the parser, run them with go test -fuzz FuzzPage etc
+
+var fuzzVersions = []uint16{Magic91, Magic94, Magic95, Magic96, Magic10}
+
+func FuzzPage(f *testing.F) {
+	for _, exp := range pageExpectations {
+		f.Add(exp.bs)
+	}
+	f.Add([]byte{})
+
+	f.Fuzz(func(t *testing.T, bs []byte) {
+		page := Page{bs}
+		location := NewLocationWithDefaults(0x13000000)
+
+		page.MagicValueIsValid()
+		page.Info()
+		page.TimelineID()
+		page.SystemID()
+		page.Continuation()
+		page.HeaderLength()
+		page.Validate(location, 0)
+		_ = page.Location().String()
+
+		if size := page.SegmentSize(); size != 0 && page.BlockSize() != 0 {
+			_ = location.WithGeometry(size, page.BlockSize(), 0).Filename()
+		}
+	})
+}
+
+func FuzzRecordHeader(f *testing.F) {
+	for _, exp := range recordHeaderExpectations {
+		f.Add(exp.bs, uint16(0), uint8(0))
+	}
+	for _, exp := range pageExpectations {
+		f.Add(exp.bs, uint16(exp.headerLength), uint8(0))
+	}
+
+	// headers whose total length is shorter than the header, 9.1 keeps it at 16 and 9.5 at 0
+	short := make([]byte, 32)
+	short[16], short[0] = 8, 8
+	f.Add(short, uint16(0), uint8(0))
+	f.Add(short, uint16(0), uint8(2))
+
+	f.Fuzz(func(t *testing.T, block []byte, offset uint16, version uint8) {
+		reader := blockReader{blockSize: 0x2000, wordSize: 8, source: NewMemorySource()}
+		location := NewLocationWithDefaults(0x13000000 + uint64(offset)%0x2000)
+
+		header, err := NewRecordHeader(block, location, fuzzVersions[int(version)%len(fuzzVersions)], reader)
+		if err != nil || header == nil {
+			return
+		}
+
+		header.Crc()
+		header.Previous()
+		header.TransactionID()
+		header.Type()
+		header.IsInit()
+		header.Length()
+
+		if err := header.checkLength(); (err == nil) != (uint64(header.TotalLength()) >= header.AlignedSize()) {
+			t.Errorf("total length of %v with a %v byte header checked as %v", header.TotalLength(), header.AlignedSize(), err)
+		}
+
+		body := NewRecordBody(header)
+		if body.whatsNeeded > uint64(header.TotalLength()) {
+			t.Errorf("a record of %v bytes needs %v bytes of body", header.TotalLength(), body.whatsNeeded)
+		}
+		body.AppendBodyAfterHeader(block, location.Add(header.AlignedSize()))
+		body.AppendContinuation(Page{block})
+		body.IsComplete()
+		verifyRecordCrc(header, body)
+
+		if heapData, err := body.HeapData(); err == nil {
+			touchHeapData(heapData)
+		}
+	})
+}
+
+func FuzzHeapData(f *testing.F) {
+	for _, exp := range heapDataExpectations {
+		f.Add(uint8(exp.typ), false, exp.bs, uint8(0))
+	}
+	for _, exp := range blockHeapDataExpectations {
+		f.Add(uint8(exp.typ), false, exp.bs, uint8(3))
+	}
+
+	f.Fuzz(func(t *testing.T, typ uint8, isInit bool, data []byte, version uint8) {
+		heapData, err := NewHeapData(RecordType(typ%uint8(len(recordTypeNames))), isInit, data, fuzzVersions[int(version)%len(fuzzVersions)])
+		if err == nil {
+			touchHeapData(heapData)
+		}
+	})
+}
+
+func touchHeapData(heapData []HeapData) {
+	for _, hd := range heapData {
+		_ = hd.String()
+		hd.FromBlock()
+		hd.FromOffset()
+
+		for _, tuple := range []TupleData{hd.NewTuple(), hd.OldTuple()} {
+			if tuple != nil {
+				tuple.IsNull(0)
+				tuple.UserData()
+			}
+		}
+	}
+}
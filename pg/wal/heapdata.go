@@ -19,23 +19,75 @@ type HeapData interface {
 	FromOffset() uint16
 	ToBlock() uint32
 	ToOffset() uint16
+	NewTuple() TupleData
+	OldTuple() TupleData
 	fmt.Stringer
 }
 
-// NewHeapData will interpret the heap data based on record type
-func NewHeapData(recordType RecordType, isInit bool, data []byte, version uint16) []HeapData {
+// These constants are the sizes of the fixed portion of the heap data in 9.1 and 9.4 records
+const (
+	sizeOfHeapInsert91 = 21
+	sizeOfHeapUpdate91 = 28
+	sizeOfHeapUpdate94 = 36
+	sizeOfHeapDelete94 = 26
+)
+
+// These constants are the 9.4 flags that mark a record as carrying the replica identity of the old tuple
+const (
+	heapContainsOldTuple94 = 0x04
+	heapContainsOldKey94   = 0x08
+)
+
+// These constants are the update flags in 9.4 and 9.5+ records that mark a new tuple sharing bytes with the old one
+const (
+	updatePrefixFromOld = 0x20
+	updateSuffixFromOld = 0x40
+)
+
+// These constants are the sizes of the heap data the accessors of 9.1 and 9.4 records read
+const (
+	sizeOfHeapTarget      = 18
+	sizeOfHeapMultiTarget = 20
+	sizeOfHeapNewTarget91 = 26
+	sizeOfHeapNewTarget94 = 34
+)
+
+// NewHeapData will interpret the heap data based on record type, it fails with ErrShortRecord when the data is too
+// short for its type
+func NewHeapData(recordType RecordType, isInit bool, data []byte, version uint16) ([]HeapData, error) {
+	if recordType == Create || recordType == Truncate {
+		return newSmgrData(recordType, data, version)
+	}
+
+	if HasBlockReferences(version) {
+		return newBlockHeapData(recordType, isInit, data)
+	}
+
 	switch recordType {
 	case Insert:
-		return []HeapData{InsertData(data)}
+		if len(data) < sizeOfHeapTarget {
+			return nil, shortRecordError("insert", sizeOfHeapTarget, len(data))
+		}
+		return []HeapData{InsertData(data)}, nil
 	case Update:
-		return []HeapData{UpdateData{data, version}}
+		need := sizeOfHeapNewTarget91
+		if version == Magic94 {
+			need = sizeOfHeapNewTarget94
+		}
+		if len(data) < need {
+			return nil, shortRecordError("update", need, len(data))
+		}
+		return []HeapData{UpdateData{data, version}}, nil
 	case Delete:
-		return []HeapData{DeleteData(data)}
+		if len(data) < sizeOfHeapTarget {
+			return nil, shortRecordError("delete", sizeOfHeapTarget, len(data))
+		}
+		return []HeapData{DeleteData{data, version}}, nil
 	case MultiInsert:
 		return parseMultiInsertData(isInit, data)
 	}
 
-	return nil
+	return nil, nil
 }
 
 // InsertData reads heap data as an insert
@@ -62,6 +114,19 @@ func (d InsertData) ToBlock() uint32 { return readBlockID(d[12:16]) }
 // ToOffset is the item number where this tuple now resides
 func (d InsertData) ToOffset() uint16 { return uint16(pg.LUint(d[16:18])) }
 
+// NewTuple is the inserted tuple, nil when the record only carries a full page image
+func (d InsertData) NewTuple() TupleData {
+	if len(d) <= sizeOfHeapInsert91 {
+		return nil
+	}
+
+	tuple, _ := NewTupleData(d[sizeOfHeapInsert91:])
+	return tuple
+}
+
+// OldTuple is not available for inserts
+func (d InsertData) OldTuple() TupleData { return nil }
+
 func (d InsertData) String() string {
 	return fmt.Sprintf("Insert in %v/%v/%v to (%v,%v)", d.TablespaceID(), d.DatabaseID(), d.RelationID(), d.ToBlock(), d.ToOffset())
 }
@@ -90,9 +155,9 @@ func (d UpdateData) FromOffset() uint16 { return uint16(pg.LUint(d.bs[16:18])) }
 // ToBlock is the page number of the new version of this tuple
 func (d UpdateData) ToBlock() uint32 {
 	switch d.version {
-	case 0xD066:
+	case Magic91:
 		return readBlockID(d.bs[20:24])
-	case 0xD07E:
+	case Magic94:
 		return readBlockID(d.bs[28:32])
 	}
 
@@ -102,36 +167,81 @@ func (d UpdateData) ToBlock() uint32 {
 // ToOffset is item number of the new version of this tuple
 func (d UpdateData) ToOffset() uint16 {
 	switch d.version {
-	case 0xD066:
+	case Magic91:
 		return uint16(pg.LUint(d.bs[24:26]))
-	case 0xD07E:
+	case Magic94:
 		return uint16(pg.LUint(d.bs[32:34]))
 	}
 
 	return 0
 }
 
+// NewTuple is the new version of this tuple, nil when the record only carries a full page image or the
+// tuple shares bytes with its old version
+func (d UpdateData) NewTuple() TupleData {
+	switch d.version {
+	case Magic91:
+		if len(d.bs) > sizeOfHeapUpdate91 {
+			tuple, _ := NewTupleData(d.bs[sizeOfHeapUpdate91:])
+			return tuple
+		}
+	case Magic94:
+		if len(d.bs) >= sizeOfHeapUpdate94 && d.bs[35]&(updatePrefixFromOld|updateSuffixFromOld) == 0 {
+			tuple, _, _ := readTupleWithLength(d.bs, sizeOfHeapUpdate94)
+			return tuple
+		}
+	}
+
+	return nil
+}
+
+// OldTuple is the replica identity of the old version of this tuple, only logged by 9.4 with wal_level logical
+func (d UpdateData) OldTuple() TupleData {
+	if d.version != Magic94 || len(d.bs) < sizeOfHeapUpdate94 || d.bs[35]&(heapContainsOldTuple94|heapContainsOldKey94) == 0 {
+		return nil
+	}
+
+	pos := uint64(sizeOfHeapUpdate94)
+	if d.bs[35]&updatePrefixFromOld > 0 {
+		pos += 2
+	}
+	if d.bs[35]&updateSuffixFromOld > 0 {
+		pos += 2
+	}
+
+	_, pos, ok := readTupleWithLength(d.bs, pos)
+	if !ok {
+		return nil
+	}
+
+	tuple, _, _ := readTupleWithLength(d.bs, pos)
+	return tuple
+}
+
 func (d UpdateData) String() string {
 	return fmt.Sprintf("Update in %v/%v/%v from (%v,%v) to (%v,%v)", d.TablespaceID(), d.DatabaseID(), d.RelationID(), d.FromBlock(), d.FromOffset(), d.ToBlock(), d.ToOffset())
 }
 
 // DeleteData reads heap data as a delete
-type DeleteData []byte
+type DeleteData struct {
+	bs      []byte
+	version uint16
+}
 
 // TablespaceID is the id of the tablespace this tuple is found in
-func (d DeleteData) TablespaceID() uint32 { return uint32(pg.LUint(d[0:4])) }
+func (d DeleteData) TablespaceID() uint32 { return uint32(pg.LUint(d.bs[0:4])) }
 
 // DatabaseID is the id of the database this tuple is found in
-func (d DeleteData) DatabaseID() uint32 { return uint32(pg.LUint(d[4:8])) }
+func (d DeleteData) DatabaseID() uint32 { return uint32(pg.LUint(d.bs[4:8])) }
 
 // RelationID is the id of the relation this tuple is found in
-func (d DeleteData) RelationID() uint32 { return uint32(pg.LUint(d[8:12])) }
+func (d DeleteData) RelationID() uint32 { return uint32(pg.LUint(d.bs[8:12])) }
 
 // FromBlock is the page number where this tuple previously resided
-func (d DeleteData) FromBlock() uint32 { return readBlockID(d[12:16]) }
+func (d DeleteData) FromBlock() uint32 { return readBlockID(d.bs[12:16]) }
 
 // FromOffset is the item number where this tuple previously resided
-func (d DeleteData) FromOffset() uint16 { return uint16(pg.LUint(d[16:18])) }
+func (d DeleteData) FromOffset() uint16 { return uint16(pg.LUint(d.bs[16:18])) }
 
 // ToBlock is not available for deletes
 func (d DeleteData) ToBlock() uint32 { return 0 }
@@ -139,6 +249,19 @@ func (d DeleteData) ToBlock() uint32 { return 0 }
 // ToOffset is not available for deletes
 func (d DeleteData) ToOffset() uint16 { return 0 }
 
+// NewTuple is not available for deletes
+func (d DeleteData) NewTuple() TupleData { return nil }
+
+// OldTuple is the replica identity of the deleted tuple, only logged by 9.4 with wal_level logical
+func (d DeleteData) OldTuple() TupleData {
+	if d.version != Magic94 || len(d.bs) <= sizeOfHeapDelete94 || d.bs[25]&(heapContainsOldTuple94|heapContainsOldKey94) == 0 {
+		return nil
+	}
+
+	tuple, _ := NewTupleData(d.bs[sizeOfHeapDelete94:])
+	return tuple
+}
+
 func (d DeleteData) String() string {
 	return fmt.Sprintf("Delete in %v/%v/%v from (%v,%v)", d.TablespaceID(), d.DatabaseID(), d.RelationID(), d.FromBlock(), d.FromOffset())
 }
@@ -173,13 +296,23 @@ func (d MultiInsertData) ToBlock() uint32 { return d.toBlock }
 // ToOffset is the item number where this tuple now resides
 func (d MultiInsertData) ToOffset() uint16 { return d.toOffset }
 
+// NewTuple is not decoded for multi inserts
+func (d MultiInsertData) NewTuple() TupleData { return nil }
+
+// OldTuple is not available for inserts
+func (d MultiInsertData) OldTuple() TupleData { return nil }
+
 func (d MultiInsertData) String() string {
 	return fmt.Sprintf("MultiInsert in %v/%v/%v to (%v,%v)", d.TablespaceID(), d.DatabaseID(), d.RelationID(), d.ToBlock(), d.ToOffset())
 }
 
-func parseMultiInsertData(isInit bool, d []byte) (multiInserts []HeapData) {
+func parseMultiInsertData(isInit bool, d []byte) (multiInserts []HeapData, err error) {
 	const XlogHeapInitPage = 128
 
+	if len(d) < sizeOfHeapMultiTarget {
+		return nil, shortRecordError("multi insert", sizeOfHeapMultiTarget, len(d))
+	}
+
 	var (
 		tablespaceID = uint32(pg.LUint(d[0:4]))
 		databaseID   = uint32(pg.LUint(d[4:8]))
@@ -191,12 +324,16 @@ func parseMultiInsertData(isInit bool, d []byte) (multiInserts []HeapData) {
 
 	isInit = isInit || flags&XlogHeapInitPage > 0
 
+	if need := sizeOfHeapMultiTarget + 2*int(ntuples); !isInit && len(d) < need {
+		return nil, shortRecordError(fmt.Sprintf("multi insert of %v tuples", ntuples), need, len(d))
+	}
+
 	for i := uint16(0); i < ntuples; i++ {
 		if isInit {
 			multiInserts = append(multiInserts, MultiInsertData{tablespaceID, databaseID, relationID, toBlock, i + 1})
 		} else {
 			var (
-				start    = i*2 + 20
+				start    = uint64(i)*2 + sizeOfHeapMultiTarget
 				end      = start + 2
 				toOffset = uint16(pg.LUint(d[start:end]))
 			)
@@ -208,6 +345,26 @@ func parseMultiInsertData(isInit bool, d []byte) (multiInserts []HeapData) {
 	return
 }
 
+// readTupleWithLength reads a tuple logged after an xl_heap_header_len and returns the position following it
+func readTupleWithLength(bs []byte, pos uint64) (TupleData, uint64, bool) {
+	if pos+sizeOfHeapHeaderLen > uint64(len(bs)) {
+		return nil, pos, false
+	}
+
+	var (
+		header = bs[pos : pos+sizeOfHeapHeaderLen]
+		start  = pos + sizeOfHeapHeaderLen
+		end    = start + pg.LUint(header[0:2])
+	)
+
+	if end > uint64(len(bs)) {
+		return nil, pos, false
+	}
+
+	tuple, ok := newTupleDataFromParts(header[2:], bs[start:end])
+	return tuple, end, ok
+}
+
 func readBlockID(bs []byte) uint32 {
 	return (uint32(pg.LUint(bs[0:2])) << 16) + uint32(pg.LUint(bs[2:4]))
 }
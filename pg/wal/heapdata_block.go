@@ -0,0 +1,232 @@
+package wal
+
+// Copyright 2015 MediaMath <http://www.mediamath.com>.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+import (
+	"fmt"
+
+	"github.com/MediaMath/keryxlib/pg"
+)
+
+// These constants are the 9.5+ flags that mark a record as carrying the replica identity of the old tuple
+const (
+	deleteContainsOldTuple = 0x02
+	deleteContainsOldKey   = 0x04
+	updateContainsOldTuple = 0x04
+	updateContainsOldKey   = 0x08
+)
+
+// These constants are the sizes of the fixed portion of the heap main data in 9.5+ records
+const (
+	sizeOfHeapInsert      = 3
+	sizeOfHeapDelete      = 8
+	sizeOfHeapUpdate      = 14
+	sizeOfHeapMultiInsert = 4
+)
+
+func newBlockHeapData(recordType RecordType, isInit bool, data []byte) ([]HeapData, error) {
+	switch recordType {
+	case Insert, Update, Delete, MultiInsert:
+	default:
+		return nil, nil
+	}
+
+	record, err := NewBlockRecord(data)
+	if err != nil {
+		return nil, err
+	}
+
+	target, ok := record.Block(0)
+	if !ok {
+		return nil, fmt.Errorf("%w: %v has no block 0", ErrShortRecord, recordType)
+	}
+
+	main := record.MainData
+
+	switch recordType {
+	case Insert:
+		if len(main) < sizeOfHeapInsert {
+			return nil, shortRecordError("insert", sizeOfHeapInsert, len(main))
+		}
+		return []HeapData{BlockInsertData{target, main}}, nil
+	case Update:
+		if len(main) < sizeOfHeapUpdate {
+			return nil, shortRecordError("update", sizeOfHeapUpdate, len(main))
+		}
+		old, ok := record.Block(1)
+		if !ok {
+			old = target
+		}
+		return []HeapData{BlockUpdateData{target, old, main}}, nil
+	case Delete:
+		if len(main) < sizeOfHeapDelete {
+			return nil, shortRecordError("delete", sizeOfHeapDelete, len(main))
+		}
+		return []HeapData{BlockDeleteData{target, main}}, nil
+	}
+
+	if len(main) < sizeOfHeapMultiInsert {
+		return nil, shortRecordError("multi insert", sizeOfHeapMultiInsert, len(main))
+	}
+	return parseBlockMultiInsertData(isInit, target, main)
+}
+
+// BlockInsertData reads heap data as an insert from a 9.5+ record
+type BlockInsertData struct {
+	block BlockReference
+	main  []byte
+}
+
+// TablespaceID is the id of the tablespace this tuple is found in
+func (d BlockInsertData) TablespaceID() uint32 { return d.block.TablespaceID }
+
+// DatabaseID is the id of the database this tuple is found in
+func (d BlockInsertData) DatabaseID() uint32 { return d.block.DatabaseID }
+
+// RelationID is the id of the relation this tuple is found in
+func (d BlockInsertData) RelationID() uint32 { return d.block.RelationID }
+
+// FromBlock is not available for inserts
+func (d BlockInsertData) FromBlock() uint32 { return 0 }
+
+// FromOffset is not available for inserts
+func (d BlockInsertData) FromOffset() uint16 { return 0 }
+
+// ToBlock is the page number where this tuple now resides
+func (d BlockInsertData) ToBlock() uint32 { return d.block.Block }
+
+// ToOffset is the item number where this tuple now resides
+func (d BlockInsertData) ToOffset() uint16 { return uint16(pg.LUint(d.main[0:2])) }
+
+// NewTuple is the inserted tuple, nil when the record only carries a full page image
+func (d BlockInsertData) NewTuple() TupleData {
+	tuple, _ := NewTupleData(d.block.Data)
+	return tuple
+}
+
+// OldTuple is not available for inserts
+func (d BlockInsertData) OldTuple() TupleData { return nil }
+
+func (d BlockInsertData) String() string {
+	return fmt.Sprintf("Insert in %v/%v/%v to (%v,%v)", d.TablespaceID(), d.DatabaseID(), d.RelationID(), d.ToBlock(), d.ToOffset())
+}
+
+// BlockUpdateData reads heap data as an update from a 9.5+ record
+type BlockUpdateData struct {
+	block BlockReference
+	old   BlockReference
+	main  []byte
+}
+
+// TablespaceID is the id of the tablespace this tuple is found in
+func (d BlockUpdateData) TablespaceID() uint32 { return d.block.TablespaceID }
+
+// DatabaseID is the id of the database this tuple is found in
+func (d BlockUpdateData) DatabaseID() uint32 { return d.block.DatabaseID }
+
+// RelationID is the id of the relation this tuple is found in
+func (d BlockUpdateData) RelationID() uint32 { return d.block.RelationID }
+
+// FromBlock is the page number of the old version of this tuple
+func (d BlockUpdateData) FromBlock() uint32 { return d.old.Block }
+
+// FromOffset is the item number of the old version of this tuple
+func (d BlockUpdateData) FromOffset() uint16 { return uint16(pg.LUint(d.main[4:6])) }
+
+// ToBlock is the page number of the new version of this tuple
+func (d BlockUpdateData) ToBlock() uint32 { return d.block.Block }
+
+// ToOffset is item number of the new version of this tuple
+func (d BlockUpdateData) ToOffset() uint16 { return uint16(pg.LUint(d.main[12:14])) }
+
+// NewTuple is the new version of this tuple, nil when the record only carries a full page image or the
+// tuple shares bytes with its old version
+func (d BlockUpdateData) NewTuple() TupleData {
+	if d.main[7]&(updatePrefixFromOld|updateSuffixFromOld) > 0 {
+		return nil
+	}
+
+	tuple, _ := NewTupleData(d.block.Data)
+	return tuple
+}
+
+// OldTuple is the replica identity of the old version of this tuple, only logged with wal_level logical
+func (d BlockUpdateData) OldTuple() TupleData {
+	if d.main[7]&(updateContainsOldTuple|updateContainsOldKey) == 0 {
+		return nil
+	}
+
+	tuple, _ := NewTupleData(d.main[sizeOfHeapUpdate:])
+	return tuple
+}
+
+func (d BlockUpdateData) String() string {
+	return fmt.Sprintf("Update in %v/%v/%v from (%v,%v) to (%v,%v)", d.TablespaceID(), d.DatabaseID(), d.RelationID(), d.FromBlock(), d.FromOffset(), d.ToBlock(), d.ToOffset())
+}
+
+// BlockDeleteData reads heap data as a delete from a 9.5+ record
+type BlockDeleteData struct {
+	block BlockReference
+	main  []byte
+}
+
+// TablespaceID is the id of the tablespace this tuple is found in
+func (d BlockDeleteData) TablespaceID() uint32 { return d.block.TablespaceID }
+
+// DatabaseID is the id of the database this tuple is found in
+func (d BlockDeleteData) DatabaseID() uint32 { return d.block.DatabaseID }
+
+// RelationID is the id of the relation this tuple is found in
+func (d BlockDeleteData) RelationID() uint32 { return d.block.RelationID }
+
+// FromBlock is the page number where this tuple previously resided
+func (d BlockDeleteData) FromBlock() uint32 { return d.block.Block }
+
+// FromOffset is the item number where this tuple previously resided
+func (d BlockDeleteData) FromOffset() uint16 { return uint16(pg.LUint(d.main[4:6])) }
+
+// ToBlock is not available for deletes
+func (d BlockDeleteData) ToBlock() uint32 { return 0 }
+
+// ToOffset is not available for deletes
+func (d BlockDeleteData) ToOffset() uint16 { return 0 }
+
+// NewTuple is not available for deletes
+func (d BlockDeleteData) NewTuple() TupleData { return nil }
+
+// OldTuple is the replica identity of the deleted tuple, only logged with wal_level logical
+func (d BlockDeleteData) OldTuple() TupleData {
+	if d.main[7]&(deleteContainsOldTuple|deleteContainsOldKey) == 0 {
+		return nil
+	}
+
+	tuple, _ := NewTupleData(d.main[sizeOfHeapDelete:])
+	return tuple
+}
+
+func (d BlockDeleteData) String() string {
+	return fmt.Sprintf("Delete in %v/%v/%v from (%v,%v)", d.TablespaceID(), d.DatabaseID(), d.RelationID(), d.FromBlock(), d.FromOffset())
+}
+
+func parseBlockMultiInsertData(isInit bool, block BlockReference, d []byte) (multiInserts []HeapData, err error) {
+	ntuples := uint16(pg.LUint(d[2:4]))
+
+	if need := sizeOfHeapMultiInsert + 2*int(ntuples); !isInit && len(d) < need {
+		return nil, shortRecordError(fmt.Sprintf("multi insert of %v tuples", ntuples), need, len(d))
+	}
+
+	for i := uint16(0); i < ntuples; i++ {
+		toOffset := i + 1
+
+		if !isInit {
+			start := uint64(i)*2 + sizeOfHeapMultiInsert
+			toOffset = uint16(pg.LUint(d[start : start+2]))
+		}
+
+		multiInserts = append(multiInserts, MultiInsertData{block.TablespaceID, block.DatabaseID, block.RelationID, block.Block, toOffset})
+	}
+
+	return
+}
@@ -4,11 +4,14 @@ package wal
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
-import "testing"
+import (
+	"errors"
+	"testing"
+)
 
 func TestHeapDataExpectations(t *testing.T) {
 	for _, exp := range heapDataExpectations {
-		if act := NewHeapData(exp.typ, false, exp.bs, 0xD066); act[0].String() != exp.str {
+		if act := heapDataOrFail(t, exp.typ, exp.bs, 0xD066); act[0].String() != exp.str {
 			t.Errorf("expected %q but got %q", exp.str, act[0].String())
 		}
 	}
@@ -70,3 +73,158 @@ type heapDataExpectation struct {
 	str string
 	bs  []byte
 }
+
+func TestBlockHeapDataExpectations(t *testing.T) {
+	for _, exp := range blockHeapDataExpectations {
+		act := heapDataOrFail(t, exp.typ, exp.bs, Magic96)
+		if len(act) != len(exp.strs) {
+			t.Fatalf("expected %v heap data but got %v", len(exp.strs), len(act))
+		}
+		for i, str := range exp.strs {
+			if act[i].String() != str {
+				t.Errorf("expected %q but got %q", str, act[i].String())
+			}
+		}
+	}
+}
+
+var blockHeapDataExpectations = []blockHeapDataExpectation{
+	{Insert, []string{"Insert in 1663/16384/16387 to (2034,27)"},
+		[]byte{
+			0x00, 0x20, 0x05, 0x00, 0x7f, 0x06, 0x00, 0x00, 0x00, 0x40, 0x00, 0x00, 0x03, 0x40, 0x00, 0x00,
+			0xf2, 0x07, 0x00, 0x00, 0xff, 0x03, 0x01, 0x02, 0x03, 0x04, 0x05, 0x1b, 0x00, 0x00}},
+	{Update, []string{"Update in 1663/16384/16387 from (1282,95) to (1284,56)"},
+		[]byte{
+			0x00, 0x00, 0x00, 0x00, 0x7f, 0x06, 0x00, 0x00, 0x00, 0x40, 0x00, 0x00, 0x03, 0x40, 0x00, 0x00,
+			0x04, 0x05, 0x00, 0x00, 0x01, 0x80, 0x00, 0x00, 0x02, 0x05, 0x00, 0x00, 0xff, 0x0e, 0x10, 0x04,
+			0x00, 0x00, 0x5f, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x38, 0x00}},
+	{Update, []string{"Update in 1663/16384/16387 from (1284,95) to (1284,96)"},
+		[]byte{
+			0x00, 0x00, 0x00, 0x00, 0x7f, 0x06, 0x00, 0x00, 0x00, 0x40, 0x00, 0x00, 0x03, 0x40, 0x00, 0x00,
+			0x04, 0x05, 0x00, 0x00, 0xff, 0x0e, 0x10, 0x04, 0x00, 0x00, 0x5f, 0x00, 0x00, 0x00, 0x00, 0x00,
+			0x00, 0x00, 0x60, 0x00}},
+	{Delete, []string{"Delete in 1663/16395/16398 from (2500,112)"},
+		[]byte{
+			0x00, 0x00, 0x00, 0x00, 0x7f, 0x06, 0x00, 0x00, 0x0b, 0x40, 0x00, 0x00, 0x0e, 0x40, 0x00, 0x00,
+			0xc4, 0x09, 0x00, 0x00, 0xff, 0x08, 0x82, 0x01, 0x00, 0x00, 0x70, 0x00, 0x00, 0x00}},
+	{MultiInsert, []string{"MultiInsert in 1663/16384/16387 to (2034,3)", "MultiInsert in 1663/16384/16387 to (2034,4)"},
+		[]byte{
+			0x00, 0x00, 0x00, 0x00, 0x7f, 0x06, 0x00, 0x00, 0x00, 0x40, 0x00, 0x00, 0x03, 0x40, 0x00, 0x00,
+			0xf2, 0x07, 0x00, 0x00, 0xff, 0x08, 0x00, 0x00, 0x02, 0x00, 0x03, 0x00, 0x04, 0x00}},
+	// the high bit of the flags does not make the page new, the offsets are still logged
+	{MultiInsert, []string{"MultiInsert in 1663/16384/16387 to (2034,3)", "MultiInsert in 1663/16384/16387 to (2034,4)"},
+		[]byte{
+			0x00, 0x00, 0x00, 0x00, 0x7f, 0x06, 0x00, 0x00, 0x00, 0x40, 0x00, 0x00, 0x03, 0x40, 0x00, 0x00,
+			0xf2, 0x07, 0x00, 0x00, 0xff, 0x08, 0x80, 0x00, 0x02, 0x00, 0x03, 0x00, 0x04, 0x00}},
+	{Create, []string{"Create of 1663/16384/16400 fork 0"},
+		[]byte{
+			0xff, 0x10, 0x7f, 0x06, 0x00, 0x00, 0x00, 0x40, 0x00, 0x00, 0x10, 0x40, 0x00, 0x00, 0x00, 0x00,
+			0x00, 0x00}},
+	{Truncate, []string{"Truncate of 1663/16384/16387 to 3 blocks"},
+		[]byte{
+			0xff, 0x14, 0x03, 0x00, 0x00, 0x00, 0x7f, 0x06, 0x00, 0x00, 0x00, 0x40, 0x00, 0x00, 0x03, 0x40,
+			0x00, 0x00, 0x03, 0x00, 0x00, 0x00}},
+}
+
+type blockHeapDataExpectation struct {
+	typ  RecordType
+	strs []string
+	bs   []byte
+}
+
+func TestOldTupleExpectations(t *testing.T) {
+	keyTuple := []byte{0x01, 0x00, 0x00, 0x00, 0x18, 0x00, 0x2a, 0x00, 0x00, 0x00}
+	newTuple := []byte{0x01, 0x00, 0x00, 0x00, 0x18, 0x00, 0x2b, 0x00, 0x00, 0x00}
+	node := []byte{0x7f, 0x06, 0x00, 0x00, 0x00, 0x40, 0x00, 0x00, 0x03, 0x40, 0x00, 0x00}
+
+	var delete94 []byte
+	delete94 = append(delete94, node...)
+	delete94 = append(delete94, 0x00, 0x00, 0x02, 0x05, 0x5f, 0x00, 0x00, 0x00, 0x10, 0x04, 0x00, 0x00, 0x00, 0x08)
+	delete94 = append(delete94, keyTuple...)
+
+	var update94 []byte
+	update94 = append(update94, node...)
+	update94 = append(update94, 0x00, 0x00, 0x02, 0x05, 0x5f, 0x00, 0x00, 0x00, 0x10, 0x04, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00)
+	update94 = append(update94, 0x00, 0x00, 0x04, 0x05, 0x38, 0x00, 0x00, 0x18)
+	update94 = append(update94, 0x05, 0x00)
+	update94 = append(update94, newTuple...)
+	update94 = append(update94, 0x05, 0x00)
+	update94 = append(update94, keyTuple...)
+
+	var delete95 []byte
+	delete95 = append(delete95, 0x00, 0x00, 0x00, 0x00)
+	delete95 = append(delete95, node...)
+	delete95 = append(delete95, 0x02, 0x05, 0x00, 0x00, 0xff, byte(8+len(keyTuple)))
+	delete95 = append(delete95, 0x10, 0x04, 0x00, 0x00, 0x5f, 0x00, 0x00, 0x04)
+	delete95 = append(delete95, keyTuple...)
+
+	var update95 []byte
+	update95 = append(update95, 0x00, 0x20, byte(len(newTuple)), 0x00)
+	update95 = append(update95, node...)
+	update95 = append(update95, 0x04, 0x05, 0x00, 0x00, 0xff, byte(14+len(keyTuple)))
+	update95 = append(update95, newTuple...)
+	update95 = append(update95, 0x10, 0x04, 0x00, 0x00, 0x5f, 0x00, 0x00, 0x18, 0x00, 0x00, 0x00, 0x00, 0x38, 0x00)
+	update95 = append(update95, keyTuple...)
+
+	expectations := []struct {
+		typ      RecordType
+		version  uint16
+		bs       []byte
+		newTuple []byte
+	}{
+		{Delete, Magic94, delete94, nil},
+		{Update, Magic94, update94, newTuple},
+		{Delete, Magic95, delete95, nil},
+		{Update, Magic96, update95, newTuple},
+	}
+
+	for _, exp := range expectations {
+		heapData := heapDataOrFail(t, exp.typ, exp.bs, exp.version)
+		if len(heapData) != 1 {
+			t.Fatalf("expected 1 heap data for %v but got %v", exp.typ, len(heapData))
+		}
+
+		if act := heapData[0].OldTuple(); string(act) != string(keyTuple) {
+			t.Errorf("expected old tuple %v for %v but got %v", keyTuple, heapData[0], act)
+		}
+
+		if act := heapData[0].NewTuple(); string(act) != string(exp.newTuple) {
+			t.Errorf("expected new tuple %v for %v but got %v", exp.newTuple, heapData[0], act)
+		}
+	}
+
+	if act := heapDataOrFail(t, Delete, delete94[:26], Magic94)[0].OldTuple(); act != nil {
+		t.Errorf("expected no old tuple but got %v", act)
+	}
+}
+
+func TestShortHeapData(t *testing.T) {
+	insert := heapDataExpectations[0].bs
+
+	for _, version := range []uint16{Magic91, Magic94} {
+		for _, typ := range []RecordType{Insert, Update, Delete, MultiInsert, Create, Truncate} {
+			if _, err := NewHeapData(typ, false, insert[:12], version); !errors.Is(err, ErrShortRecord) {
+				t.Errorf("expected short %v for %.4X to be a short record but got %v", typ, version, err)
+			}
+		}
+	}
+
+	multiInsert := make([]byte, sizeOfHeapMultiTarget)
+	multiInsert[18] = 2
+	if _, err := NewHeapData(MultiInsert, false, multiInsert, Magic94); !errors.Is(err, ErrShortRecord) {
+		t.Errorf("expected multi insert missing its offsets to be a short record but got %v", err)
+	}
+
+	if heapData, err := NewHeapData(MultiInsert, true, multiInsert, Magic94); err != nil || len(heapData) != 2 {
+		t.Errorf("expected multi insert initializing its page to have 2 tuples but got %v (%v)", heapData, err)
+	}
+}
+
+func heapDataOrFail(t *testing.T, typ RecordType, data []byte, version uint16) []HeapData {
+	heapData, err := NewHeapData(typ, false, data, version)
+	if err != nil {
+		t.Fatalf("expected %v to be decoded but got %v", typ, err)
+	}
+
+	return heapData
+}
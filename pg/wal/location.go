@@ -4,25 +4,35 @@ package wal
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
-import "fmt"
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/MediaMath/keryxlib/pg/control"
+)
+
+// controlVersion93 is the pg_control version of 9.3, the first release that does not skip the last segment of a log id
+const controlVersion93 = 937
 
 // Location models a 64 bit address in the WAL
 type Location struct {
-	offset     uint64
-	timelineID uint32
-	fileSize   uint32
-	pageSize   uint32
-	wordSize   uint32
+	offset           uint64
+	timelineID       uint32
+	fileSize         uint32
+	pageSize         uint32
+	wordSize         uint32
+	skipsLastSegment bool
 }
 
-// NewLocation constructs a new location from an offset
+// NewLocation constructs a new location from an offset in a WAL that does not skip the last segment of a log id
 func NewLocation(loc uint64, timelineID, fileSize, pageSize, wordSize uint32) Location {
-	return Location{loc, timelineID, fileSize, pageSize, wordSize}
+	return Location{loc, timelineID, fileSize, pageSize, wordSize, false}
 }
 
 // NewLocationWithDefaults constructs a new location from an offset with common defaults
 func NewLocationWithDefaults(loc uint64) Location {
-	return Location{loc, 1, 16 * 1024 * 1024, 8 * 1024, 8}
+	return NewLocation(loc, 1, 16*1024*1024, 8*1024, 8)
 }
 
 // LocationFromUint32s constructs a location from two parts
@@ -30,6 +40,102 @@ func LocationFromUint32s(high, low uint32) Location {
 	return NewLocationWithDefaults(uint64(high)<<32 + uint64(low))
 }
 
+// ParseLSN reads an offset written the way postgres writes it, like 0/13000028, or as a single number like 0x13000028
+func ParseLSN(lsn string) (uint64, error) {
+	parts := strings.Split(lsn, "/")
+	if len(parts) == 1 {
+		return strconv.ParseUint(lsn, 0, 64)
+	} else if len(parts) != 2 {
+		return 0, fmt.Errorf("%v is not an LSN like 0/13000028", lsn)
+	}
+
+	high, err := strconv.ParseUint(parts[0], 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("%v is not an LSN like 0/13000028: %v", lsn, err)
+	}
+
+	low, err := strconv.ParseUint(parts[1], 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("%v is not an LSN like 0/13000028: %v", lsn, err)
+	}
+
+	return high<<32 + low, nil
+}
+
+// NewLocationFromControl constructs a location using the timeline, segment size, page size, alignment and release of a cluster's control file
+func NewLocationFromControl(loc uint64, c *control.Control) Location {
+	location := NewLocationWithDefaults(loc).WithGeometry(c.XlogSegSize, c.XlogBlcksz, c.MaxAlign).SkippingLastSegment(c.Version < controlVersion93)
+	if c.CheckPointCopy.ThisTimeLineID != 0 {
+		location = location.OnTimeline(c.CheckPointCopy.ThisTimeLineID)
+	}
+
+	return location
+}
+
+// WithGeometry returns the same offset with a different segment size, page size and alignment, any zero value is left unchanged
+func (l Location) WithGeometry(fileSize, pageSize, wordSize uint32) Location {
+	if fileSize != 0 {
+		l.fileSize = fileSize
+	}
+	if pageSize != 0 {
+		l.pageSize = pageSize
+	}
+	if wordSize != 0 {
+		l.wordSize = wordSize
+	}
+
+	return l
+}
+
+// SkippingLastSegment returns the same offset in a WAL that skips the last segment of every log id, as releases before
+// 9.3 do, or in one that does not
+func (l Location) SkippingLastSegment(skip bool) Location {
+	l.skipsLastSegment = skip
+	return l
+}
+
+// SkipsLastSegment indicates if the WAL this location is in skips the last segment of every log id
+func (l Location) SkipsLastSegment() bool {
+	return l.skipsLastSegment
+}
+
+// TimelineID is the timeline this location is read from
+func (l Location) TimelineID() uint32 {
+	return l.timelineID
+}
+
+// OnTimeline returns the same location on another timeline
+func (l Location) OnTimeline(timelineID uint32) Location {
+	l.timelineID = timelineID
+	return l
+}
+
+// At returns a location at another offset with the same timeline and geometry as this one
+func (l Location) At(offset uint64) Location {
+	l.offset = offset
+	return l
+}
+
+// AtUint32s returns a location built from two parts with the same timeline and geometry as this one
+func (l Location) AtUint32s(high, low uint32) Location {
+	return l.At(uint64(high)<<32 + uint64(low))
+}
+
+// FileSize is the size in bytes of the WAL segment this location is in
+func (l Location) FileSize() uint32 {
+	return l.fileSize
+}
+
+// PageSize is the size in bytes of the WAL page this location is in
+func (l Location) PageSize() uint32 {
+	return l.pageSize
+}
+
+// WordSize is the alignment records are written with
+func (l Location) WordSize() uint32 {
+	return l.wordSize
+}
+
 func (l Location) String() string {
 	return fmt.Sprintf("0x%.16x", l.offset)
 }
@@ -41,7 +147,12 @@ func (l Location) Offset() uint64 {
 
 // Filename is the name of the WAL segment file this location is in
 func (l Location) Filename() string {
-	return fmt.Sprintf("%.8X%.8X%.8X", l.timelineID, l.LogID(), l.SegmentID())
+	return l.SegmentName().String()
+}
+
+// SegmentName identifies the WAL segment this location is in
+func (l Location) SegmentName() SegmentName {
+	return SegmentName{l.timelineID, l.LogID(), l.SegmentID()}
 }
 
 // LogID is the upper 32 bits of the location
@@ -61,9 +172,8 @@ func (l Location) RecordOffset() uint32 {
 
 // Add increases the offset of the Location by some amount
 func (l Location) Add(amount uint64) Location {
-	out := NewLocation(l.offset+amount, l.timelineID, l.fileSize, l.pageSize, l.wordSize)
-	maxSegments := 0xffffffff / l.fileSize
-	if out.SegmentID() == maxSegments {
+	out := l.At(l.offset + amount)
+	if out.isSkipped() {
 		out = out.Add(uint64(l.fileSize))
 	}
 	return out
@@ -71,14 +181,18 @@ func (l Location) Add(amount uint64) Location {
 
 // Subtract decreases the offset of the Location by some amount
 func (l Location) Subtract(amount uint64) Location {
-	out := NewLocation(l.offset-amount, l.timelineID, l.fileSize, l.pageSize, l.wordSize)
-	maxSegments := 0xffffffff / l.fileSize
-	if out.SegmentID() == maxSegments {
+	out := l.At(l.offset - amount)
+	if out.isSkipped() {
 		out = out.Subtract(uint64(l.fileSize))
 	}
 	return out
 }
 
+// isSkipped indicates if the location is in the last segment of a log id in a WAL that never writes it
+func (l Location) isSkipped() bool {
+	return l.skipsLastSegment && l.SegmentID() == 0xffffffff/l.fileSize
+}
+
 // Difference calculates how much larger this offset is than another
 func (l Location) Difference(other Location) uint64 {
 	return l.offset - other.offset
@@ -138,3 +138,63 @@ func failIfLocationNotMatching(t *testing.T, exp locationExpectation) {
 func loc(l uint64) Location {
 	return NewLocation(l, defaultTimelineID, defaultFileSize, defaultPageSize, defaultWordSize)
 }
+
+func TestLocationWithLargeSegments(t *testing.T) {
+	l := NewLocationWithDefaults(0x000000010c123456).WithGeometry(64*1024*1024, 16*1024, 0)
+
+	if filename := l.Filename(); filename != "000000010000000100000003" {
+		t.Errorf("expected 000000010000000100000003 but got %q for filename", filename)
+	}
+	if fromStartOfFile := l.FromStartOfFile(); fromStartOfFile != 0x00123456 {
+		t.Errorf("expected 0x00123456 but got 0x%.8x for from start of file", fromStartOfFile)
+	}
+	if fromStartOfPage := l.FromStartOfPage(); fromStartOfPage != 0x3456 {
+		t.Errorf("expected 0x3456 but got 0x%.8x for from start of page", fromStartOfPage)
+	}
+	if next := l.StartOfNextPage(); next.Offset() != 0x000000010c124000 || next.PageSize() != 16*1024 {
+		t.Errorf("expected next page to keep geometry but got %v with page size %v", next, next.PageSize())
+	}
+	if at := l.AtUint32s(2, 0x10); at.FileSize() != 64*1024*1024 || at.WordSize() != defaultWordSize {
+		t.Errorf("expected relocated location to keep geometry but got %v/%v", at.FileSize(), at.WordSize())
+	}
+}
+
+func TestLastSegmentOfLogID(t *testing.T) {
+	expectations := []struct {
+		location       Location
+		skips          bool
+		next, previous uint64
+	}{
+		{NewLocationWithDefaults(0xFEFFE000), false, 0xFF000000, 0xFEFFC000},
+		{NewLocationWithDefaults(0xFFFFE000), false, 0x100000000, 0xFFFFC000},
+		{NewLocationWithDefaults(0x100000000), false, 0x100002000, 0xFFFFE000},
+		{NewLocationWithDefaults(0xFEFFE000), true, 0x100000000, 0xFEFFC000},
+		{NewLocationWithDefaults(0x100000000), true, 0x100002000, 0xFEFFE000},
+		{NewLocationWithDefaults(0xFBFFE000).WithGeometry(64*1024*1024, 0, 0), false, 0xFC000000, 0xFBFFC000},
+		{NewLocationWithDefaults(0x100000000).WithGeometry(64*1024*1024, 0, 0), true, 0x100002000, 0xFBFFE000},
+	}
+
+	for _, exp := range expectations {
+		l := exp.location.SkippingLastSegment(exp.skips)
+		if next := l.StartOfNextPage(); next.Offset() != exp.next || next.SkipsLastSegment() != exp.skips {
+			t.Errorf("expected the page after %v to be at %X when skipping is %v but got %v", l, exp.next, exp.skips, next)
+		}
+		if previous := l.StartOfPreviousPage(); previous.Offset() != exp.previous {
+			t.Errorf("expected the page before %v to be at %X when skipping is %v but got %v", l, exp.previous, exp.skips, previous)
+		}
+	}
+}
+
+func TestParseLSN(t *testing.T) {
+	for lsn, expected := range map[string]uint64{"0/13000028": 0x13000028, "1/0": 1 << 32, "0x13000028": 0x13000028, "318767144": 0x13000028} {
+		if actual, err := ParseLSN(lsn); err != nil || actual != expected {
+			t.Errorf("expected %v to be %x but got %x: %v", lsn, expected, actual, err)
+		}
+	}
+
+	for _, lsn := range []string{"", "0/", "x/1", "0/1/2", "0/100000000"} {
+		if _, err := ParseLSN(lsn); err == nil {
+			t.Errorf("expected %q to not be an LSN", lsn)
+		}
+	}
+}
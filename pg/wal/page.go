@@ -4,56 +4,102 @@ package wal
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
-import "github.com/MediaMath/keryxlib/pg"
+import (
+	"fmt"
+
+	"github.com/MediaMath/keryxlib/pg"
+)
+
+// PageNotWrittenError is returned when a page has not been written by the current cycle of its segment yet, either
+// because it is still zeroed or because it holds what was written before the segment was recycled
+type PageNotWrittenError struct {
+	Location    Location
+	PageAddress Location
+}
+
+func (e *PageNotWrittenError) Error() string {
+	return fmt.Sprintf("page at %v is not written yet, it has address %v", e.Location, e.PageAddress)
+}
+
+// RecycledSegmentError is returned when a page was written for a later location or by another system than the one
+// being read, which happens when the segment being read is recycled before it is completely read
+type RecycledSegmentError struct {
+	Location         Location
+	PageAddress      Location
+	SystemID         uint64
+	ExpectedSystemID uint64
+}
+
+func (e *RecycledSegmentError) Error() string {
+	if e.SystemID != e.ExpectedSystemID {
+		return fmt.Sprintf("page at %v was written by system %v instead of %v", e.Location, e.SystemID, e.ExpectedSystemID)
+	}
+
+	return fmt.Sprintf("segment holding %v was recycled, its page has address %v", e.Location, e.PageAddress)
+}
 
 // Page contains methods for reading values from a WAL page header and for detecting/reading a continuation
 type Page struct {
 	bs []byte
 }
 
+// NewPage reads a page from the bytes of a block, a block too short for a field reads it as zero
+func NewPage(block []byte) Page {
+	return Page{block}
+}
+
 // MagicValueIsValid indicates if a Page is correct or not
 func (p Page) MagicValueIsValid() bool {
-	return p.Is91() || p.Is94()
+	return IsKnownMagic(p.Magic())
 }
 
 // Magic returns the format version of the page
 func (p Page) Magic() uint16 {
-	return uint16(p.bs[1])<<8 + uint16(p.bs[0])
+	return uint16(p.field(0, 2))
 }
 
 // Is91 indicates if a Page is from version 9.1
 func (p Page) Is91() bool {
-	return p.Magic() == 0xD066
+	return p.Magic() == Magic91
 }
 
 // Is94 indicates if a Page is from version 9.4
 func (p Page) Is94() bool {
-	return p.Magic() == 0xD07E
+	return p.Magic() == Magic94
+}
+
+// Is95 indicates if a Page is from version 9.5 or later and holds records with block references
+func (p Page) Is95() bool {
+	return HasBlockReferences(p.Magic())
 }
 
 // Info can be used to determine if a page header is long (bit 2 is set) or if it contains a continuation (bit 1 is set)
 func (p Page) Info() uint16 {
-	return uint16(pg.LUint(p.bs[2:4]))
+	return uint16(p.field(2, 4))
 }
 
 // TimelineID is the timeline this page is found on
 func (p Page) TimelineID() uint32 {
-	return uint32(pg.LUint(p.bs[4:8]))
+	return uint32(p.field(4, 8))
 }
 
-// Location is the Location this page starts at
+// Location is the Location this page starts at, using the segment and block size of the header when it is long
 func (p Page) Location() Location {
+	var location Location
 	if p.Is91() {
-		return LocationFromUint32s(uint32(pg.LUint(p.bs[8:12])), uint32(pg.LUint(p.bs[12:16])))
+		location = LocationFromUint32s(uint32(p.field(8, 12)), uint32(p.field(12, 16)))
+	} else {
+		location = LocationFromUint32s(uint32(p.field(12, 16)), uint32(p.field(8, 12)))
 	}
 
-	return LocationFromUint32s(uint32(pg.LUint(p.bs[12:16])), uint32(pg.LUint(p.bs[8:12])))
+	return location.WithGeometry(p.SegmentSize(), p.BlockSize(), 0).SkippingLastSegment(SkipsLastSegment(p.Magic()))
 }
 
 // SystemID can be used to determine if a page was written by a particular server
 func (p Page) SystemID() uint64 {
 	if p.IsLong() {
-		return uint64(pg.LUint(p.bs[16:24]))
+		start := p.longFieldsStart()
+		return p.field(start, start+8)
 	}
 
 	return 0
@@ -62,7 +108,8 @@ func (p Page) SystemID() uint64 {
 // SegmentSize is the size in bytes of a single WAL file
 func (p Page) SegmentSize() uint32 {
 	if p.IsLong() {
-		return uint32(pg.LUint(p.bs[24:28]))
+		start := p.longFieldsStart() + 8
+		return uint32(p.field(start, start+4))
 	}
 
 	return 0
@@ -71,27 +118,71 @@ func (p Page) SegmentSize() uint32 {
 // BlockSize is the size of a page in a WAL file
 func (p Page) BlockSize() uint32 {
 	if p.IsLong() {
-		return uint32(pg.LUint(p.bs[28:32]))
+		start := p.longFieldsStart() + 12
+		return uint32(p.field(start, start+4))
 	}
 
 	return 0
 }
 
+// longFieldsStart is where the fields of a long header follow the short header, which is padded to the alignment
+// from 9.4 on where it ends with the length of the continuation
+func (p Page) longFieldsStart() int {
+	if p.Is91() {
+		return 16
+	}
+
+	return 24
+}
+
+// Validate checks that the page was written for the page at location by the system with the provided identifier.  A
+// zero system identifier is not checked.
+func (p Page) Validate(location Location, systemID uint64) error {
+	expected := location.StartOfPage()
+	address := p.Location()
+
+	if p.Magic() == 0 && address.Offset() == 0 {
+		return &PageNotWrittenError{expected, address}
+	}
+
+	if !p.MagicValueIsValid() {
+		return fmt.Errorf("page at %v has unknown magic value %.4X", expected, p.Magic())
+	}
+
+	if address.Offset() < expected.Offset() {
+		return &PageNotWrittenError{expected, address}
+	}
+
+	if address.Offset() > expected.Offset() {
+		return &RecycledSegmentError{expected, address, systemID, systemID}
+	}
+
+	if p.IsLong() && systemID != 0 && p.SystemID() != systemID {
+		return &RecycledSegmentError{expected, address, p.SystemID(), systemID}
+	}
+
+	return nil
+}
+
 // Continuation will return the bytes of a continuation of the previous record's body if present on the page
 func (p Page) Continuation() []byte {
 	if p.IsCont() {
 		var contStart, contEnd uint64
 
-		if p.Is94() {
+		if p.Is94() || p.Is95() {
 			contStart = p.HeaderLength()
-			contEnd = contStart + pg.LUint(p.bs[16:20])
+			contEnd = contStart + p.field(16, 20)
 		} else {
 			sizeOffset := p.HeaderLength()
 			contStart = sizeOffset + 4
-			contEnd = contStart + pg.LUint(p.bs[sizeOffset:contStart])
+			contEnd = contStart + p.field(int(sizeOffset), int(contStart))
 		}
 
 		maxContEnd := uint64(len(p.bs))
+		if contStart > maxContEnd {
+			return nil
+		}
+
 		if contEnd > maxContEnd {
 			contEnd = maxContEnd
 		}
@@ -102,6 +193,15 @@ func (p Page) Continuation() []byte {
 	return nil
 }
 
+// field reads the little endian value between start and end, a page too short to hold it reads as zero
+func (p Page) field(start, end int) uint64 {
+	if len(p.bs) < end {
+		return 0
+	}
+
+	return pg.LUint(p.bs[start:end])
+}
+
 // IsCont checks the page's info to see if it has a continuation record
 func (p Page) IsCont() bool {
 	return p.Info()&1 > 0
@@ -114,7 +214,7 @@ func (p Page) IsLong() bool {
 
 // HeaderLength returns the size in bytes of the portion of the page used for its header
 func (p Page) HeaderLength() uint64 {
-	if p.Is94() {
+	if p.Is94() || p.Is95() {
 		if p.IsLong() {
 			return 40
 		}
@@ -140,3 +140,28 @@ func continuationsMatch(a, b []byte) bool {
 
 	return true
 }
+
+func TestPageValidate(t *testing.T) {
+	location := NewLocationWithDefaults(0x0000000013002010)
+	written := Page{pageExpectations[1].bs}
+	if err := written.Validate(location, 0x55085653550bf6f3); err != nil {
+		t.Errorf("expected page to be valid but got %v", err)
+	}
+
+	if err, ok := (Page{make([]byte, 32)}).Validate(location, 0).(*PageNotWrittenError); !ok {
+		t.Errorf("expected zeroed page to not be written but got %v", err)
+	}
+
+	if err, ok := written.Validate(location.Add(0x01000000), 0).(*PageNotWrittenError); !ok {
+		t.Errorf("expected page from an earlier cycle to not be written but got %v", err)
+	}
+
+	if err, ok := written.Validate(location.Subtract(0x2000), 0).(*RecycledSegmentError); !ok {
+		t.Errorf("expected page from a later location to be recycled but got %v", err)
+	}
+
+	long := Page{pageExpectations[0].bs}
+	if err, ok := long.Validate(NewLocationWithDefaults(0x0000000013000000), 1).(*RecycledSegmentError); !ok {
+		t.Errorf("expected page from another system to be recycled but got %v", err)
+	}
+}
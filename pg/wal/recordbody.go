@@ -14,7 +14,10 @@ type RecordBody struct {
 
 // NewRecordBody creates a new RecordBody based on a RecordHeader
 func NewRecordBody(recordHeader *RecordHeader) *RecordBody {
-	whatsNeeded := uint64(recordHeader.TotalLength()) - recordHeader.AlignedSize()
+	var whatsNeeded uint64
+	if total := uint64(recordHeader.TotalLength()); total > recordHeader.AlignedSize() {
+		whatsNeeded = total - recordHeader.AlignedSize()
+	}
 
 	return &RecordBody{header: recordHeader, whatsNeeded: whatsNeeded, typ: recordHeader.Type()}
 }
@@ -34,7 +37,11 @@ func (r *RecordBody) AppendContinuation(page Page) uint64 {
 		return 0
 	}
 
-	r.bs = append(r.bs, cont...)
+	if len(r.bs) == 0 && r.header.spilled > 0 && r.header.spilled <= uint64(len(cont)) {
+		r.bs = append(r.bs, cont[r.header.spilled:]...)
+	} else {
+		r.bs = append(r.bs, cont...)
+	}
 
 	return uint64(len(cont))
 }
@@ -49,8 +56,72 @@ func (r *RecordBody) IsComplete() bool {
 }
 
 // HeapData interprets the body based on the type indicated in the record header
-func (r *RecordBody) HeapData() []HeapData {
-	return NewHeapData(r.typ, r.header.IsInit(), r.bs, r.header.version)
+func (r *RecordBody) HeapData() ([]HeapData, error) {
+	return NewHeapData(r.typ, r.header.IsInit(), r.MainData(), r.header.version)
+}
+
+// MainData is the resource manager data of the body.  Before 9.5 backup blocks follow it and are left off.
+func (r *RecordBody) MainData() []byte {
+	if !HasBlockReferences(r.header.version) && uint64(r.header.Length()) < uint64(len(r.bs)) {
+		return r.bs[:r.header.Length()]
+	}
+
+	return r.bs
+}
+
+// CommitData reads the body of a commit or abort record, it is nil for other records
+func (r *RecordBody) CommitData() (*CommitData, error) {
+	if r.typ != Commit && r.typ != Abort {
+		return nil, nil
+	}
+
+	return NewCommitData(r.header.Info(), r.MainData(), r.header.version)
+}
+
+// BackupBlocks are the full page images the record carries.  Before 9.5 they follow the main data.  The pages are the
+// size of the pages of the WAL they are read from.
+func (r *RecordBody) BackupBlocks() ([]BackupBlock, error) {
+	pageSize := int(r.header.readFrom.PageSize())
+	bs := r.complete()
+
+	if HasBlockReferences(r.header.version) {
+		record, err := NewBlockRecord(bs)
+		if err != nil {
+			return nil, err
+		}
+
+		return newBackupBlocks(record, pageSize), nil
+	}
+
+	if uint64(r.header.Length()) > uint64(len(bs)) {
+		return nil, shortRecordError("main data", int(r.header.Length()), len(bs))
+	}
+
+	return newBackupBlocks91(r.header.Info(), bs[r.header.Length():], pageSize)
+}
+
+// BlockReferences are the blocks a 9.5+ record references.  Records before 9.5 name what they change in their resource
+// manager data instead and have none.
+func (r *RecordBody) BlockReferences() ([]BlockReference, error) {
+	if !HasBlockReferences(r.header.version) {
+		return nil, nil
+	}
+
+	record, err := NewBlockRecord(r.complete())
+	if err != nil {
+		return nil, err
+	}
+
+	return record.Blocks, nil
+}
+
+// complete is the body without what was read past its end
+func (r *RecordBody) complete() []byte {
+	if uint64(len(r.bs)) > r.whatsNeeded {
+		return r.bs[:r.whatsNeeded]
+	}
+
+	return r.bs
 }
 
 func readBody(block []byte, location Location, length uint64) []byte {
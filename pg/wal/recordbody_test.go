@@ -65,8 +65,8 @@ func TestUnknownHeapData(t *testing.T) {
 	block, body := createBlock(alignedHeaderSize+numberSmallerThanEight, headerLocation)
 	bodyLocation := getLocationAt(pageSize - 8)
 	body.AppendBodyAfterHeader(block, bodyLocation)
-	if hd := body.HeapData(); hd != nil {
-		t.Fatalf("expected unknown heap data but found %v", hd)
+	if hd, err := body.HeapData(); err != nil || hd != nil {
+		t.Fatalf("expected unknown heap data but found %v (%v)", hd, err)
 	}
 }
 
@@ -109,7 +109,7 @@ func createBlock(totalLength uint32, readFrom Location) ([]byte, *RecordBody) {
 	block[offset+18] = byte((totalLength & 0x00ffffff) >> 16)
 	block[offset+19] = byte(totalLength >> 24)
 
-	header := NewRecordHeader(block, readFrom, 0xD066, blockReader{})
+	header, _ := NewRecordHeader(block, readFrom, 0xD066, blockReader{})
 
 	body := NewRecordBody(header)
 
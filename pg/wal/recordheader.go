@@ -4,7 +4,11 @@ package wal
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
-import "github.com/MediaMath/keryxlib/pg"
+import (
+	"fmt"
+
+	"github.com/MediaMath/keryxlib/pg"
+)
 
 // These constants describe the type of heap tuple found in the WAL
 const (
@@ -15,60 +19,85 @@ const (
 	Commit             // Commit describes a transaction being committed (either normally or compact)
 	Abort              // Abort describes a transaction being aborted
 	MultiInsert        // MultiInsert describes a block of tuples being inserted into a heap
+	Create             // Create describes the storage of a relation being created, which gives it a new relfilenode
+	Truncate           // Truncate describes the storage of a relation being truncated to a number of blocks
+	Drop               // Drop describes the storage of a relation being dropped when the transaction commits
 )
 
 // RecordType is a constant representing how an xlog record should be interpreted
 type RecordType uint8
 
+var recordTypeNames = []string{"unknown", "insert", "update", "delete", "commit", "abort", "multi insert", "create", "truncate", "drop"}
+
+func (t RecordType) String() string {
+	if int(t) < len(recordTypeNames) {
+		return recordTypeNames[t]
+	}
+
+	return fmt.Sprintf("record type %d", uint8(t))
+}
+
 // RecordHeader contains methods to read fields of an xlog record header
 type RecordHeader struct {
 	readFrom    Location
 	afterHeader Location
 	bs          []byte
 	version     uint16
+	spilled     uint64
 }
 
-// NewRecordHeader creates a new RecordHeader from a block and a location
-func NewRecordHeader(block []byte, location Location, version uint16, reader blockReader) *RecordHeader {
+// NewRecordHeader creates a new RecordHeader from a block and a location.  It is nil without an error when the header
+// continues on a page that holds no continuation, so there cannot be a record at the location.
+func NewRecordHeader(block []byte, location Location, version uint16, reader blockReader) (*RecordHeader, error) {
 	rh := &RecordHeader{readFrom: location, version: version}
 	start := location.FromStartOfPage()
 	end := start + rh.Size()
 
 	rh.afterHeader = location.Add(rh.Size()).Aligned()
 
+	if start > uint64(len(block)) {
+		return nil, fmt.Errorf("record header at %v starts after the end of its %v byte page", location, len(block))
+	}
+
 	if end > uint64(len(block)) {
-		if version == 0xD07E {
-			nextBlock := reader.readBlock(location.Add(rh.Size()))
-			nextPage := Page{nextBlock}
-
-			var newBlock []byte
-			newBlock = append(newBlock, block...)
-
-			if nextPage.IsCont() {
-				cont := nextPage.Continuation()
-				newBlock = append(newBlock, cont...)
-				rh.afterHeader = location.Add(rh.Size()).Add(nextPage.HeaderLength()).Add(8).Aligned()
-			} else {
-				return nil
-			}
-			block = newBlock
-		} else {
-			return nil
+		if version == Magic91 {
+			return nil, nil
+		}
+
+		nextBlock, err := reader.readBlock(location.Add(rh.Size()))
+		if err != nil {
+			return nil, err
+		}
+
+		nextPage := Page{nextBlock}
+		if !nextPage.IsCont() {
+			return nil, nil
+		}
+
+		// the header continues after the header of the next page, in 9.4 together with the padding that aligns it
+		rh.spilled = start + rh.AlignedSize() - uint64(len(block))
+		rh.afterHeader = location.Add(rh.AlignedSize()).Add(nextPage.HeaderLength())
+		block = append(append([]byte{}, block...), nextPage.Continuation()...)
+
+		if end > uint64(len(block)) {
+			return nil, nil
 		}
 	}
 
 	rh.bs = block[start:end]
 
-	return rh
+	return rh, nil
 }
 
 // Crc is the crc of the record
 func (r RecordHeader) Crc() uint32 {
 	switch r.version {
-	case 0xD066:
+	case Magic91:
 		return uint32(pg.LUint(r.bs[0:4]))
-	case 0xD07E:
+	case Magic94:
 		return uint32(pg.LUint(r.bs[24:28]))
+	case Magic95, Magic96, Magic10:
+		return uint32(pg.LUint(r.bs[20:24]))
 	}
 
 	return 0
@@ -77,10 +106,12 @@ func (r RecordHeader) Crc() uint32 {
 // Previous is the location of the record that preceeds this one
 func (r RecordHeader) Previous() Location {
 	switch r.version {
-	case 0xD066:
-		return LocationFromUint32s(uint32(pg.LUint(r.bs[4:8])), uint32(pg.LUint(r.bs[8:12])))
-	case 0xD07E:
-		return LocationFromUint32s(uint32(pg.LUint(r.bs[20:24])), uint32(pg.LUint(r.bs[16:20])))
+	case Magic91:
+		return r.readFrom.AtUint32s(uint32(pg.LUint(r.bs[4:8])), uint32(pg.LUint(r.bs[8:12])))
+	case Magic94:
+		return r.readFrom.AtUint32s(uint32(pg.LUint(r.bs[20:24])), uint32(pg.LUint(r.bs[16:20])))
+	case Magic95, Magic96, Magic10:
+		return r.readFrom.AtUint32s(uint32(pg.LUint(r.bs[12:16])), uint32(pg.LUint(r.bs[8:12])))
 	}
 
 	return Location{}
@@ -89,9 +120,11 @@ func (r RecordHeader) Previous() Location {
 // TransactionID is the transaction that this record is apart of
 func (r RecordHeader) TransactionID() uint32 {
 	switch r.version {
-	case 0xD066:
+	case Magic91:
 		return uint32(pg.LUint(r.bs[12:16]))
-	case 0xD07E:
+	case Magic94:
+		return uint32(pg.LUint(r.bs[4:8]))
+	case Magic95, Magic96, Magic10:
 		return uint32(pg.LUint(r.bs[4:8]))
 	}
 
@@ -101,9 +134,11 @@ func (r RecordHeader) TransactionID() uint32 {
 // TotalLength is the length of the body after the header but before the next record
 func (r RecordHeader) TotalLength() uint32 {
 	switch r.version {
-	case 0xD066:
+	case Magic91:
 		return uint32(pg.LUint(r.bs[16:20]))
-	case 0xD07E:
+	case Magic94:
+		return uint32(pg.LUint(r.bs[0:4]))
+	case Magic95, Magic96, Magic10:
 		return uint32(pg.LUint(r.bs[0:4]))
 	}
 
@@ -113,10 +148,15 @@ func (r RecordHeader) TotalLength() uint32 {
 // Length is the length of resource manager specific data after the header
 func (r RecordHeader) Length() uint32 {
 	switch r.version {
-	case 0xD066:
+	case Magic91:
 		return uint32(pg.LUint(r.bs[20:24]))
-	case 0xD07E:
+	case Magic94:
 		return uint32(pg.LUint(r.bs[8:12]))
+	case Magic95, Magic96, Magic10:
+		if uint64(r.TotalLength()) < r.Size() {
+			return 0
+		}
+		return r.TotalLength() - uint32(r.Size())
 	}
 
 	return 0
@@ -125,10 +165,12 @@ func (r RecordHeader) Length() uint32 {
 // Info contains resource manager specific data
 func (r RecordHeader) Info() uint8 {
 	switch r.version {
-	case 0xD066:
+	case Magic91:
 		return uint8(pg.LUint(r.bs[24:25]))
-	case 0xD07E:
+	case Magic94:
 		return uint8(pg.LUint(r.bs[12:13]))
+	case Magic95, Magic96, Magic10:
+		return uint8(pg.LUint(r.bs[16:17]))
 	}
 
 	return 0
@@ -137,10 +179,12 @@ func (r RecordHeader) Info() uint8 {
 // ResourceManagerID is the ID of the resource manager that created this record
 func (r RecordHeader) ResourceManagerID() uint8 {
 	switch r.version {
-	case 0xD066:
+	case Magic91:
 		return uint8(pg.LUint(r.bs[25:26]))
-	case 0xD07E:
+	case Magic94:
 		return uint8(pg.LUint(r.bs[13:14]))
+	case Magic95, Magic96, Magic10:
+		return uint8(pg.LUint(r.bs[17:18]))
 	}
 
 	return 0
@@ -154,9 +198,16 @@ func (r RecordHeader) Type() RecordType {
 	case 0x0100:
 		return Commit
 	case 0x0160:
+		if HasBlockReferences(r.version) {
+			return Unknown
+		}
 		return Commit // COMPACT
 	case 0x0120:
 		return Abort
+	case 0x0210:
+		return Create
+	case 0x0220:
+		return Truncate
 	case 0x0950:
 		return MultiInsert
 	case 0x0A00:
@@ -180,15 +231,30 @@ func (r RecordHeader) IsInit() bool {
 // Size will return the size of the header
 func (r RecordHeader) Size() uint64 {
 	switch r.version {
-	case 0xD066:
+	case Magic91:
 		return 26
-	case 0xD07E:
+	case Magic94:
 		return 28
+	case Magic95, Magic96, Magic10:
+		return 24
 	}
 
 	return 0
 }
 
+// checkLength fails for a header whose total length does not cover the header itself.  A header of zeroes is one that
+// is not written yet.
+func (r RecordHeader) checkLength() error {
+	total := uint64(r.TotalLength())
+	if total == 0 {
+		return fmt.Errorf("%w: its header is not written yet", ErrIncompleteRecord)
+	} else if total < r.AlignedSize() {
+		return fmt.Errorf("total length of %v is shorter than the %v byte header", total, r.AlignedSize())
+	}
+
+	return nil
+}
+
 // AlignedSize will return the size of the header plus alignment
 func (r RecordHeader) AlignedSize() uint64 {
 	return r.readFrom.Aligned().Add(r.Size()).Aligned().Difference(r.readFrom.Aligned())
@@ -9,7 +9,7 @@ import "testing"
 func TestRecordHeaderExpectations(t *testing.T) {
 	readFrom := NewLocationWithDefaults(0)
 	for _, exp := range recordHeaderExpectations {
-		act := RecordHeader{readFrom, readFrom, exp.bs, 0xD066}
+		act := RecordHeader{readFrom: readFrom, afterHeader: readFrom, bs: exp.bs, version: Magic91}
 		failIfRecordHeaderNotMatching(t, exp, act)
 	}
 }
@@ -102,3 +102,19 @@ func failIfRecordHeaderNotMatching(t *testing.T, exp recordHeaderExpectation, ac
 		t.Errorf("(%.8x) expected %v but got %v for type", exp.crc, exp.typ, act.Type())
 	}
 }
+
+func TestBlockRecordHeaderExpectations(t *testing.T) {
+	readFrom := NewLocationWithDefaults(0)
+	for _, exp := range blockRecordHeaderExpectations {
+		act := RecordHeader{readFrom: readFrom, afterHeader: readFrom, bs: exp.bs, version: Magic95}
+		failIfRecordHeaderNotMatching(t, exp, act)
+	}
+}
+
+var blockRecordHeaderExpectations = []recordHeaderExpectation{
+	{0xcc96e6f4, NewLocationWithDefaults(0x038cec48), 1998, 64, 40, 0x00, 0x0a, Insert, []byte{0x40, 0x00, 0x00, 0x00, 0xce, 0x07, 0x00, 0x00, 0x48, 0xec, 0x8c, 0x03, 0x00, 0x00, 0x00, 0x00, 0x00, 0x0a, 0x00, 0x00, 0xf4, 0xe6, 0x96, 0xcc}},
+	{0xe0e7c392, NewLocationWithDefaults(0x0000000103000028), 1998, 82, 58, 0x20, 0x0a, Update, []byte{0x52, 0x00, 0x00, 0x00, 0xce, 0x07, 0x00, 0x00, 0x28, 0x00, 0x00, 0x03, 0x01, 0x00, 0x00, 0x00, 0x20, 0x0a, 0x00, 0x00, 0x92, 0xc3, 0xe7, 0xe0}},
+	{0x347dcac4, NewLocationWithDefaults(0x038cefa8), 1998, 46, 22, 0x80, 0x01, Commit, []byte{0x2e, 0x00, 0x00, 0x00, 0xce, 0x07, 0x00, 0x00, 0xa8, 0xef, 0x8c, 0x03, 0x00, 0x00, 0x00, 0x00, 0x80, 0x01, 0x00, 0x00, 0xc4, 0xca, 0x7d, 0x34}},
+	{0x088f8a57, NewLocationWithDefaults(0x038ceff0), 1998, 32, 8, 0x60, 0x01, Unknown, []byte{0x20, 0x00, 0x00, 0x00, 0xce, 0x07, 0x00, 0x00, 0xf0, 0xef, 0x8c, 0x03, 0x00, 0x00, 0x00, 0x00, 0x60, 0x01, 0x00, 0x00, 0x57, 0x8a, 0x8f, 0x08}},
+	{0x02623978, NewLocationWithDefaults(0x038cf088), 1999, 60, 36, 0x50, 0x09, MultiInsert, []byte{0x3c, 0x00, 0x00, 0x00, 0xcf, 0x07, 0x00, 0x00, 0x88, 0xf0, 0x8c, 0x03, 0x00, 0x00, 0x00, 0x00, 0x50, 0x09, 0x00, 0x00, 0x78, 0x39, 0x62, 0x02}},
+}
@@ -0,0 +1,50 @@
+package wal
+
+// Copyright 2015 MediaMath <http://www.mediamath.com>.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+import "errors"
+
+// MissingSegment returns the location of the first byte of the segment an error from reading the WAL failed to open
+func (c Cursor) MissingSegment(err error) (Location, bool) {
+	var missing *SegmentMissingError
+	if !errors.As(err, &missing) {
+		return Location{}, false
+	}
+
+	name := missing.Segment
+	return c.location.At(name.Offset(c.location.FileSize())).OnTimeline(name.TimelineID), true
+}
+
+// SegmentBounds returns the locations of the first bytes of the oldest and newest segments the cursor can read,
+// whatever their timeline is
+func (c Cursor) SegmentBounds() (oldest Location, newest Location, ok bool, err error) {
+	names, err := c.reader.segments().SegmentNames()
+	if err != nil {
+		return
+	}
+
+	for _, name := range names {
+		segment := c.location.At(name.Offset(c.location.FileSize())).OnTimeline(name.TimelineID)
+		if !ok || segment.Offset() < oldest.Offset() {
+			oldest = segment
+		}
+		if !ok || segment.Offset() > newest.Offset() {
+			newest = segment
+		}
+		ok = true
+	}
+
+	return
+}
+
+// WithSource returns the same cursor reading segments from another source
+func (c Cursor) WithSource(source SegmentSource) Cursor {
+	c.reader.source = source
+	if c.reader.cache != nil {
+		c.reader.cache = newDefaultBlockCache()
+	}
+
+	return c
+}
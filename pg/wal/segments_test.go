@@ -0,0 +1,60 @@
+package wal
+
+// Copyright 2015 MediaMath <http://www.mediamath.com>.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseSegmentName(t *testing.T) {
+	name, ok := ParseSegmentName("000000020000000100000013")
+	if !ok || name != (SegmentName{2, 1, 0x13}) || name.Offset(16*1024*1024) != 0x113000000 {
+		t.Errorf("expected timeline 2 at 0x113000000 but got %+v (%v)", name, ok)
+	}
+
+	if name.String() != "000000020000000100000013" {
+		t.Errorf("expected name to round trip but got %v", name)
+	}
+
+	for _, filename := range []string{"00000002.history", "000000020000000100000013.partial", "00000002000000010000001G"} {
+		if _, ok := ParseSegmentName(filename); ok {
+			t.Errorf("expected %v to not be a segment", filename)
+		}
+	}
+}
+
+func TestSegmentBoundsAndMissingSegment(t *testing.T) {
+	dir, err := ioutil.TempDir("", "segments")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"000000010000000000000014", "000000010000000000000013", "000000020000000000000015", "00000002.history"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cursor := Cursor{NewLocationWithDefaults(0x12000010), blockReader{walDirPath: dir}}
+
+	oldest, newest, ok, err := cursor.SegmentBounds()
+	if err != nil || !ok {
+		t.Fatalf("expected segments but got %v", err)
+	}
+
+	if oldest.Filename() != "000000010000000000000013" || newest.Filename() != "000000020000000000000015" {
+		t.Errorf("expected segments 13 to 15 but got %v to %v", oldest.Filename(), newest.Filename())
+	}
+
+	_, err = cursor.reader.readBlock(cursor.location)
+	missing, ok := cursor.MissingSegment(err)
+	if !ok || missing.Offset() != 0x12000000 || missing.Filename() != "000000010000000000000012" {
+		t.Errorf("expected missing segment 12 but got %v (%v)", missing.Filename(), ok)
+	}
+}
@@ -0,0 +1,128 @@
+package wal
+
+// Copyright 2015 MediaMath <http://www.mediamath.com>.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+import (
+	"fmt"
+
+	"github.com/MediaMath/keryxlib/pg"
+)
+
+// These constants are the sizes of the fields every version starts the smgr records with
+const (
+	sizeOfSmgrCreate   = 16
+	sizeOfSmgrTruncate = 16
+	sizeOfRelFileNode  = 12
+)
+
+// RelFileNode identifies the storage of a relation, which a rewrite of the relation replaces with new storage
+type RelFileNode struct {
+	TablespaceID uint32
+	DatabaseID   uint32
+	RelationID   uint32
+}
+
+func newRelFileNode(bs []byte) RelFileNode {
+	return RelFileNode{uint32(pg.LUint(bs[0:4])), uint32(pg.LUint(bs[4:8])), uint32(pg.LUint(bs[8:12]))}
+}
+
+func (r RelFileNode) String() string {
+	return fmt.Sprintf("%v/%v/%v", r.TablespaceID, r.DatabaseID, r.RelationID)
+}
+
+// newSmgrData reads the relation a create or truncate record of the storage manager is about.  From 9.5 on the
+// records have no block references and their data is the main data.
+func newSmgrData(recordType RecordType, data []byte, version uint16) ([]HeapData, error) {
+	if HasBlockReferences(version) {
+		record, err := NewBlockRecord(data)
+		if err != nil {
+			return nil, err
+		}
+		data = record.MainData
+	}
+
+	if recordType == Create {
+		if len(data) < sizeOfSmgrCreate {
+			return nil, shortRecordError("create", sizeOfSmgrCreate, len(data))
+		}
+		return []HeapData{SmgrCreateData(data)}, nil
+	}
+
+	if len(data) < sizeOfSmgrTruncate {
+		return nil, shortRecordError("truncate", sizeOfSmgrTruncate, len(data))
+	}
+	return []HeapData{SmgrTruncateData(data)}, nil
+}
+
+// SmgrCreateData reads the relfilenode and fork of new storage of a relation
+type SmgrCreateData []byte
+
+// TablespaceID is the id of the tablespace the storage is created in
+func (d SmgrCreateData) TablespaceID() uint32 { return uint32(pg.LUint(d[0:4])) }
+
+// DatabaseID is the id of the database the storage is created in
+func (d SmgrCreateData) DatabaseID() uint32 { return uint32(pg.LUint(d[4:8])) }
+
+// RelationID is the relfilenode of the new storage
+func (d SmgrCreateData) RelationID() uint32 { return uint32(pg.LUint(d[8:12])) }
+
+// ForkNumber is the fork of the relation that is created, 0 is the main fork
+func (d SmgrCreateData) ForkNumber() uint8 { return uint8(pg.LUint(d[12:16])) }
+
+// FromBlock is not available for creates
+func (d SmgrCreateData) FromBlock() uint32 { return 0 }
+
+// FromOffset is not available for creates
+func (d SmgrCreateData) FromOffset() uint16 { return 0 }
+
+// ToBlock is not available for creates
+func (d SmgrCreateData) ToBlock() uint32 { return 0 }
+
+// ToOffset is not available for creates
+func (d SmgrCreateData) ToOffset() uint16 { return 0 }
+
+// NewTuple is not available for creates
+func (d SmgrCreateData) NewTuple() TupleData { return nil }
+
+// OldTuple is not available for creates
+func (d SmgrCreateData) OldTuple() TupleData { return nil }
+
+func (d SmgrCreateData) String() string {
+	return fmt.Sprintf("Create of %v/%v/%v fork %v", d.TablespaceID(), d.DatabaseID(), d.RelationID(), d.ForkNumber())
+}
+
+// SmgrTruncateData reads the relfilenode of a relation truncated in place and the number of blocks it is left with
+type SmgrTruncateData []byte
+
+// TablespaceID is the id of the tablespace of the truncated relation
+func (d SmgrTruncateData) TablespaceID() uint32 { return uint32(pg.LUint(d[4:8])) }
+
+// DatabaseID is the id of the database of the truncated relation
+func (d SmgrTruncateData) DatabaseID() uint32 { return uint32(pg.LUint(d[8:12])) }
+
+// RelationID is the relfilenode of the truncated relation
+func (d SmgrTruncateData) RelationID() uint32 { return uint32(pg.LUint(d[12:16])) }
+
+// FromBlock is not available for truncates
+func (d SmgrTruncateData) FromBlock() uint32 { return 0 }
+
+// FromOffset is not available for truncates
+func (d SmgrTruncateData) FromOffset() uint16 { return 0 }
+
+// ToBlock is the number of blocks the relation is truncated to, 0 when it is emptied
+func (d SmgrTruncateData) ToBlock() uint32 { return uint32(pg.LUint(d[0:4])) }
+
+// ToOffset is not available for truncates
+func (d SmgrTruncateData) ToOffset() uint16 { return 0 }
+
+// NewTuple is not available for truncates
+func (d SmgrTruncateData) NewTuple() TupleData { return nil }
+
+// OldTuple is not available for truncates
+func (d SmgrTruncateData) OldTuple() TupleData { return nil }
+
+func (d SmgrTruncateData) String() string {
+	return fmt.Sprintf("Truncate of %v/%v/%v to %v blocks", d.TablespaceID(), d.DatabaseID(), d.RelationID(), d.ToBlock())
+}
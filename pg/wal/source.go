@@ -0,0 +1,321 @@
+package wal
+
+// Copyright 2015 MediaMath <http://www.mediamath.com>.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/MediaMath/keryxlib/pg"
+	"github.com/MediaMath/keryxlib/pg/control"
+)
+
+// SegmentName identifies a WAL segment by the parts of its file name
+type SegmentName struct {
+	TimelineID uint32
+	LogID      uint32
+	Segment    uint32
+}
+
+// ParseSegmentName reads a segment name from a file name like 000000010000000000000013
+func ParseSegmentName(filename string) (SegmentName, bool) {
+	if len(filename) != 24 {
+		return SegmentName{}, false
+	}
+
+	var parts [3]uint32
+	for i := range parts {
+		part, err := strconv.ParseUint(filename[i*8:i*8+8], 16, 32)
+		if err != nil {
+			return SegmentName{}, false
+		}
+		parts[i] = uint32(part)
+	}
+
+	return SegmentName{parts[0], parts[1], parts[2]}, true
+}
+
+// String is the file name of the segment
+func (n SegmentName) String() string {
+	return fmt.Sprintf("%.8X%.8X%.8X", n.TimelineID, n.LogID, n.Segment)
+}
+
+// Offset is the location of the first byte of the segment for a segment size
+func (n SegmentName) Offset(segmentSize uint32) uint64 {
+	return uint64(n.LogID)<<32 + uint64(n.Segment)*uint64(segmentSize)
+}
+
+// Segment is an open WAL segment, pages are read from it with ReadAt
+type Segment interface {
+	io.ReaderAt
+	io.Closer
+}
+
+// SegmentSource finds the WAL segments a cursor reads.  OpenSegment returns an error satisfying os.IsNotExist when
+// the source does not have the segment.
+type SegmentSource interface {
+	OpenSegment(name SegmentName) (Segment, error)
+	SegmentNames() ([]SegmentName, error)
+}
+
+func segmentNotExist(dir string, name SegmentName) error {
+	return &os.PathError{Op: "open", Path: filepath.Join(dir, name.String()), Err: os.ErrNotExist}
+}
+
+// dirSource reads segments from a WAL directory as postgres writes them
+type dirSource string
+
+// NewDirectorySource reads segments from a WAL directory like pg_xlog
+func NewDirectorySource(walDirPath string) SegmentSource {
+	return dirSource(walDirPath)
+}
+
+// NewDataDirSource reads segments from the WAL directory of a data directory, which is pg_wal from 10 on and pg_xlog
+// before that
+func NewDataDirSource(dataDir string) (SegmentSource, error) {
+	control, err := control.NewControlFromDataDir(dataDir)
+	if err != nil {
+		return nil, err
+	}
+
+	return dirSource(pg.WalDirectory(dataDir, control.Version)), nil
+}
+
+func (d dirSource) OpenSegment(name SegmentName) (Segment, error) {
+	return os.Open(filepath.Join(string(d), name.String()))
+}
+
+func (d dirSource) SegmentNames() ([]SegmentName, error) {
+	return segmentNamesInDir(string(d), nil)
+}
+
+func segmentNamesInDir(dir string, extensions []string) ([]SegmentName, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []SegmentName
+	for _, info := range infos {
+		if info.IsDir() {
+			continue
+		}
+
+		filename := info.Name()
+		for _, extension := range extensions {
+			filename = strings.TrimSuffix(filename, extension)
+		}
+
+		if name, ok := ParseSegmentName(filename); ok {
+			names = append(names, name)
+		}
+	}
+
+	return names, nil
+}
+
+// archiveSource reads segments from a directory archive_command copies them to, they can be plain, gzipped or
+// compressed with zstd.  The last decompressed segment is kept as a segment is read a page at a time.
+type archiveSource struct {
+	dir string
+
+	lock     sync.Mutex
+	lastName SegmentName
+	last     []byte
+}
+
+var archiveExtensions = []string{"", ".gz", ".zst"}
+
+// NewArchiveSource reads segments from an archive directory, as they are or compressed with gzip or zstd
+func NewArchiveSource(dir string) SegmentSource {
+	return &archiveSource{dir: dir}
+}
+
+func (a *archiveSource) OpenSegment(name SegmentName) (Segment, error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if a.last != nil && a.lastName == name {
+		return nopCloser{bytes.NewReader(a.last)}, nil
+	}
+
+	for _, extension := range archiveExtensions {
+		file, err := os.Open(filepath.Join(a.dir, name.String()+extension))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		if extension == "" {
+			return file, nil
+		}
+
+		bs, err := decompress(file, extension)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress %v%v: %v", name, extension, err)
+		}
+
+		a.lastName, a.last = name, bs
+		return nopCloser{bytes.NewReader(bs)}, nil
+	}
+
+	return nil, segmentNotExist(a.dir, name)
+}
+
+func (a *archiveSource) SegmentNames() ([]SegmentName, error) {
+	return segmentNamesInDir(a.dir, archiveExtensions[1:])
+}
+
+func decompress(r io.Reader, extension string) ([]byte, error) {
+	switch extension {
+	case ".gz":
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+
+		return ioutil.ReadAll(gz)
+
+	case ".zst":
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+
+		return ioutil.ReadAll(zr)
+	}
+
+	return ioutil.ReadAll(r)
+}
+
+// MemorySource holds segments in memory, which is useful for feeding synthetic WAL to a cursor
+type MemorySource struct {
+	lock     sync.RWMutex
+	segments map[SegmentName][]byte
+}
+
+// NewMemorySource creates an empty MemorySource
+func NewMemorySource() *MemorySource {
+	return &MemorySource{segments: make(map[SegmentName][]byte)}
+}
+
+// Add stores the contents of a segment, replacing what was stored for it before
+func (m *MemorySource) Add(name SegmentName, bs []byte) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.segments[name] = bs
+}
+
+// Remove forgets a segment
+func (m *MemorySource) Remove(name SegmentName) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	delete(m.segments, name)
+}
+
+// OpenSegment opens a stored segment
+func (m *MemorySource) OpenSegment(name SegmentName) (Segment, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	bs, ok := m.segments[name]
+	if !ok {
+		return nil, segmentNotExist("", name)
+	}
+
+	return nopCloser{bytes.NewReader(bs)}, nil
+}
+
+// SegmentNames lists the stored segments
+func (m *MemorySource) SegmentNames() ([]SegmentName, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	var names []SegmentName
+	for name := range m.segments {
+		names = append(names, name)
+	}
+
+	return names, nil
+}
+
+// multiSource reads a segment from the first of its sources that has it
+type multiSource []SegmentSource
+
+// NewMultiSource reads a segment from the first of the sources that has it
+func NewMultiSource(sources ...SegmentSource) SegmentSource {
+	return multiSource(sources)
+}
+
+func (m multiSource) OpenSegment(name SegmentName) (Segment, error) {
+	var notFound error
+	for _, source := range m {
+		segment, err := source.OpenSegment(name)
+		if err == nil {
+			return segment, nil
+		} else if !os.IsNotExist(err) {
+			return nil, err
+		} else if notFound == nil {
+			notFound = err
+		}
+	}
+
+	if notFound == nil {
+		notFound = segmentNotExist("", name)
+	}
+
+	return nil, notFound
+}
+
+func (m multiSource) SegmentNames() ([]SegmentName, error) {
+	var names []SegmentName
+	for _, source := range m {
+		sourceNames, err := source.SegmentNames()
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		names = append(names, sourceNames...)
+	}
+
+	return names, nil
+}
+
+// newSegmentSource reads segments from the WAL directory first and then from the archive directories in order
+func newSegmentSource(walDirPath string, archiveDirs []string) SegmentSource {
+	if len(archiveDirs) == 0 {
+		return dirSource(walDirPath)
+	}
+
+	sources := multiSource{dirSource(walDirPath)}
+	for _, dir := range archiveDirs {
+		sources = append(sources, NewArchiveSource(dir))
+	}
+
+	return sources
+}
+
+type nopCloser struct {
+	*bytes.Reader
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
@@ -0,0 +1,117 @@
+package wal
+
+// Copyright 2015 MediaMath <http://www.mediamath.com>.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func segmentWithPageAt(location Location) []byte {
+	segment := make([]byte, 0x4000)
+	page := segment[location.StartOfPage().FromStartOfFile():]
+	copy(page, pageExpectations[1].bs)
+	binary.LittleEndian.PutUint32(page[8:12], location.LogID())
+	binary.LittleEndian.PutUint32(page[12:16], uint32(location.StartOfPage().Offset()))
+	return segment
+}
+
+func TestReadBlockFromArchives(t *testing.T) {
+	dir, err := ioutil.TempDir("", "source")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	walDir, gzDir, zstDir := filepath.Join(dir, "pg_xlog"), filepath.Join(dir, "gz"), filepath.Join(dir, "zst")
+	for _, d := range []string{walDir, gzDir, zstDir} {
+		if err := os.Mkdir(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	live := NewLocationWithDefaults(0x13002010)
+	gzipped := NewLocationWithDefaults(0x12002010)
+	zstded := NewLocationWithDefaults(0x11002010)
+
+	if err := ioutil.WriteFile(filepath.Join(walDir, live.Filename()), segmentWithPageAt(live), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var gzBuffer bytes.Buffer
+	gz := gzip.NewWriter(&gzBuffer)
+	gz.Write(segmentWithPageAt(gzipped))
+	gz.Close()
+	if err := ioutil.WriteFile(filepath.Join(gzDir, gzipped.Filename()+".gz"), gzBuffer.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var zstBuffer bytes.Buffer
+	zw, err := zstd.NewWriter(&zstBuffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw.Write(segmentWithPageAt(zstded))
+	zw.Close()
+	if err := ioutil.WriteFile(filepath.Join(zstDir, zstded.Filename()+".zst"), zstBuffer.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	reader := blockReader{walDirPath: walDir, blockSize: 0x2000, wordSize: 8, source: newSegmentSource(walDir, []string{gzDir, zstDir})}
+	for _, location := range []Location{live, gzipped, zstded, zstded} {
+		block, err := reader.readBlock(location)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if page := (Page{block}); page.Location().Offset() != location.StartOfPage().Offset() {
+			t.Errorf("expected page at %v but got %v", location.StartOfPage(), page.Location())
+		}
+	}
+
+	cursor := Cursor{live, reader}
+	oldest, newest, ok, err := cursor.SegmentBounds()
+	if err != nil || !ok || oldest.Offset() != 0x11000000 || newest.Offset() != 0x13000000 {
+		t.Errorf("expected archived segments in bounds but got %v to %v (%v, %v)", oldest, newest, ok, err)
+	}
+
+	_, err = reader.segments().OpenSegment(NewLocationWithDefaults(0x10000000).SegmentName())
+	if !os.IsNotExist(err) {
+		t.Errorf("expected segment to not exist but got %v", err)
+	}
+}
+
+func TestReadBlockFromMemory(t *testing.T) {
+	memory := NewMemorySource()
+	location := NewLocationWithDefaults(0x13002010)
+	memory.Add(location.SegmentName(), segmentWithPageAt(location))
+
+	cursor := Cursor{location, blockReader{blockSize: 0x2000, wordSize: 8}}.WithSource(NewMultiSource(NewDirectorySource("/nonexistent"), memory))
+	block, err := cursor.reader.readBlock(location)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if page := (Page{block}); page.Location().Offset() != 0x13002000 {
+		t.Errorf("expected page at 0x13002000 but got %v", page.Location())
+	}
+
+	memory.Remove(location.SegmentName())
+	if _, err := cursor.reader.segments().OpenSegment(location.SegmentName()); !os.IsNotExist(err) {
+		t.Errorf("expected removed segment to not exist but got %v", err)
+	}
+
+	_, err = cursor.reader.readBlock(location)
+	if missing, ok := cursor.MissingSegment(err); !ok || missing.Offset() != 0x13000000 {
+		t.Errorf("expected missing segment at 0x13000000 but got %v", missing)
+	}
+}
@@ -0,0 +1,212 @@
+package wal
+
+// Copyright 2015 MediaMath <http://www.mediamath.com>.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// TimelineSwitch is a line of a timeline history file, the parent timeline was left for a child at the switch point
+type TimelineSwitch struct {
+	Parent      uint32
+	SwitchPoint uint64
+}
+
+// ParseTimelineHistory reads the contents of a timeline history file.  From 9.3 on the switch point is a location
+// like 0/3000090, before that it is the name of the segment the switch happened in which is read as the start of
+// that segment.
+func ParseTimelineHistory(bs []byte, segmentSize uint32) ([]TimelineSwitch, error) {
+	var history []TimelineSwitch
+
+	scanner := bufio.NewScanner(bytes.NewReader(bs))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("timeline history line %q has no switch point", line)
+		}
+
+		parent, err := strconv.ParseUint(fields[0], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("timeline history line %q has an invalid timeline: %v", line, err)
+		}
+
+		switchPoint, err := parseSwitchPoint(fields[1], segmentSize)
+		if err != nil {
+			return nil, fmt.Errorf("timeline history line %q has an invalid switch point: %v", line, err)
+		}
+
+		if len(history) > 0 && (uint32(parent) <= history[len(history)-1].Parent || switchPoint < history[len(history)-1].SwitchPoint) {
+			return nil, fmt.Errorf("timeline history line %q is out of order", line)
+		}
+
+		history = append(history, TimelineSwitch{uint32(parent), switchPoint})
+	}
+
+	return history, scanner.Err()
+}
+
+func parseSwitchPoint(s string, segmentSize uint32) (uint64, error) {
+	if parts := strings.Split(s, "/"); len(parts) == 2 {
+		high, err := strconv.ParseUint(parts[0], 16, 32)
+		if err != nil {
+			return 0, err
+		}
+
+		low, err := strconv.ParseUint(parts[1], 16, 32)
+		if err != nil {
+			return 0, err
+		}
+
+		return high<<32 + low, nil
+	}
+
+	if len(s) == 24 {
+		logID, err := strconv.ParseUint(s[8:16], 16, 32)
+		if err != nil {
+			return 0, err
+		}
+
+		segmentID, err := strconv.ParseUint(s[16:24], 16, 32)
+		if err != nil {
+			return 0, err
+		}
+
+		return logID<<32 + segmentID*uint64(segmentSize), nil
+	}
+
+	return 0, fmt.Errorf("%q is neither a location nor a segment name", s)
+}
+
+// Timelines knows which timeline holds a location by following the history of the latest timeline of a WAL
+// directory
+type Timelines struct {
+	walDirPath  string
+	segmentSize uint32
+	latest      uint32
+	history     []TimelineSwitch
+}
+
+// NewTimelines finds the latest timeline descending from the provided timeline in a WAL directory and reads its history
+func NewTimelines(walDirPath string, timeline uint32, segmentSize uint32) (*Timelines, error) {
+	t := &Timelines{walDirPath: walDirPath, segmentSize: segmentSize}
+	if err := t.switchTo(timeline); err != nil {
+		return nil, err
+	}
+
+	infos, err := ioutil.ReadDir(walDirPath)
+	if os.IsNotExist(err) {
+		return t, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var candidates []uint32
+	for _, info := range infos {
+		if child, ok := historyFileTimeline(info.Name()); ok && child > timeline {
+			candidates = append(candidates, child)
+		}
+	}
+
+	for _, child := range candidates {
+		if child > t.latest {
+			t.followIfDescendant(child)
+		}
+	}
+
+	return t, nil
+}
+
+// Latest is the newest timeline known to descend from the timeline streaming started on
+func (t *Timelines) Latest() uint32 {
+	return t.latest
+}
+
+// TimelineAt is the timeline the latest timeline got the location from
+func (t *Timelines) TimelineAt(offset uint64) uint32 {
+	for _, s := range t.history {
+		if offset < s.SwitchPoint {
+			return s.Parent
+		}
+	}
+
+	return t.latest
+}
+
+// Refresh looks for history files of timelines following the latest one and switches to the ones descending from it,
+// it returns true when the latest timeline changed
+func (t *Timelines) Refresh() bool {
+	changed := false
+	for child := t.latest + 1; t.historyExists(child); child++ {
+		changed = t.followIfDescendant(child) || changed
+	}
+
+	return changed
+}
+
+func (t *Timelines) historyExists(timeline uint32) bool {
+	_, err := os.Stat(t.historyPath(timeline))
+	return err == nil
+}
+
+func (t *Timelines) followIfDescendant(child uint32) bool {
+	history, err := t.readHistory(child)
+	if err != nil {
+		return false
+	}
+
+	for _, s := range history {
+		if s.Parent == t.latest {
+			t.latest, t.history = child, history
+			return true
+		}
+	}
+
+	return false
+}
+
+func (t *Timelines) switchTo(timeline uint32) error {
+	history, err := t.readHistory(timeline)
+	// timeline 1 has no history and the history of a later timeline is only needed to read back past its start
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	t.latest, t.history = timeline, history
+	return nil
+}
+
+func (t *Timelines) readHistory(timeline uint32) ([]TimelineSwitch, error) {
+	bs, err := ioutil.ReadFile(t.historyPath(timeline))
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseTimelineHistory(bs, t.segmentSize)
+}
+
+func (t *Timelines) historyPath(timeline uint32) string {
+	return filepath.Join(t.walDirPath, fmt.Sprintf("%.8X.history", timeline))
+}
+
+func historyFileTimeline(name string) (uint32, bool) {
+	if len(name) != len("00000000.history") || !strings.HasSuffix(name, ".history") {
+		return 0, false
+	}
+
+	timeline, err := strconv.ParseUint(name[:8], 16, 32)
+	return uint32(timeline), err == nil
+}
@@ -0,0 +1,121 @@
+package wal
+
+// Copyright 2015 MediaMath <http://www.mediamath.com>.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseTimelineHistory(t *testing.T) {
+	history, err := ParseTimelineHistory([]byte("1\t0/3000090\tno recovery target specified\n\n2\t1/A0000000\tbefore 2015-05-20 19:15:43 CDT\n"), 16*1024*1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []TimelineSwitch{{1, 0x03000090}, {2, 0x1a0000000}}
+	if !reflect.DeepEqual(history, expected) {
+		t.Errorf("expected %v but got %v", expected, history)
+	}
+
+	history, err = ParseTimelineHistory([]byte("1\t000000010000000000000013\tno recovery target specified\n"), 16*1024*1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := []TimelineSwitch{{1, 0x13000000}}; !reflect.DeepEqual(history, expected) {
+		t.Errorf("expected %v but got %v", expected, history)
+	}
+
+	if _, err := ParseTimelineHistory([]byte("2\t0/4000000\n1\t0/3000000\n"), 16*1024*1024); err == nil {
+		t.Error("expected out of order history to be an error")
+	}
+}
+
+func TestTimelineAt(t *testing.T) {
+	timelines := &Timelines{latest: 3, history: []TimelineSwitch{{1, 0x03000090}, {2, 0x05000000}}}
+
+	for offset, expected := range map[uint64]uint32{0x03000000: 1, 0x03000090: 2, 0x04ffffff: 2, 0x05000000: 3, 0x16000000: 3} {
+		if actual := timelines.TimelineAt(offset); actual != expected {
+			t.Errorf("expected %X to be on timeline %v but got %v", offset, expected, actual)
+		}
+	}
+}
+
+func TestTimelinesFollowNewHistoryFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "timelines")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeHistory := func(name, contents string) {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writeHistory("00000002.history", "1\t0/3000090\tno recovery target specified\n")
+	writeHistory("00000003.history", "1\t0/2000000\tno recovery target specified\n")
+
+	timelines, err := NewTimelines(dir, 1, 16*1024*1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if timelines.Latest() != 2 {
+		t.Errorf("expected to follow timeline 2 and not its sibling but got %v", timelines.Latest())
+	}
+
+	if timelines.Refresh() {
+		t.Error("expected no new timeline")
+	}
+
+	writeHistory("00000004.history", "1\t0/3000090\tno recovery target specified\n2\t0/5000000\tno recovery target specified\n")
+	if !timelines.Refresh() || timelines.Latest() != 4 {
+		t.Errorf("expected to follow timeline 4 but got %v", timelines.Latest())
+	}
+
+	if timeline := timelines.TimelineAt(0x04000000); timeline != 2 {
+		t.Errorf("expected 0x04000000 on timeline 2 but got %v", timeline)
+	}
+}
+
+func TestReadBlockFollowsTimelineSwitch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "timelines")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	location := NewLocationWithDefaults(0x0000000013002010)
+	segment := make([]byte, 0x4000)
+	copy(segment[0x2000:], pageExpectations[1].bs)
+
+	if err := ioutil.WriteFile(filepath.Join(dir, location.OnTimeline(2).Filename()), segment, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	timelines, err := NewTimelines(dir, 1, 16*1024*1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "00000002.history"), []byte("1\t0/13000000\tno recovery target specified\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	reader := blockReader{walDirPath: dir, blockSize: 0x2000, wordSize: 8, timelines: timelines}
+	if block, err := reader.readBlock(location); err != nil || block[0] != 0x66 {
+		t.Errorf("expected written page but got %v", block[:16])
+	}
+
+	if cursor := (Cursor{location, reader}).MoveTo(location); cursor.location.TimelineID() != 2 {
+		t.Errorf("expected cursor on timeline 2 but got %v", cursor.location.TimelineID())
+	}
+}
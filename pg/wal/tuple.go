@@ -0,0 +1,84 @@
+package wal
+
+// Copyright 2015 MediaMath <http://www.mediamath.com>.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+import (
+	"github.com/MediaMath/keryxlib/pg"
+)
+
+// These constants describe the layout of a heap tuple as it is logged
+const (
+	sizeOfHeapHeader      = 5
+	sizeOfHeapHeaderLen   = 7
+	sizeOfHeapTupleHeader = 23
+
+	heapHasNull   = 0x0001
+	heapNattsMask = 0x07FF
+)
+
+// TupleData is a heap tuple as logged in a record: an xl_heap_header followed by the tuple from its null bitmap on
+type TupleData []byte
+
+// NewTupleData checks that the bytes hold a complete xl_heap_header and the tuple it describes
+func NewTupleData(bs []byte) (TupleData, bool) {
+	if len(bs) < sizeOfHeapHeader {
+		return nil, false
+	}
+
+	tuple := TupleData(bs)
+	if tuple.HeaderLength() < sizeOfHeapTupleHeader || int(tuple.HeaderLength())-sizeOfHeapTupleHeader > len(tuple.bitmapAndData()) {
+		return nil, false
+	}
+
+	return tuple, true
+}
+
+func newTupleDataFromParts(header []byte, data []byte) (TupleData, bool) {
+	bs := make([]byte, 0, len(header)+len(data))
+	bs = append(bs, header...)
+	return NewTupleData(append(bs, data...))
+}
+
+// Infomask2 is the t_infomask2 of the tuple which holds the number of attributes
+func (t TupleData) Infomask2() uint16 { return uint16(pg.LUint(t[0:2])) }
+
+// Infomask is the t_infomask of the tuple
+func (t TupleData) Infomask() uint16 { return uint16(pg.LUint(t[2:4])) }
+
+// HeaderLength is the t_hoff of the tuple, the offset of the user data from the start of the tuple
+func (t TupleData) HeaderLength() uint8 { return t[4] }
+
+// NumberOfAttributes is how many attributes are stored in the tuple
+func (t TupleData) NumberOfAttributes() int { return int(t.Infomask2() & heapNattsMask) }
+
+// HasNulls indicates if the tuple has a null bitmap
+func (t TupleData) HasNulls() bool { return t.Infomask()&heapHasNull > 0 }
+
+// IsNull indicates if the attribute at a zero based index is null or missing from the tuple
+func (t TupleData) IsNull(attribute int) bool {
+	if attribute >= t.NumberOfAttributes() {
+		return true
+	}
+
+	if !t.HasNulls() {
+		return false
+	}
+
+	bitmap := t.bitmapAndData()
+	if attribute/8 >= len(bitmap) {
+		return true
+	}
+
+	return bitmap[attribute/8]&(1<<uint(attribute%8)) == 0
+}
+
+// UserData is the attribute values of the tuple
+func (t TupleData) UserData() []byte {
+	return t.bitmapAndData()[int(t.HeaderLength())-sizeOfHeapTupleHeader:]
+}
+
+func (t TupleData) bitmapAndData() []byte {
+	return t[sizeOfHeapHeader:]
+}
@@ -0,0 +1,350 @@
+package wal
+
+// Copyright 2015 MediaMath <http://www.mediamath.com>.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/MediaMath/keryxlib/message"
+	"github.com/MediaMath/keryxlib/pg"
+)
+
+// These errors are returned when a tuple holds values that can only be read back through the database
+var (
+	ErrToastedValue    = errors.New("tuple has a value stored out of line")
+	ErrCompressedValue = errors.New("tuple has a compressed value")
+)
+
+// These constants are the oids of the built in types the tuple decoder can output as text
+const (
+	oidBool        = 16
+	oidBytea       = 17
+	oidChar        = 18
+	oidName        = 19
+	oidInt8        = 20
+	oidInt2        = 21
+	oidInt4        = 23
+	oidText        = 25
+	oidOid         = 26
+	oidXid         = 28
+	oidJSON        = 114
+	oidXML         = 142
+	oidFloat4      = 700
+	oidFloat8      = 701
+	oidBpchar      = 1042
+	oidVarchar     = 1043
+	oidDate        = 1082
+	oidTime        = 1083
+	oidTimestamp   = 1114
+	oidTimestampTz = 1184
+	oidNumeric     = 1700
+	oidUUID        = 2950
+)
+
+var postgresEpoch = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// DecodeTuple turns a logged tuple into fields, formatted as postgres would output them as text, using the attributes
+// of the relation's schema.  Values longer than a positive size limit are truncated.
+func DecodeTuple(tuple TupleData, schema *pg.Schema, sizeLimit int) ([]message.Field, error) {
+	return decodeTuple(tuple, schema, sizeLimit, true)
+}
+
+// DecodeOldTuple turns the logged replica identity of an old tuple into fields.  Only columns with a value are
+// returned as a replica identity key leaves every column outside of the key null.
+func DecodeOldTuple(tuple TupleData, schema *pg.Schema, sizeLimit int) ([]message.Field, error) {
+	return decodeTuple(tuple, schema, sizeLimit, false)
+}
+
+func decodeTuple(tuple TupleData, schema *pg.Schema, sizeLimit int, includeNulls bool) ([]message.Field, error) {
+	if schema == nil || len(schema.Attributes) == 0 {
+		return nil, fmt.Errorf("no attributes known to decode tuple")
+	}
+
+	if tuple.NumberOfAttributes() > len(schema.Attributes) {
+		return nil, fmt.Errorf("tuple has %v attributes but %v.%v has %v", tuple.NumberOfAttributes(), schema.Namespace, schema.Table, len(schema.Attributes))
+	}
+
+	var (
+		data   = tuple.UserData()
+		offset int
+		fields []message.Field
+	)
+
+	for i, attribute := range schema.Attributes {
+		var value string
+
+		if !tuple.IsNull(i) {
+			start, end, err := attributeBounds(data, offset, attribute)
+			if err != nil {
+				return nil, fmt.Errorf("column %v: %v", attribute.Column, err)
+			}
+			offset = end
+
+			if !attribute.Dropped {
+				value, err = attributeText(attribute, data[start:end])
+				if err != nil {
+					return nil, fmt.Errorf("column %v: %v", attribute.Column, err)
+				}
+			}
+		}
+
+		if attribute.Dropped || (!includeNulls && tuple.IsNull(i)) {
+			continue
+		}
+
+		kind := ""
+		if field, ok := schema.Field(attribute.Column); ok {
+			kind = field.String()
+		}
+
+		fields = append(fields, message.Field{Name: attribute.Column, Kind: kind, Value: truncate(value, sizeLimit)})
+	}
+
+	return fields, nil
+}
+
+func attributeBounds(data []byte, offset int, attribute *pg.SchemaAttribute) (start int, end int, err error) {
+	start = offset
+
+	switch {
+	case attribute.Length > 0:
+		start = alignOffset(offset, attribute.Align)
+		end = start + int(attribute.Length)
+
+	case attribute.Length == -1:
+		if start >= len(data) || data[start] == 0 {
+			start = alignOffset(offset, attribute.Align)
+		}
+		if start >= len(data) {
+			return 0, 0, fmt.Errorf("varlena at %v is past the end of the tuple", start)
+		}
+
+		header := data[start]
+		switch {
+		case header == 0x01:
+			return 0, 0, ErrToastedValue
+		case header&0x01 == 0x01:
+			end = start + int(header>>1)
+		case header&0x03 == 0x02:
+			return 0, 0, ErrCompressedValue
+		default:
+			if start+4 > len(data) {
+				return 0, 0, fmt.Errorf("varlena header at %v is past the end of the tuple", start)
+			}
+			end = start + int(pg.LUint(data[start:start+4])>>2)
+			if end < start+4 {
+				return 0, 0, fmt.Errorf("varlena at %v has an invalid length", start)
+			}
+		}
+
+	case attribute.Length == -2:
+		end = bytes.IndexByte(data[start:], 0)
+		if end < 0 {
+			return 0, 0, fmt.Errorf("cstring at %v is not terminated", start)
+		}
+		end += start + 1
+
+	default:
+		return 0, 0, fmt.Errorf("invalid attribute length %v", attribute.Length)
+	}
+
+	if end > len(data) || end < start {
+		return 0, 0, fmt.Errorf("value at %v to %v is past the end of the tuple", start, end)
+	}
+
+	return
+}
+
+func alignOffset(offset int, align byte) int {
+	var alignment int
+
+	switch align {
+	case 's':
+		alignment = 2
+	case 'i':
+		alignment = 4
+	case 'd':
+		alignment = 8
+	default:
+		return offset
+	}
+
+	return (offset + alignment - 1) &^ (alignment - 1)
+}
+
+func varlenaPayload(bs []byte) []byte {
+	if bs[0]&0x01 == 0x01 {
+		return bs[1:]
+	}
+
+	return bs[4:]
+}
+
+func attributeText(attribute *pg.SchemaAttribute, bs []byte) (string, error) {
+	switch attribute.TypeID {
+	case oidBool:
+		if bs[0] != 0 {
+			return "t", nil
+		}
+		return "f", nil
+	case oidChar:
+		return string(bs[:1]), nil
+	case oidName:
+		if end := bytes.IndexByte(bs, 0); end >= 0 {
+			bs = bs[:end]
+		}
+		return string(bs), nil
+	case oidInt2:
+		return strconv.FormatInt(int64(int16(pg.LUint(bs[0:2]))), 10), nil
+	case oidInt4:
+		return strconv.FormatInt(int64(int32(pg.LUint(bs[0:4]))), 10), nil
+	case oidInt8:
+		return strconv.FormatInt(int64(pg.LUint(bs[0:8])), 10), nil
+	case oidOid, oidXid:
+		return strconv.FormatUint(pg.LUint(bs[0:4]), 10), nil
+	case oidFloat4:
+		return floatText(float64(math.Float32frombits(uint32(pg.LUint(bs[0:4])))), 6, 32), nil
+	case oidFloat8:
+		return floatText(math.Float64frombits(pg.LUint(bs[0:8])), 15, 64), nil
+	case oidText, oidVarchar, oidBpchar, oidJSON, oidXML:
+		return string(varlenaPayload(bs)), nil
+	case oidBytea:
+		return fmt.Sprintf("\\x%x", varlenaPayload(bs)), nil
+	case oidDate:
+		return dateText(int32(pg.LUint(bs[0:4]))), nil
+	case oidTime:
+		micros := int64(pg.LUint(bs[0:8]))
+		return postgresEpoch.Add(time.Duration(micros) * time.Microsecond).Format("15:04:05.999999"), nil
+	case oidTimestamp:
+		return timestampText(int64(pg.LUint(bs[0:8])), "2006-01-02 15:04:05.999999"), nil
+	case oidTimestampTz:
+		return timestampText(int64(pg.LUint(bs[0:8])), "2006-01-02 15:04:05.999999-07"), nil
+	case oidNumeric:
+		return numericText(varlenaPayload(bs))
+	case oidUUID:
+		return fmt.Sprintf("%x-%x-%x-%x-%x", bs[0:4], bs[4:6], bs[6:8], bs[8:10], bs[10:16]), nil
+	}
+
+	return "", fmt.Errorf("type %v cannot be decoded", attribute.TypeID)
+}
+
+func floatText(f float64, precision int, bitSize int) string {
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "Infinity"
+	case math.IsInf(f, -1):
+		return "-Infinity"
+	}
+
+	return strconv.FormatFloat(f, 'g', precision, bitSize)
+}
+
+func dateText(days int32) string {
+	switch days {
+	case math.MaxInt32:
+		return "infinity"
+	case math.MinInt32:
+		return "-infinity"
+	}
+
+	return postgresEpoch.AddDate(0, 0, int(days)).Format("2006-01-02")
+}
+
+func timestampText(micros int64, layout string) string {
+	switch micros {
+	case math.MaxInt64:
+		return "infinity"
+	case math.MinInt64:
+		return "-infinity"
+	}
+
+	return time.Unix(postgresEpoch.Unix()+micros/1000000, (micros%1000000)*1000).UTC().Format(layout)
+}
+
+func numericText(bs []byte) (string, error) {
+	if len(bs) < 2 {
+		return "", fmt.Errorf("numeric of %v bytes is too short", len(bs))
+	}
+
+	var (
+		header   = uint16(pg.LUint(bs[0:2]))
+		negative bool
+		scale    int
+		weight   int
+		digits   []byte
+	)
+
+	switch header & 0xC000 {
+	case 0xC000:
+		return "NaN", nil
+	case 0x8000:
+		negative = header&0x2000 > 0
+		scale = int(header&0x1F80) >> 7
+		weight = int(header & 0x003F)
+		if header&0x0040 > 0 {
+			weight -= 64
+		}
+		digits = bs[2:]
+	default:
+		if len(bs) < 4 {
+			return "", fmt.Errorf("numeric of %v bytes is too short", len(bs))
+		}
+		negative = header&0xC000 == 0x4000
+		scale = int(header & 0x3FFF)
+		weight = int(int16(pg.LUint(bs[2:4])))
+		digits = bs[4:]
+	}
+
+	digit := func(i int) uint64 {
+		if i < 0 || 2*i+2 > len(digits) {
+			return 0
+		}
+		return pg.LUint(digits[2*i : 2*i+2])
+	}
+
+	var out bytes.Buffer
+	if negative {
+		out.WriteString("-")
+	}
+
+	if weight < 0 {
+		out.WriteString("0")
+	}
+	for i := 0; i <= weight; i++ {
+		if i == 0 {
+			fmt.Fprintf(&out, "%d", digit(i))
+		} else {
+			fmt.Fprintf(&out, "%04d", digit(i))
+		}
+	}
+
+	if scale > 0 {
+		var fraction bytes.Buffer
+		for i := weight + 1; fraction.Len() < scale; i++ {
+			fmt.Fprintf(&fraction, "%04d", digit(i))
+		}
+		out.WriteString(".")
+		out.Write(fraction.Bytes()[:scale])
+	}
+
+	return out.String(), nil
+}
+
+func truncate(value string, sizeLimit int) string {
+	if sizeLimit <= 0 || utf8.RuneCountInString(value) <= sizeLimit {
+		return value
+	}
+
+	runes := []rune(value)
+	return string(runes[:sizeLimit])
+}
@@ -0,0 +1,168 @@
+package wal
+
+// Copyright 2015 MediaMath <http://www.mediamath.com>.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/MediaMath/keryxlib/message"
+	"github.com/MediaMath/keryxlib/pg"
+)
+
+var tupleDecoderSchema = &pg.Schema{
+	Database:  "db",
+	Namespace: "public",
+	Table:     "people",
+	Fields: []*pg.SchemaField{
+		{Column: "id", DataType: "integer", Size: 32},
+		{Column: "name", DataType: "character varying", Size: 255},
+		{Column: "note", DataType: "text"},
+		{Column: "created", DataType: "timestamp without time zone"},
+		{Column: "amount", DataType: "numeric", Size: 10},
+		{Column: "active", DataType: "boolean"},
+	},
+	Attributes: []*pg.SchemaAttribute{
+		{Column: "id", TypeID: oidInt4, Length: 4, Align: 'i', ByValue: true},
+		{Column: "........pg.dropped.2........", Length: 4, Align: 'i', ByValue: true, Dropped: true},
+		{Column: "name", TypeID: oidVarchar, Length: -1, Align: 'i'},
+		{Column: "note", TypeID: oidText, Length: -1, Align: 'i'},
+		{Column: "created", TypeID: oidTimestamp, Length: 8, Align: 'd', ByValue: true},
+		{Column: "amount", TypeID: oidNumeric, Length: -1, Align: 'i'},
+		{Column: "active", TypeID: oidBool, Length: 1, Align: 'c', ByValue: true},
+	},
+}
+
+var tupleDecoderCreated = time.Date(2015, 5, 19, 20, 21, 39, 500000000, time.UTC)
+
+func tupleDecoderTuple(name []byte) TupleData {
+	tuple := []byte{0x07, 0x00, 0x01, 0x08, 0x18, 0x77}
+	data := []byte{0x2a, 0x00, 0x00, 0x00, 0x07, 0x00, 0x00, 0x00}
+	data = append(data, name...)
+	for len(data)%8 != 0 {
+		data = append(data, 0x00)
+	}
+
+	created := make([]byte, 8)
+	binary.LittleEndian.PutUint64(created, uint64(tupleDecoderCreated.Sub(postgresEpoch)/time.Microsecond))
+	data = append(data, created...)
+	data = append(data, 0x0f, 0x00, 0xa1, 0x0c, 0x00, 0x88, 0x13, 0x01)
+
+	return TupleData(append(tuple, data...))
+}
+
+func TestDecodeTuple(t *testing.T) {
+	tuple, ok := NewTupleData(tupleDecoderTuple([]byte{0x09, 'b', 'o', 'b'}))
+	if !ok {
+		t.Fatal("expected a valid tuple")
+	}
+
+	fields, err := DecodeTuple(tuple, tupleDecoderSchema, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []message.Field{
+		{Name: "id", Kind: "integer(32)", Value: "42"},
+		{Name: "name", Kind: "character varying(255)", Value: "bob"},
+		{Name: "note", Kind: "text", Value: ""},
+		{Name: "created", Kind: "timestamp without time zone", Value: "2015-05-19 20:21:39.5"},
+		{Name: "amount", Kind: "numeric(10)", Value: "-12.50"},
+		{Name: "active", Kind: "boolean", Value: "t"},
+	}
+
+	if len(fields) != len(expected) {
+		t.Fatalf("expected %v fields but got %v", len(expected), len(fields))
+	}
+
+	for i, exp := range expected {
+		if fields[i] != exp {
+			t.Errorf("expected %+v but got %+v", exp, fields[i])
+		}
+	}
+}
+
+func TestDecodeTupleTruncatesToSizeLimit(t *testing.T) {
+	fields, err := DecodeTuple(tupleDecoderTuple([]byte{0x09, 'b', 'o', 'b'}), tupleDecoderSchema, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fields[1].Value != "bo" {
+		t.Errorf("expected name to be truncated but got %q", fields[1].Value)
+	}
+}
+
+func TestDecodeTupleRefusesToastedAndCompressedValues(t *testing.T) {
+	toasted := tupleDecoderTuple([]byte{0x01, 0x12, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00})
+	if _, err := DecodeTuple(toasted, tupleDecoderSchema, 0); err == nil {
+		t.Error("expected toasted value to fail decoding")
+	}
+
+	compressed := tupleDecoderTuple([]byte{0x22, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00})
+	if _, err := DecodeTuple(compressed, tupleDecoderSchema, 0); err == nil {
+		t.Error("expected compressed value to fail decoding")
+	}
+}
+
+func TestNumericText(t *testing.T) {
+	for _, exp := range numericTextExpectations {
+		act, err := numericText(exp.bs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if act != exp.str {
+			t.Errorf("expected %q but got %q", exp.str, act)
+		}
+	}
+}
+
+var numericTextExpectations = []struct {
+	str string
+	bs  []byte
+}{
+	{"1234567.891", []byte{0x03, 0x00, 0x01, 0x00, 0x7b, 0x00, 0xd7, 0x11, 0xce, 0x22}},
+	{"0.0005", []byte{0x7f, 0x82, 0x05, 0x00}},
+	{"-12.50", []byte{0x00, 0xa1, 0x0c, 0x00, 0x88, 0x13}},
+	{"0", []byte{0x00, 0x80}},
+	{"NaN", []byte{0x00, 0xc0}},
+}
+
+func TestInsertNewTuple(t *testing.T) {
+	insert := append([]byte{
+		0x7f, 0x06, 0x00, 0x00, 0x00, 0x40, 0x00, 0x00, 0x03, 0x40, 0x00, 0x00, 0x00, 0x00, 0xf2, 0x07,
+		0x1b, 0x00, 0xbf, 0x5f, 0x00}, tupleDecoderTuple([]byte{0x09, 'b', 'o', 'b'})...)
+
+	tuple := heapDataOrFail(t, Insert, insert, Magic91)[0].NewTuple()
+	if tuple == nil {
+		t.Fatal("expected insert to carry a tuple")
+	}
+
+	if tuple.NumberOfAttributes() != 7 || !tuple.HasNulls() || !tuple.IsNull(3) || tuple.IsNull(2) {
+		t.Errorf("tuple header not read correctly: %v", tuple[:6])
+	}
+
+	if fullPageOnly := heapDataOrFail(t, Insert, insert[:21], Magic91)[0].NewTuple(); fullPageOnly != nil {
+		t.Errorf("expected no tuple but got %v", fullPageOnly)
+	}
+}
+
+func TestDecodeOldTupleLeavesOutNulls(t *testing.T) {
+	fields, err := DecodeOldTuple(tupleDecoderTuple([]byte{0x09, 'b', 'o', 'b'}), tupleDecoderSchema, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(fields) != 5 {
+		t.Fatalf("expected 5 fields but got %v", len(fields))
+	}
+
+	for _, field := range fields {
+		if field.Name == "note" {
+			t.Errorf("expected null note to be left out")
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package wal
+
+// Copyright 2015 MediaMath <http://www.mediamath.com>.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// These constants are the WAL page magic values written by each supported PostgreSQL release
+const (
+	Magic91 uint16 = 0xD066 // Magic91 is the page magic of 9.1
+	Magic94 uint16 = 0xD07E // Magic94 is the page magic of 9.4
+	Magic95 uint16 = 0xD087 // Magic95 is the page magic of 9.5
+	Magic96 uint16 = 0xD093 // Magic96 is the page magic of 9.6
+	Magic10 uint16 = 0xD097 // Magic10 is the page magic of 10
+)
+
+// IsKnownMagic indicates if a page magic belongs to a release this package can decode
+func IsKnownMagic(magic uint16) bool {
+	switch magic {
+	case Magic91, Magic94, Magic95, Magic96, Magic10:
+		return true
+	}
+
+	return false
+}
+
+// SkipsLastSegment indicates if the WAL written with this page magic leaves out the last segment of every log id, which
+// releases before 9.3 do
+func SkipsLastSegment(magic uint16) bool {
+	return magic == Magic91
+}
+
+// HasBlockReferences indicates if records written with this page magic use the block reference format introduced in 9.5
+func HasBlockReferences(magic uint16) bool {
+	switch magic {
+	case Magic95, Magic96, Magic10:
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,70 @@
+package waltest
+
+// Copyright 2015 MediaMath <http://www.mediamath.com>.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+import (
+	"encoding/binary"
+
+	"github.com/MediaMath/keryxlib/pg/wal"
+)
+
+// These constants describe the layout of a heap page
+const (
+	pageHeaderSize  = 24
+	itemIDSize      = 4
+	lpNormal        = 1
+	pageLayout      = 4
+	tupleHeaderSize = 18
+)
+
+// BackupBlock is a full page image of a block of a relation that a record logs in place of its changes to the page
+type BackupBlock struct {
+	Relation RelFileNode
+	Block    uint32
+	Page     []byte
+}
+
+// bytes is the BkpBlock header of 9.1 and 9.4 followed by the page of pageSize bytes without its hole, which is the free
+// space between pd_lower and pd_upper the way postgres leaves it out
+func (b BackupBlock) bytes(pageSize int) []byte {
+	page := make([]byte, pageSize)
+	copy(page, b.Page)
+
+	lower, upper := binary.LittleEndian.Uint16(page[12:14]), binary.LittleEndian.Uint16(page[14:16])
+	holeOffset, holeLength := uint16(0), uint16(0)
+	if lower >= pageHeaderSize && upper > lower && int(upper) <= pageSize {
+		holeOffset, holeLength = lower, upper-lower
+	}
+
+	// the fork follows the relfilenode as a 4 byte enum and is always the main fork
+	header := append(b.Relation.bytes(), uint32s(0, b.Block)...)
+	header = append(header, uint16s(holeOffset, holeLength)...)
+
+	return append(append(header, page[:holeOffset]...), page[holeOffset+holeLength:]...)
+}
+
+// NewHeapPage lays out a heap page holding tuples at the item numbers from 1 on.  The tuples are logged tuples like
+// NewTuple makes and are stored with a zeroed xmin, xmax, cid and ctid in front of them.
+func NewHeapPage(tuples ...wal.TupleData) []byte {
+	page := make([]byte, wal.HeapPageSize)
+
+	upper := wal.HeapPageSize
+	for i, tuple := range tuples {
+		length := tupleHeaderSize + len(tuple)
+		upper = (upper - length) &^ 7
+
+		copy(page[upper+tupleHeaderSize:], tuple)
+
+		itemID := pageHeaderSize + i*itemIDSize
+		binary.LittleEndian.PutUint32(page[itemID:], uint32(upper)|lpNormal<<15|uint32(length)<<17)
+	}
+
+	binary.LittleEndian.PutUint16(page[12:14], uint16(pageHeaderSize+len(tuples)*itemIDSize))
+	binary.LittleEndian.PutUint16(page[14:16], uint16(upper))
+	binary.LittleEndian.PutUint16(page[16:18], wal.HeapPageSize)
+	binary.LittleEndian.PutUint16(page[18:20], wal.HeapPageSize|pageLayout)
+
+	return page
+}
@@ -0,0 +1,264 @@
+package waltest
+
+// Copyright 2015 MediaMath <http://www.mediamath.com>.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/MediaMath/keryxlib/pg/wal"
+)
+
+// These constants are the resource managers and the info bits of the records a Writer has methods for
+const (
+	RmXact  = 1
+	RmSmgr  = 2
+	RmHeap2 = 9
+	RmHeap  = 10
+
+	XactCommit        = 0x00
+	XactAbort         = 0x20
+	XactCommitCompact = 0x60
+	XactHasInfo       = 0x80
+
+	SmgrCreate   = 0x10
+	SmgrTruncate = 0x20
+
+	HeapInsert = 0x00
+	HeapDelete = 0x10
+	HeapUpdate = 0x20
+
+	Heap2MultiInsert = 0x50
+)
+
+// These constants are the flags of the xinfo of a 9.5 commit or abort that a Writer writes
+const (
+	xactInfoHasSubxacts     = 0x02
+	xactInfoHasRelFileNodes = 0x04
+)
+
+// postgresEpoch is when the timestamps postgres logs count from
+var postgresEpoch = time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// RelFileNode identifies the file of the relation a heap record changes
+type RelFileNode struct {
+	TablespaceID uint32
+	DatabaseID   uint32
+	RelationID   uint32
+}
+
+func (r RelFileNode) bytes() []byte {
+	return uint32s(r.TablespaceID, r.DatabaseID, r.RelationID)
+}
+
+// ItemPointer is the position of a tuple in its relation
+type ItemPointer struct {
+	Block  uint32
+	Offset uint16
+}
+
+func (p ItemPointer) bytes() []byte {
+	return uint16s(uint16(p.Block>>16), uint16(p.Block), p.Offset)
+}
+
+// NewTuple builds a tuple without nulls holding attributes attributes whose values are data, logged the way a heap
+// record logs it from its xl_heap_header on
+func NewTuple(attributes int, data []byte) wal.TupleData {
+	// t_hoff is 24, which puts a byte of padding where the null bitmap would be
+	tuple := append(uint16s(uint16(attributes), 0), 24, 0)
+	return wal.TupleData(append(tuple, data...))
+}
+
+// Insert writes a heap insert of tuple at to by xid, a nil tuple is left out the way it is when a backup block of the
+// page holds it
+func (w *Writer) Insert(xid uint32, rel RelFileNode, to ItemPointer, tuple wal.TupleData, blocks ...BackupBlock) wal.Location {
+	w.heapRecord("insert")
+
+	// the flags in 9.4 are where 9.1 has all_visible_cleared
+	data := append(heapTarget(rel, to), 0)
+	return w.Record(RmHeap, HeapInsert, xid, append(data, tuple...), blocks...)
+}
+
+// Update writes a heap update by xid of the tuple at from to tuple at to, a nil tuple is left out the way it is when a
+// backup block of the page holds it
+func (w *Writer) Update(xid uint32, rel RelFileNode, from, to ItemPointer, tuple wal.TupleData, blocks ...BackupBlock) wal.Location {
+	w.heapRecord("update")
+	data := heapTarget(rel, from)
+
+	if w.version == wal.Magic91 {
+		// all_visible_cleared and new_all_visible_cleared follow the new position
+		data = append(append(data, to.bytes()...), 0, 0)
+		data = append(data, tuple...)
+	} else {
+		// old_xmax and new_xmax come before the new position, old_infobits_set and flags after it
+		data = append(data, uint32s(0, 0)...)
+		data = append(append(data, to.bytes()...), 0, 0)
+		if len(tuple) > 0 {
+			// xl_heap_header_len puts the length of the tuple after its xl_heap_header in front of it
+			data = append(data, uint16s(uint16(len(tuple)-5))...)
+			data = append(data, tuple...)
+		}
+	}
+
+	return w.Record(RmHeap, HeapUpdate, xid, data, blocks...)
+}
+
+// Delete writes a heap delete by xid of the tuple at from
+func (w *Writer) Delete(xid uint32, rel RelFileNode, from ItemPointer) wal.Location {
+	w.heapRecord("delete")
+	data := heapTarget(rel, from)
+
+	if w.version == wal.Magic91 {
+		data = append(data, 0)
+	} else {
+		// xmax, infobits_set and flags without an old tuple
+		data = append(append(data, uint32s(0)...), 0, 0)
+	}
+
+	return w.Record(RmHeap, HeapDelete, xid, data)
+}
+
+// MultiInsert writes a heap2 multi insert by xid of tuples at offsets of block.  Only the offsets are logged, the
+// tuples that follow them are left out.
+func (w *Writer) MultiInsert(xid uint32, rel RelFileNode, block uint32, offsets ...uint16) wal.Location {
+	return w.MultiInsertWithBackupBlock(xid, rel, block, nil, offsets...)
+}
+
+// MultiInsertWithBackupBlock writes a heap2 multi insert like MultiInsert does followed by a backup block of the page
+// when page is not nil
+func (w *Writer) MultiInsertWithBackupBlock(xid uint32, rel RelFileNode, block uint32, page []byte, offsets ...uint16) wal.Location {
+	w.heapRecord("multi insert")
+	data := append(append(rel.bytes(), uint32s(block)...), 0, 0)
+	data = append(data, uint16s(uint16(len(offsets)))...)
+	data = append(data, uint16s(offsets...)...)
+
+	if page == nil {
+		return w.Record(RmHeap2, Heap2MultiInsert, xid, data)
+	}
+
+	return w.Record(RmHeap2, Heap2MultiInsert, xid, data, BackupBlock{rel, block, page})
+}
+
+// Create writes the creation of the main fork of new storage for rel by xid
+func (w *Writer) Create(xid uint32, rel RelFileNode) wal.Location {
+	return w.Record(RmSmgr, SmgrCreate, xid, append(rel.bytes(), uint32s(0)...))
+}
+
+// Truncate writes the truncation of rel to blocks blocks by xid
+func (w *Writer) Truncate(xid uint32, rel RelFileNode, blocks uint32) wal.Location {
+	data := append(uint32s(blocks), rel.bytes()...)
+	if w.version == wal.Magic95 {
+		// 9.5 flags the forks that are truncated, which are all of them
+		data = append(data, uint32s(7)...)
+	}
+
+	return w.Record(RmSmgr, SmgrTruncate, xid, data)
+}
+
+// heapRecord fails for 9.5, whose heap records name their relation and block in block references that the heap methods
+// do not write
+func (w *Writer) heapRecord(what string) {
+	if w.version == wal.Magic95 {
+		panic(what + " records cannot be written in the 9.5 format")
+	}
+}
+
+// Commit writes the commit of xid and its subtransactions at committed
+func (w *Writer) Commit(xid uint32, committed time.Time, subxacts ...uint32) wal.Location {
+	return w.CommitDropping(xid, committed, nil, subxacts...)
+}
+
+// CommitDropping writes the commit of xid and its subtransactions at committed that drops the storage of relations
+func (w *Writer) CommitDropping(xid uint32, committed time.Time, dropped []RelFileNode, subxacts ...uint32) wal.Location {
+	if w.version == wal.Magic95 {
+		return w.xactRecord95(XactCommit, xid, committed, dropped, subxacts)
+	}
+
+	// xinfo, nrels, nsubxacts, nmsgs, dbId and tsId follow the time and the relations come before the subtransactions
+	data := append(timestamp(committed), uint32s(0, uint32(len(dropped)), uint32(len(subxacts)), 0, 0, 0)...)
+	for _, rel := range dropped {
+		data = append(data, rel.bytes()...)
+	}
+	data = append(data, uint32s(subxacts...)...)
+
+	return w.Record(RmXact, XactCommit, xid, data)
+}
+
+// CompactCommit writes the compact commit 9.4 logs for xid when it drops no relations and sends no invalidations
+func (w *Writer) CompactCommit(xid uint32, committed time.Time, subxacts ...uint32) wal.Location {
+	data := append(timestamp(committed), uint32s(uint32(len(subxacts)))...)
+	data = append(data, uint32s(subxacts...)...)
+
+	return w.Record(RmXact, XactCommitCompact, xid, data)
+}
+
+// Abort writes the abort of xid and its subtransactions at aborted
+func (w *Writer) Abort(xid uint32, aborted time.Time, subxacts ...uint32) wal.Location {
+	if w.version == wal.Magic95 {
+		return w.xactRecord95(XactAbort, xid, aborted, nil, subxacts)
+	}
+
+	// nrels and nsubxacts follow the time
+	data := append(timestamp(aborted), uint32s(0, uint32(len(subxacts)))...)
+	data = append(data, uint32s(subxacts...)...)
+
+	return w.Record(RmXact, XactAbort, xid, data)
+}
+
+// xactRecord95 writes a 9.5 commit or abort, whose xinfo follows the time when there are subtransactions or relations
+// and flags the parts that follow it in that order
+func (w *Writer) xactRecord95(info uint8, xid uint32, ended time.Time, dropped []RelFileNode, subxacts []uint32) wal.Location {
+	data := timestamp(ended)
+	if len(dropped) == 0 && len(subxacts) == 0 {
+		return w.Record(RmXact, info, xid, data)
+	}
+
+	var xinfo uint32
+	var parts []byte
+	if len(subxacts) > 0 {
+		xinfo |= xactInfoHasSubxacts
+		parts = append(append(parts, uint32s(uint32(len(subxacts)))...), uint32s(subxacts...)...)
+	}
+	if len(dropped) > 0 {
+		xinfo |= xactInfoHasRelFileNodes
+		parts = append(parts, uint32s(uint32(len(dropped)))...)
+		for _, rel := range dropped {
+			parts = append(parts, rel.bytes()...)
+		}
+	}
+
+	data = append(append(data, uint32s(xinfo)...), parts...)
+	return w.Record(RmXact, info|XactHasInfo, xid, data)
+}
+
+// heapTarget is an xl_heaptid, the relfilenode and item pointer of a tuple padded to the alignment of the relfilenode
+func heapTarget(rel RelFileNode, tid ItemPointer) []byte {
+	return append(append(rel.bytes(), tid.bytes()...), 0, 0)
+}
+
+// timestamp is t as the microseconds since 2000-01-01 postgres logs with integer datetimes
+func timestamp(t time.Time) []byte {
+	bs := make([]byte, 8)
+	binary.LittleEndian.PutUint64(bs, uint64(t.Sub(postgresEpoch)/time.Microsecond))
+	return bs
+}
+
+func uint16s(values ...uint16) []byte {
+	bs := make([]byte, 2*len(values))
+	for i, value := range values {
+		binary.LittleEndian.PutUint16(bs[2*i:], value)
+	}
+
+	return bs
+}
+
+func uint32s(values ...uint32) []byte {
+	bs := make([]byte, 4*len(values))
+	for i, value := range values {
+		binary.LittleEndian.PutUint32(bs[4*i:], value)
+	}
+
+	return bs
+}
@@ -0,0 +1,347 @@
+// Package waltest writes WAL segments and data directories in the formats of postgres 9.1, 9.4 and 9.5 so that
+// reading the WAL can be tested without a postgres install.  The 9.5 records a Writer writes hold their data as main
+// data, so only the records that reference no blocks and records written by ReferencingRecord can be written in that
+// format.
+package waltest
+
+// Copyright 2015 MediaMath <http://www.mediamath.com>.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/MediaMath/keryxlib/pg/control"
+	"github.com/MediaMath/keryxlib/pg/wal"
+)
+
+// SystemID is the system identifier the long page headers and pg_control written by a Writer carry
+const SystemID uint64 = 6127242208946681587
+
+// These constants are the bits of the info of a page header
+const (
+	firstIsContRecord = 0x0001
+	longHeader        = 0x0002
+)
+
+// These constants are the sizes of a record header with the padding that aligns it, which is the same in 9.1 and 9.4
+const (
+	recordHeaderSize   = 32
+	recordHeaderSize95 = 24
+)
+
+// These constants are the ids that start the main data of a 9.5 record, followed by a one or four byte length
+const (
+	blockIDDataShort = 255
+	blockIDDataLong  = 254
+)
+
+var castagnoliTable = crc32.MakeTable(crc32.Castagnoli)
+
+// Writer lays out records in WAL segments the way postgres 9.1, 9.4 or 9.5 does.  Records follow each other aligned to the
+// word size, records that do not fit on a page continue on the next ones and every segment starts with a long page
+// header.  Pages that are not written are zeroed like pages postgres has not written yet.
+type Writer struct {
+	version  uint16
+	first    wal.Location
+	position wal.Location
+	previous wal.Location
+	segments map[wal.SegmentName][]byte
+}
+
+// NewWriter creates a writer for the WAL of the release with the page magic version whose first page starts at start.
+// The timeline, segment size, page size and alignment are those of start.
+func NewWriter(version uint16, start wal.Location) (*Writer, error) {
+	if version != wal.Magic91 && version != wal.Magic94 && version != wal.Magic95 {
+		return nil, fmt.Errorf("cannot write WAL with page magic %.4X, only the 9.1, 9.4 and 9.5 formats can be written", version)
+	}
+
+	if start.FromStartOfPage() != 0 {
+		return nil, fmt.Errorf("cannot start writing WAL at %v which is not the start of a page", start)
+	}
+
+	start = start.SkippingLastSegment(wal.SkipsLastSegment(version))
+	return &Writer{version, start, start, start.At(0), make(map[wal.SegmentName][]byte)}, nil
+}
+
+// Record writes a record of the resource manager rmid with the info bits, transaction and resource manager data
+// given followed by backup blocks of the pages it changes, and returns where it starts
+func (w *Writer) Record(rmid, info uint8, xid uint32, data []byte, blocks ...BackupBlock) wal.Location {
+	// a 9.5 record holds its data as main data after the block references, which Record does not write
+	body := append([]byte{}, data...)
+	if w.version == wal.Magic95 {
+		if len(blocks) > 0 {
+			panic("backup blocks cannot be written in the 9.5 format")
+		}
+		body = mainData(data)
+	}
+
+	// the backup blocks follow the resource manager data and are flagged from the highest of the low four info bits
+	for i, block := range blocks {
+		info |= 0x08 >> uint(i)
+		body = append(body, block.bytes(int(w.position.PageSize()))...)
+	}
+
+	return w.record(rmid, info, xid, len(data), body)
+}
+
+// BlockReference is a block of the main fork of a relation that a 9.5 record references without data or a full page
+// image of it
+type BlockReference struct {
+	Relation RelFileNode
+	Block    uint32
+}
+
+// ReferencingRecord writes a 9.5 record of the resource manager rmid with the info bits and transaction given that
+// references blocks and holds data as its main data, and returns where it starts
+func (w *Writer) ReferencingRecord(rmid, info uint8, xid uint32, data []byte, blocks ...BlockReference) wal.Location {
+	if w.version != wal.Magic95 {
+		panic("block references can only be written in the 9.5 format")
+	}
+
+	// each block header is its id, the fork and flags, the length of its data, the relfilenode and the block number
+	var body []byte
+	for i, block := range blocks {
+		body = append(append(append(body, byte(i), 0, 0, 0), block.Relation.bytes()...), uint32s(block.Block)...)
+	}
+
+	return w.record(rmid, info, xid, len(data), append(body, mainData(data)...))
+}
+
+// record writes a record whose body is laid out already after a header giving length as the length of its data
+func (w *Writer) record(rmid, info uint8, xid uint32, length int, body []byte) wal.Location {
+	if w.position.FromStartOfPage() == 0 {
+		w.beginPage(0)
+	}
+
+	// 9.1 does not split record headers, a record whose header does not fit starts on the next page
+	if w.version == wal.Magic91 && w.position.ToEndOfPage() < recordHeaderSize {
+		w.position = w.position.StartOfNextPage()
+		w.beginPage(0)
+	}
+
+	location := w.position
+	if w.previous.Offset() == 0 {
+		w.first = location
+	}
+
+	w.write(append(w.recordHeader(rmid, info, xid, length, body), body...))
+	w.previous = location
+	w.position = w.position.Aligned()
+
+	return location
+}
+
+// mainData is data in the format of the main data that ends the body of a 9.5 record
+func mainData(data []byte) []byte {
+	if len(data) < 256 {
+		return append([]byte{blockIDDataShort, byte(len(data))}, data...)
+	}
+
+	return append(append([]byte{blockIDDataLong}, uint32s(uint32(len(data)))...), data...)
+}
+
+func (w *Writer) recordHeader(rmid, info uint8, xid uint32, length int, body []byte) []byte {
+	var (
+		header      = make([]byte, recordHeaderSize)
+		totalLength = uint32(recordHeaderSize + len(body))
+		previous    = w.previous.Offset()
+	)
+
+	if w.version == wal.Magic95 {
+		header, totalLength = make([]byte, recordHeaderSize95), uint32(recordHeaderSize95+len(body))
+		binary.LittleEndian.PutUint32(header[0:4], totalLength)
+		binary.LittleEndian.PutUint32(header[4:8], xid)
+		binary.LittleEndian.PutUint64(header[8:16], previous)
+		header[16], header[17] = info, rmid
+		crc := crc32.Update(crc32.Update(0, castagnoliTable, body), castagnoliTable, header[0:20])
+		binary.LittleEndian.PutUint32(header[20:24], crc)
+	} else if w.version == wal.Magic91 {
+		binary.LittleEndian.PutUint32(header[4:8], uint32(previous>>32))
+		binary.LittleEndian.PutUint32(header[8:12], uint32(previous))
+		binary.LittleEndian.PutUint32(header[12:16], xid)
+		binary.LittleEndian.PutUint32(header[16:20], totalLength)
+		binary.LittleEndian.PutUint32(header[20:24], uint32(length))
+		header[24], header[25] = info, rmid
+		binary.LittleEndian.PutUint32(header[0:4], legacyCrc(body, header[4:]))
+	} else {
+		binary.LittleEndian.PutUint32(header[0:4], totalLength)
+		binary.LittleEndian.PutUint32(header[4:8], xid)
+		binary.LittleEndian.PutUint32(header[8:12], uint32(length))
+		header[12], header[13] = info, rmid
+		binary.LittleEndian.PutUint64(header[16:24], previous)
+		binary.LittleEndian.PutUint32(header[24:28], legacyCrc(body, header[0:24]))
+	}
+
+	return header
+}
+
+// legacyCrc is the crc postgres computes before 9.5 over the body of a record and then its header
+func legacyCrc(body, header []byte) uint32 {
+	crc := uint32(0xFFFFFFFF)
+	for _, bs := range [][]byte{body, header} {
+		for _, b := range bs {
+			crc = crc32.IEEETable[byte(crc>>24)^b] ^ (crc << 8)
+		}
+	}
+
+	return crc ^ 0xFFFFFFFF
+}
+
+// write copies bs to the WAL at the position, continuing on the next pages when it does not fit
+func (w *Writer) write(bs []byte) {
+	for {
+		page := w.page(w.position)
+		n := copy(page[w.position.FromStartOfPage():], bs)
+		w.position = w.position.Add(uint64(n))
+		bs = bs[n:]
+
+		if len(bs) == 0 {
+			return
+		}
+
+		w.beginPage(uint32(len(bs)))
+	}
+}
+
+// beginPage writes the header of the page starting at the position and moves past it.  remaining is how much of a
+// record continues on the page.
+func (w *Writer) beginPage(remaining uint32) {
+	var (
+		page         = w.page(w.position)
+		info         = uint16(0)
+		headerLength = uint64(16)
+		longFields   = 16
+	)
+
+	if w.version != wal.Magic91 {
+		headerLength, longFields = 24, 24
+	}
+
+	if remaining > 0 {
+		info |= firstIsContRecord
+	}
+
+	if w.position.FromStartOfFile() == 0 {
+		info |= longHeader
+		headerLength += 16
+
+		binary.LittleEndian.PutUint64(page[longFields:longFields+8], SystemID)
+		binary.LittleEndian.PutUint32(page[longFields+8:longFields+12], w.position.FileSize())
+		binary.LittleEndian.PutUint32(page[longFields+12:longFields+16], w.position.PageSize())
+	}
+
+	binary.LittleEndian.PutUint16(page[0:2], w.version)
+	binary.LittleEndian.PutUint16(page[2:4], info)
+	binary.LittleEndian.PutUint32(page[4:8], w.position.TimelineID())
+
+	if w.version == wal.Magic91 {
+		binary.LittleEndian.PutUint32(page[8:12], w.position.LogID())
+		binary.LittleEndian.PutUint32(page[12:16], w.position.RecordOffset())
+
+		// the continuation of a record is preceded by how much of it remains
+		if remaining > 0 {
+			binary.LittleEndian.PutUint32(page[headerLength:headerLength+4], remaining)
+			headerLength += 4
+		}
+	} else {
+		binary.LittleEndian.PutUint64(page[8:16], w.position.Offset())
+		binary.LittleEndian.PutUint32(page[16:20], remaining)
+	}
+
+	w.position = w.position.Add(headerLength)
+}
+
+// page is the page holding location in its segment, the segment is created when it is not written yet
+func (w *Writer) page(location wal.Location) []byte {
+	name := location.SegmentName()
+	segment, ok := w.segments[name]
+	if !ok {
+		segment = make([]byte, location.FileSize())
+		w.segments[name] = segment
+	}
+
+	start := location.StartOfPage().FromStartOfFile()
+	return segment[start : start+uint64(location.PageSize())]
+}
+
+// Source is a segment source holding copies of the segments written so far
+func (w *Writer) Source() *wal.MemorySource {
+	source := wal.NewMemorySource()
+	for name, segment := range w.segments {
+		source.Add(name, append([]byte{}, segment...))
+	}
+
+	return source
+}
+
+// WriteSegments writes the segments written so far to files in dir
+func (w *Writer) WriteSegments(dir string) error {
+	for name, segment := range w.segments {
+		if err := ioutil.WriteFile(filepath.Join(dir, name.String()), segment, 0644); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// WriteDataDir lays out a data directory holding the segments written so far, a PG_VERSION and a pg_control whose
+// checkpoints are at the first record, which is what a cursor or a stream needs to read it
+func (w *Writer) WriteDataDir(dataDir string) error {
+	version, controlVersion, catalogVersion := "9.1", uint32(903), uint32(201105231)
+	switch w.version {
+	case wal.Magic94:
+		version, controlVersion, catalogVersion = "9.4", 942, 201409291
+	case wal.Magic95:
+		version, controlVersion, catalogVersion = "9.5", 942, 201510051
+	}
+
+	walDir := filepath.Join(dataDir, "pg_xlog")
+	for _, dir := range []string{filepath.Join(dataDir, "global"), walDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dataDir, "PG_VERSION"), []byte(version+"\n"), 0644); err != nil {
+		return err
+	}
+
+	checkpoint := &control.Control{
+		SystemIdentifier:           SystemID,
+		Version:                    controlVersion,
+		CatalogVersionNo:           catalogVersion,
+		State:                      control.DbInProduction,
+		CheckPointLogID:            w.first.LogID(),
+		CheckPointRecordOffset:     w.first.RecordOffset(),
+		PrevCheckPointLogID:        w.first.LogID(),
+		PrevCheckPointRecordOffset: w.first.RecordOffset(),
+		CheckPointCopy: control.CheckPoint{
+			RedoLogID:        w.first.LogID(),
+			RedoRecordOffset: w.first.RecordOffset(),
+			ThisTimeLineID:   w.first.TimelineID(),
+		},
+		MaxAlign:    w.first.WordSize(),
+		FloatFormat: 1234567.0,
+		Blcksz:      8192,
+		XlogBlcksz:  w.first.PageSize(),
+		XlogSegSize: w.first.FileSize(),
+	}
+
+	bs, err := checkpoint.Bytes()
+	if err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dataDir, "global", "pg_control"), bs, 0600); err != nil {
+		return err
+	}
+
+	return w.WriteSegments(walDir)
+}
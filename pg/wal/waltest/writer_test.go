@@ -0,0 +1,672 @@
+package waltest
+
+// Copyright 2015 MediaMath <http://www.mediamath.com>.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MediaMath/keryxlib/pg/wal"
+)
+
+var (
+	versions = []uint16{wal.Magic91, wal.Magic94}
+	relation = RelFileNode{1663, 16384, 16385}
+	now      = time.Date(2015, time.June, 1, 12, 0, 0, 0, time.UTC)
+)
+
+func readAll(t *testing.T, cursor *wal.Cursor) []wal.Entry {
+	var entries []wal.Entry
+	for {
+		read, next, err := cursor.ReadEntries()
+		if err != nil {
+			t.Fatalf("failed to read at %v: %v", cursor.Location(), err)
+		}
+
+		entries = append(entries, read...)
+		if next.Location() == cursor.Location() {
+			return entries
+		}
+
+		*cursor = next
+	}
+}
+
+func readAllFromStart(t *testing.T, w *Writer, start wal.Location) []wal.Entry {
+	cursor, err := wal.NewCursorAt(w.Source(), start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cursor.Close()
+
+	return readAll(t, cursor)
+}
+
+func TestRecordsReadBack(t *testing.T) {
+	for _, version := range versions {
+		start := wal.NewLocationWithDefaults(0x13000000)
+		w, err := NewWriter(version, start)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		small, large := NewTuple(1, []byte("keryx")), NewTuple(1, bytes.Repeat([]byte("x"), 20000))
+
+		w.Insert(100, relation, ItemPointer{0, 1}, small)
+		w.Update(100, relation, ItemPointer{0, 1}, ItemPointer{0x10002, 2}, large)
+		w.Delete(100, relation, ItemPointer{0x10002, 2})
+		w.MultiInsert(100, relation, 3, 1, 2, 3)
+		w.Commit(100, now)
+		w.Insert(101, relation, ItemPointer{4, 1}, nil)
+		w.Abort(101, now)
+
+		entries := readAllFromStart(t, w, start)
+		expected := []struct {
+			typ          wal.RecordType
+			xid          uint32
+			from, to     ItemPointer
+			userDataSize int
+		}{
+			{wal.Insert, 100, ItemPointer{}, ItemPointer{0, 1}, 5},
+			{wal.Update, 100, ItemPointer{0, 1}, ItemPointer{0x10002, 2}, 20000},
+			{wal.Delete, 100, ItemPointer{0x10002, 2}, ItemPointer{}, 0},
+			{wal.MultiInsert, 100, ItemPointer{}, ItemPointer{3, 1}, 0},
+			{wal.MultiInsert, 100, ItemPointer{}, ItemPointer{3, 2}, 0},
+			{wal.MultiInsert, 100, ItemPointer{}, ItemPointer{3, 3}, 0},
+			{wal.Commit, 100, ItemPointer{}, ItemPointer{}, 0},
+			{wal.Insert, 101, ItemPointer{}, ItemPointer{4, 1}, 0},
+			{wal.Abort, 101, ItemPointer{}, ItemPointer{}, 0},
+		}
+
+		if len(entries) != len(expected) {
+			t.Fatalf("%.4X: expected %v entries but got %v: %v", version, len(expected), len(entries), entries)
+		}
+
+		for i, exp := range expected {
+			entry := entries[i]
+			if entry.Type != exp.typ || entry.TransactionID != exp.xid {
+				t.Errorf("%.4X: expected %v by %v but got %v", version, exp.typ, exp.xid, entry)
+			}
+
+			if exp.typ != wal.Commit && exp.typ != wal.Abort && (entry.TablespaceID != relation.TablespaceID || entry.DatabaseID != relation.DatabaseID || entry.RelationID != relation.RelationID) {
+				t.Errorf("%.4X: expected relation %v but got %v", version, relation, entry)
+			}
+
+			from, to := ItemPointer{entry.FromBlock, entry.FromOffset}, ItemPointer{entry.ToBlock, entry.ToOffset}
+			if from != exp.from || to != exp.to {
+				t.Errorf("%.4X: expected %v from %v to %v but got %v", version, exp.typ, exp.from, exp.to, entry)
+			}
+
+			size := 0
+			if entry.Tuple != nil {
+				size = len(entry.Tuple.UserData())
+			}
+
+			if size != exp.userDataSize {
+				t.Errorf("%.4X: expected %v bytes of user data in %v but got %v", version, exp.userDataSize, entry, entry.Tuple)
+			}
+		}
+
+		if !bytes.Equal(entries[0].Tuple.UserData(), []byte("keryx")) {
+			t.Errorf("%.4X: expected inserted tuple to hold keryx but got %q", version, entries[0].Tuple.UserData())
+		}
+	}
+}
+
+func TestRecordsAcrossPagesAndSegments(t *testing.T) {
+	for _, version := range versions {
+		// small segments so that records cross into new segments with long page headers
+		start := wal.NewLocation(0x130000, 1, 0x10000, 0x2000, 8)
+		w, err := NewWriter(version, start)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// tuples of every size up to a page put record boundaries, and so split headers, everywhere on the pages
+		var locations []wal.Location
+		for i := 0; i < 100; i++ {
+			xid := uint32(1000 + i)
+			locations = append(locations, w.Insert(xid, relation, ItemPointer{uint32(i), 1}, NewTuple(1, bytes.Repeat([]byte{byte(i)}, 83*i))))
+			w.Commit(xid, now)
+		}
+
+		if last := locations[len(locations)-1]; last.SegmentName() == start.SegmentName() {
+			t.Fatalf("%.4X: expected records to cross segments but the last one is at %v", version, last)
+		}
+
+		entries := readAllFromStart(t, w, start)
+		if len(entries) != 200 {
+			t.Fatalf("%.4X: expected 200 entries but got %v", version, len(entries))
+		}
+
+		for i := 0; i < 100; i++ {
+			insert, commit := entries[2*i], entries[2*i+1]
+			if insert.Type != wal.Insert || insert.ReadFrom.Offset() != locations[i].Offset() || insert.ToBlock != uint32(i) {
+				t.Errorf("%.4X: expected insert %v at %v but got %v", version, i, locations[i], insert)
+			} else if !bytes.Equal(insert.Tuple.UserData(), bytes.Repeat([]byte{byte(i)}, 83*i)) {
+				t.Errorf("%.4X: insert %v at %v has the wrong tuple", version, i, locations[i])
+			}
+
+			if commit.Type != wal.Commit || commit.TransactionID != uint32(1000+i) {
+				t.Errorf("%.4X: expected commit of %v but got %v", version, 1000+i, commit)
+			}
+		}
+	}
+}
+
+func TestSplitRecordHeaders(t *testing.T) {
+	for _, version := range versions {
+		for _, onFirstPage := range []int{8, 16, 24} {
+			start := wal.NewLocationWithDefaults(0x13000000)
+			w, err := NewWriter(version, start)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// a filler record leaves room for only part of the header of the insert at the end of the first page
+			filler := w.Record(0, 0, 1, nil)
+			w.Record(0, 0, 1, make([]byte, 0x2000-int(filler.FromStartOfPage())-2*recordHeaderSize-onFirstPage))
+			insert := w.Insert(2, relation, ItemPointer{5, 6}, NewTuple(1, []byte("keryx")))
+			w.Commit(2, now)
+
+			split := start.Add(0x2000 - uint64(onFirstPage))
+			if version == wal.Magic94 && insert != split || version == wal.Magic91 && insert.IsOnSamePageAs(split) {
+				t.Fatalf("%.4X: expected the header of the insert at %v to be split but it is at %v", version, split, insert)
+			}
+
+			entries := readAllFromStart(t, w, start)
+			if len(entries) != 4 || entries[2].Type != wal.Insert || entries[2].ReadFrom != insert || !bytes.Equal(entries[2].Tuple.UserData(), []byte("keryx")) {
+				t.Errorf("%.4X: expected the insert at %v to be read but got %v", version, insert, entries)
+			}
+		}
+	}
+}
+
+func TestCursorAfterContinuation(t *testing.T) {
+	for _, version := range versions {
+		for extra := 0; extra < 8; extra++ {
+			start := wal.NewLocationWithDefaults(0x13000000)
+			w, err := NewWriter(version, start)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// the insert continues on the second page and every length of its continuation is tried
+			w.Insert(1, relation, ItemPointer{0, 1}, NewTuple(1, make([]byte, 0x2000+extra)))
+			next := w.Insert(1, relation, ItemPointer{0, 2}, NewTuple(1, []byte("keryx")))
+			w.Commit(1, now)
+
+			cursor, err := wal.NewCursorAt(w.Source(), start.Add(0x2000))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if cursor.Location() != next {
+				t.Errorf("%.4X: expected the first record after the continuation to be at %v but got %v", version, next, cursor.Location())
+			}
+			cursor.Close()
+		}
+	}
+}
+
+func TestWriteDataDir(t *testing.T) {
+	for _, version := range versions {
+		dir, err := ioutil.TempDir("", "waltest")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		w, err := NewWriter(version, wal.NewLocationWithDefaults(0x13000000))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		first := w.Insert(7, relation, ItemPointer{0, 1}, NewTuple(1, []byte("keryx")))
+		w.Commit(7, now)
+
+		if err := w.WriteDataDir(dir); err != nil {
+			t.Fatal(err)
+		}
+
+		cursor, err := wal.NewCursorAtCheckpoint(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer cursor.Close()
+
+		if cursor.Location().Offset() != first.Offset() {
+			t.Errorf("%.4X: expected checkpoint at the first record %v but got %v", version, first, cursor.Location())
+		}
+
+		if entries := readAll(t, cursor); len(entries) != 2 || entries[0].Type != wal.Insert || entries[1].Type != wal.Commit {
+			t.Errorf("%.4X: expected an insert and a commit but got %v", version, entries)
+		}
+	}
+}
+
+func TestNewWriterChecksItsArguments(t *testing.T) {
+	if _, err := NewWriter(wal.Magic96, wal.NewLocationWithDefaults(0x13000000)); err == nil {
+		t.Error("expected 9.6 to not be writable")
+	}
+
+	if _, err := NewWriter(wal.Magic94, wal.NewLocationWithDefaults(0x13000010)); err == nil {
+		t.Error("expected a writer to start at the start of a page")
+	}
+}
+
+func TestReadRecordReturnsHeaderAndPage(t *testing.T) {
+	for _, version := range versions {
+		start := wal.NewLocationWithDefaults(0x13000000)
+		w, err := NewWriter(version, start)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		insert := w.Insert(9, relation, ItemPointer{1, 2}, NewTuple(1, []byte("keryx")))
+		commit := w.Commit(9, now)
+
+		cursor, err := wal.NewCursorAt(w.Source(), start)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer cursor.Close()
+
+		record, next, err := cursor.ReadRecord()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if next.Location() != commit {
+			t.Errorf("%.4X: expected the next record at %v but got %v", version, commit, next.Location())
+		}
+
+		header := record.Header
+		if header.ResourceManagerID() != RmHeap || header.Info() != HeapInsert || header.TransactionID() != 9 || header.Previous().Offset() != 0 {
+			t.Errorf("%.4X: expected the header of an insert by 9 but got %v %v %v %v", version, header.ResourceManagerID(), header.Info(), header.TransactionID(), header.Previous())
+		}
+
+		if record.Page.Magic() != version || !record.Page.IsLong() || record.Page.SystemID() != SystemID {
+			t.Errorf("%.4X: expected the long header of the first page but got %.4X %v %v", version, record.Page.Magic(), record.Page.IsLong(), record.Page.SystemID())
+		}
+
+		if heapData, err := record.Body.HeapData(); err != nil || len(heapData) != 1 || heapData[0].ToOffset() != 2 {
+			t.Errorf("%.4X: expected the heap data of the insert but got %v %v", version, heapData, err)
+		}
+
+		if len(record.Entries) != 1 || record.Entries[0].ReadFrom != insert {
+			t.Errorf("%.4X: expected the entry of the insert but got %v", version, record.Entries)
+		}
+
+		// nothing follows the commit so it is read without moving the cursor, like ReadEntries does
+		last, same, err := next.ReadRecord()
+		if err != nil || same.Location() != commit || last == nil || last.Header.TransactionID() != 9 || len(last.Entries) != 1 {
+			t.Errorf("%.4X: expected the commit to be read at the end of the wal but got %v at %v: %v", version, last, same.Location(), err)
+		}
+	}
+}
+
+func TestBlockReferencesReadBack(t *testing.T) {
+	start := wal.NewLocationWithDefaults(0x13000000)
+	w, err := NewWriter(wal.Magic95, start)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a btree insert, whose data keryx does not decode
+	w.ReferencingRecord(11, 0x00, 9, []byte("main data"), BlockReference{relation, 7}, BlockReference{relation, 3})
+
+	cursor, err := wal.NewCursorAt(w.Source(), start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cursor.Close()
+
+	record, _, err := cursor.ReadRecord()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blocks, err := record.Body.BlockReferences()
+	if err != nil || len(blocks) != 2 {
+		t.Fatalf("expected 2 block references but got %v: %v", blocks, err)
+	}
+
+	for i, block := range []uint32{7, 3} {
+		ref := blocks[i]
+		if ref.ID != uint8(i) || (RelFileNode{ref.TablespaceID, ref.DatabaseID, ref.RelationID}) != relation || ref.Block != block || ref.HasImage() || ref.HasData() {
+			t.Errorf("expected block %v of %v as block reference %v but got %v", block, relation, i, ref)
+		}
+	}
+
+	if main := string(record.Body.MainData()); !strings.HasSuffix(main, "main data") {
+		t.Errorf("expected the main data to end the body but got %q", main)
+	}
+}
+
+func TestReadRecordsStopsAtErrors(t *testing.T) {
+	start := wal.NewLocationWithDefaults(0x13000000)
+	w, err := NewWriter(wal.Magic94, start)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w.Commit(1, now)
+	second := w.Commit(2, now)
+	w.Commit(3, now)
+
+	cursor, err := wal.NewCursorAt(w.Source(), start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cursor.Close()
+
+	stop := errors.New("stop")
+	var read []wal.Location
+	stopped, err := cursor.ReadRecords(0, func(location wal.Location, record *wal.Record) error {
+		read = append(read, location)
+		if location == second {
+			return stop
+		}
+
+		return nil
+	})
+
+	if err != stop || stopped.Location() != second || len(read) != 2 {
+		t.Errorf("expected to stop at %v after 2 records but stopped at %v after %v: %v", second, stopped.Location(), read, err)
+	}
+}
+
+func TestTuplesFromBackupBlocks(t *testing.T) {
+	for _, version := range versions {
+		// postgres can be built with larger pages, which the images of its pages are the size of
+		for _, pageSize := range []uint32{wal.HeapPageSize, 2 * wal.HeapPageSize} {
+			start := wal.NewLocationWithDefaults(0x13000000).WithGeometry(0, pageSize, 0)
+			w, err := NewWriter(version, start)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			page := NewHeapPage(NewTuple(1, []byte("keryx")), NewTuple(2, []byte("lib")))
+
+			w.Insert(100, relation, ItemPointer{7, 2}, nil, BackupBlock{relation, 7, page})
+			w.Update(100, relation, ItemPointer{7, 1}, ItemPointer{7, 1}, nil, BackupBlock{relation, 7, page})
+			w.MultiInsertWithBackupBlock(100, relation, 7, page, 1, 2, 3)
+			w.Insert(100, relation, ItemPointer{8, 1}, nil, BackupBlock{relation, 7, page})
+			w.Commit(100, now)
+
+			entries := readAllFromStart(t, w, start)
+			expected := []string{"lib", "keryx", "keryx", "lib", "", "", ""}
+			if len(entries) != len(expected) {
+				t.Fatalf("%.4X: expected %v entries but got %v: %v", version, len(expected), len(entries), entries)
+			}
+
+			for i, exp := range expected {
+				var userData []byte
+				if entries[i].Tuple != nil {
+					userData = entries[i].Tuple.UserData()
+				}
+
+				if string(userData) != exp {
+					t.Errorf("%.4X: expected entry %v to hold %q from the page but got %q", version, entries[i], exp, userData)
+				}
+			}
+
+			if entries[3].Tuple == nil || entries[3].Tuple.NumberOfAttributes() != 2 {
+				t.Errorf("%.4X: expected the second tuple on the page to have 2 attributes but got %v", version, entries[3].Tuple.NumberOfAttributes())
+			}
+
+			// item 3 is not on the page and block 8 is not backed up
+			if entries[4].Tuple != nil || entries[5].Tuple != nil {
+				t.Errorf("%.4X: expected no tuples that are not on a backed up page but got %v %v", version, entries[4].Tuple, entries[5].Tuple)
+			}
+
+			cursor, err := wal.NewCursorAt(w.Source(), start)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer cursor.Close()
+
+			record, _, err := cursor.ReadRecord()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			blocks, err := record.Body.BackupBlocks()
+			if err != nil || len(blocks) != 1 {
+				t.Fatalf("%.4X: expected a backup block but got %v: %v", version, blocks, err)
+			}
+
+			block := blocks[0]
+			if block.ID != 0 || block.RelationID != relation.RelationID || block.DatabaseID != relation.DatabaseID || block.Block != 7 || block.HoleLength == 0 {
+				t.Errorf("%.4X: expected block 7 of %v with a hole but got %v", version, relation, block)
+			}
+
+			if restored, err := block.Page(); err != nil || len(restored) != int(pageSize) || !bytes.Equal(restored[:len(page)], page) {
+				t.Errorf("%.4X: expected the page back from its image: %v", version, err)
+			}
+		}
+	}
+}
+
+func TestStorageRecordsReadBack(t *testing.T) {
+	for _, version := range versions {
+		start := wal.NewLocationWithDefaults(0x13000000)
+		w, err := NewWriter(version, start)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rewritten, index := RelFileNode{1663, 16384, 16400}, RelFileNode{1663, 16384, 16401}
+
+		w.Create(200, rewritten)
+		w.Truncate(200, relation, 0)
+		w.Truncate(0, relation, 12)
+		commit := w.CommitDropping(200, now, []RelFileNode{relation, index}, 201)
+
+		entries := readAllFromStart(t, w, start)
+		expected := []struct {
+			typ    wal.RecordType
+			xid    uint32
+			rel    RelFileNode
+			blocks uint32
+		}{
+			{wal.Create, 200, rewritten, 0},
+			{wal.Truncate, 200, relation, 0},
+			{wal.Truncate, 0, relation, 12},
+			{wal.Drop, 200, relation, 0},
+			{wal.Drop, 200, index, 0},
+			{wal.Commit, 200, RelFileNode{}, 0},
+		}
+
+		if len(entries) != len(expected) {
+			t.Fatalf("%.4X: expected %v entries but got %v: %v", version, len(expected), len(entries), entries)
+		}
+
+		for i, exp := range expected {
+			entry := entries[i]
+			rel := RelFileNode{entry.TablespaceID, entry.DatabaseID, entry.RelationID}
+			if entry.Type != exp.typ || entry.TransactionID != exp.xid || rel != exp.rel || entry.ToBlock != exp.blocks {
+				t.Errorf("%.4X: expected %v of %v to %v blocks by %v but got %v", version, exp.typ, exp.rel, exp.blocks, exp.xid, entry)
+			}
+		}
+
+		// the drops are read from the commit record, which is where they are in the wal
+		if entries[3].ReadFrom != commit || entries[4].ReadFrom != commit {
+			t.Errorf("%.4X: expected the drops to be read from the commit at %v but got %v and %v", version, commit, entries[3].ReadFrom, entries[4].ReadFrom)
+		}
+	}
+}
+
+func TestCommitDataReadBack(t *testing.T) {
+	for _, version := range append(versions, wal.Magic95) {
+		start := wal.NewLocationWithDefaults(0x13000000)
+		w, err := NewWriter(version, start)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		w.Commit(300, now, 301, 302)
+		w.Abort(303, now.Add(time.Second), 304)
+		if version == wal.Magic94 {
+			w.CompactCommit(305, now.Add(2*time.Second), 306)
+		}
+
+		entries := readAllFromStart(t, w, start)
+		expected := []struct {
+			typ      wal.RecordType
+			xid      uint32
+			time     time.Time
+			subxacts []uint32
+		}{
+			{wal.Commit, 300, now, []uint32{301, 302}},
+			{wal.Abort, 303, now.Add(time.Second), []uint32{304}},
+			{wal.Commit, 305, now.Add(2 * time.Second), []uint32{306}},
+		}
+
+		// only 9.4 has compact commits
+		if version != wal.Magic94 {
+			expected = expected[:2]
+		}
+
+		if len(entries) != len(expected) {
+			t.Fatalf("%.4X: expected %v entries but got %v: %v", version, len(expected), len(entries), entries)
+		}
+
+		for i, exp := range expected {
+			entry := entries[i]
+			if entry.Type != exp.typ || entry.TransactionID != exp.xid || entry.CommitData == nil {
+				t.Errorf("%.4X: expected %v of %v with its commit data but got %v", version, exp.typ, exp.xid, entry)
+				continue
+			}
+
+			commit := entry.CommitData
+			if !commit.Time.Equal(exp.time) || fmt.Sprint(commit.Subtransactions) != fmt.Sprint(exp.subxacts) {
+				t.Errorf("%.4X: expected %v of %v at %v with %v but got %v with %v", version, exp.typ, exp.xid, exp.time, exp.subxacts, commit.Time, commit.Subtransactions)
+			}
+		}
+	}
+}
+
+func TestRecordsAcrossLogIDs(t *testing.T) {
+	for _, version := range append(versions, wal.Magic95) {
+		// small segments so that a few pages of records cross from the last segment of log id 0 into log id 1
+		start := wal.NewLocation(0xFFFE0000, 1, 0x10000, 0x2000, 8)
+		w, err := NewWriter(version, start)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var locations []wal.Location
+		for xid := uint32(1000); len(locations) == 0 || locations[len(locations)-1].Offset() < 0x100008000; xid++ {
+			locations = append(locations, w.CommitDropping(xid, now, []RelFileNode{relation}))
+		}
+
+		// releases before 9.3 never write the last segment of a log id, later ones do
+		lastSegment := 0
+		for _, location := range locations {
+			if location.LogID() == 0 && location.SegmentID() == 0xFFFF {
+				lastSegment++
+			}
+		}
+
+		if skips := version == wal.Magic91; skips != (lastSegment == 0) {
+			t.Errorf("%.4X: expected the last segment of log id 0 to be skipped %v but it holds %v records", version, skips, lastSegment)
+		}
+
+		entries := readAllFromStart(t, w, start)
+		var commits []wal.Entry
+		for _, entry := range entries {
+			if entry.Type == wal.Commit {
+				commits = append(commits, entry)
+			}
+		}
+
+		if len(commits) != len(locations) {
+			t.Fatalf("%.4X: expected %v commits but got %v ending at %v", version, len(locations), len(commits), commits[len(commits)-1].ReadFrom)
+		}
+
+		for i, commit := range commits {
+			if commit.ReadFrom.Offset() != locations[i].Offset() || commit.TransactionID != uint32(1000+i) {
+				t.Errorf("%.4X: expected commit of %v at %v but got %v", version, 1000+i, locations[i], commit)
+			}
+		}
+
+		// a cursor from pg_control knows whether the last segment is skipped from the release of the data directory
+		dir, err := ioutil.TempDir("", "waltest")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		if err := w.WriteDataDir(dir); err != nil {
+			t.Fatal(err)
+		}
+
+		cursor, err := wal.NewCursorAtCheckpoint(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if read := readAll(t, cursor); len(read) != len(entries) {
+			t.Errorf("%.4X: expected %v entries from the checkpoint but got %v", version, len(entries), len(read))
+		}
+		cursor.Close()
+	}
+}
+
+func TestCursorAtOldestSegment(t *testing.T) {
+	dir, err := ioutil.TempDir("", "waltest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// small segments so that the filler continues into the second segment
+	w, err := NewWriter(wal.Magic94, wal.NewLocation(0x130000, 1, 0x10000, 0x2000, 8))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := w.Insert(1, relation, ItemPointer{0, 1}, NewTuple(1, []byte("keryx")))
+	w.Record(0, 0, 1, make([]byte, 0x10000))
+	second := w.Commit(1, now)
+
+	if err := w.WriteDataDir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	cursor, err := wal.NewCursorAtOldestSegment(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cursor.Location() != first {
+		t.Errorf("expected the oldest segment to start with %v but got %v", first, cursor.Location())
+	}
+	cursor.Close()
+
+	// without the first segment the first record is the one after the continuation of the filler
+	if err := os.Remove(filepath.Join(dir, "pg_xlog", first.Filename())); err != nil {
+		t.Fatal(err)
+	}
+
+	cursor, err = wal.NewCursorAtOldestSegment(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cursor.Close()
+
+	if cursor.Location() != second {
+		t.Errorf("expected the oldest segment to start with %v but got %v", second, cursor.Location())
+	}
+}
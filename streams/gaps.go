@@ -0,0 +1,99 @@
+package streams
+
+// Copyright 2015 MediaMath <http://www.mediamath.com>.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+import (
+	"log"
+	"sync"
+
+	"github.com/MediaMath/keryxlib/message"
+)
+
+//gapQueue keeps every gap until it is read or the stream stops, so reading the WAL is not held up by a consumer that
+//reads gaps slowly or not at all and the gaps are not dropped while the stream runs
+type gapQueue struct {
+	out     chan message.Gap
+	changed chan struct{}
+
+	lock    sync.Mutex
+	pending []message.Gap
+	closed  bool
+}
+
+func newGapQueue() *gapQueue {
+	return &gapQueue{out: make(chan message.Gap), changed: make(chan struct{}, 1)}
+}
+
+//add queues a gap without waiting for it to be read
+func (q *gapQueue) add(gap message.Gap) {
+	q.lock.Lock()
+	q.pending = append(q.pending, gap)
+	q.lock.Unlock()
+
+	q.signal()
+}
+
+//close ends the channel once the gaps already added are read
+func (q *gapQueue) close() {
+	q.lock.Lock()
+	q.closed = true
+	q.lock.Unlock()
+
+	q.signal()
+}
+
+func (q *gapQueue) signal() {
+	select {
+	case q.changed <- struct{}{}:
+	default:
+	}
+}
+
+//deliver sends the gaps on out in the order they were added and closes it after the last one once the queue is closed.
+//The gaps that are not read by the time done is closed are dropped, so a stopped stream does not wait on a consumer.
+func (q *gapQueue) deliver(done <-chan interface{}) {
+	defer close(q.out)
+
+	for {
+		q.lock.Lock()
+		pending, closed := q.pending, q.closed
+		q.lock.Unlock()
+
+		switch {
+		case len(pending) > 0:
+			select {
+			case q.out <- pending[0]:
+				q.lock.Lock()
+				q.pending = q.pending[1:]
+				q.lock.Unlock()
+
+			case <-done:
+				q.drop()
+				return
+			}
+
+		case closed:
+			return
+
+		default:
+			select {
+			case <-q.changed:
+			case <-done:
+				q.drop()
+				return
+			}
+		}
+	}
+}
+
+func (q *gapQueue) drop() {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if len(q.pending) > 0 {
+		log.Printf("dropping %v gaps that were not read before the stream stopped", len(q.pending))
+	}
+	q.pending = nil
+}
@@ -0,0 +1,121 @@
+package streams
+
+// Copyright 2015 MediaMath <http://www.mediamath.com>.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/MediaMath/keryxlib/filters"
+	"github.com/MediaMath/keryxlib/message"
+	"github.com/MediaMath/keryxlib/pg"
+	"github.com/MediaMath/keryxlib/pg/wal"
+	"github.com/MediaMath/keryxlib/pg/wal/waltest"
+)
+
+func TestPipelineOverWrittenWal(t *testing.T) {
+	for _, version := range []uint16{wal.Magic91, wal.Magic94} {
+		dir, err := ioutil.TempDir("", "pipeline")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		w, err := waltest.NewWriter(version, wal.NewLocationWithDefaults(0x13000000))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// postgres logs commit times to the microsecond, an hour before they are read
+		rel, now := waltest.RelFileNode{TablespaceID: 1663, DatabaseID: 16384, RelationID: 16385}, time.Now().Add(-time.Hour).Truncate(time.Microsecond)
+		w.Insert(100, rel, waltest.ItemPointer{Block: 0, Offset: 1}, waltest.NewTuple(1, []byte("a")))
+		w.Insert(101, rel, waltest.ItemPointer{Block: 0, Offset: 2}, waltest.NewTuple(1, []byte("b")))
+		w.Update(100, rel, waltest.ItemPointer{Block: 0, Offset: 1}, waltest.ItemPointer{Block: 1, Offset: 1}, waltest.NewTuple(1, []byte("c")))
+		w.Abort(101, now)
+		w.Delete(100, rel, waltest.ItemPointer{Block: 1, Offset: 1})
+		w.Commit(100, now)
+		w.Insert(105, rel, waltest.ItemPointer{Block: 2, Offset: 2}, waltest.NewTuple(1, []byte("e")))
+		w.Insert(102, rel, waltest.ItemPointer{Block: 2, Offset: 1}, waltest.NewTuple(1, []byte("d")))
+		w.Commit(102, now, 105)
+		w.Create(103, waltest.RelFileNode{TablespaceID: 1663, DatabaseID: 16384, RelationID: 16400})
+		w.Commit(103, now)
+		w.Truncate(0, rel, 2)
+		w.Truncate(104, rel, 0)
+		w.CommitDropping(104, now, []waltest.RelFileNode{rel})
+
+		if err := w.WriteDataDir(dir); err != nil {
+			t.Fatal(err)
+		}
+
+		walStream, err := NewWalStream(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		walStream.PollEvery(10 * time.Millisecond)
+		defer walStream.Stop()
+
+		entries, err := walStream.Start()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		buffer := &TxnBuffer{Filters: filters.FilterNone("pipeline"), WorkingDirectory: dir}
+		committed, err := buffer.Start(entries)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		populated := &PopulatedMessageStream{Filters: filters.FilterNone("pipeline"), SchemaReader: &pg.SchemaReader{}}
+		txns, err := populated.Start("test", committed)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := []struct {
+			xid      uint32
+			subxacts []uint32
+			types    []message.Type
+		}{
+			{100, nil, []message.Type{message.InsertMessage, message.UpdateMessage, message.DeleteMessage}},
+			{102, []uint32{105}, []message.Type{message.InsertMessage, message.InsertMessage}},
+			{104, nil, []message.Type{message.TruncateMessage, message.RelationRewriteMessage}},
+		}
+
+		for _, exp := range expected {
+			select {
+			case txn := <-txns:
+				if txn.TransactionID != exp.xid || len(txn.Messages) != len(exp.types) {
+					t.Fatalf("%.4X: expected transaction %v with %v messages but got %v with %v", version, exp.xid, len(exp.types), txn.TransactionID, txn.Messages)
+				}
+
+				if !txn.CommitTime.Equal(now) || !txn.ParseTime.After(now) || fmt.Sprint(txn.Subtransactions) != fmt.Sprint(exp.subxacts) {
+					t.Errorf("%.4X: expected transaction %v committed at %v with %v but got %v parsed at %v with %v", version, exp.xid, now, exp.subxacts, txn.CommitTime, txn.ParseTime, txn.Subtransactions)
+				}
+
+				// each subtransaction made one change before its parent's
+				for i, msg := range txn.Messages {
+					xid := exp.xid
+					if i < len(exp.subxacts) {
+						xid = exp.subxacts[i]
+					}
+
+					if msg.Type != exp.types[i] || msg.RelationID != rel.RelationID || msg.TransactionID != xid {
+						t.Errorf("%.4X: expected %v of %v in transaction %v but got %v", version, exp.types[i].String(), rel.RelationID, xid, msg.String())
+					}
+
+					// without a connection nothing names the dropped relfilenode, which is still published
+					if msg.Type == message.RelationRewriteMessage && (msg.Relation != "" || msg.PopulationError == "") {
+						t.Errorf("%.4X: expected the rewrite to have a population error but got %v", version, msg.String())
+					}
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("%.4X: timed out waiting for transaction %v", version, exp.xid)
+			}
+		}
+	}
+}
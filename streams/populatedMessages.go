@@ -19,19 +19,36 @@ type PopulatedMessageStream struct {
 	Filters         filters.MessageFilter
 	SchemaReader    *pg.SchemaReader
 	MaxMessageCount uint
+	PositionStore   PositionStore
+	Watermark       *Watermark
 }
 
 func (b *PopulatedMessageStream) populateTransaction(txn *message.Transaction, entries []*wal.Entry) {
+	var created []uint32
+	for _, entry := range entries {
+		if entry.Type == wal.Create {
+			created = append(created, entry.RelationID)
+		}
+	}
+
 	var messages []message.Message
 	for _, entry := range entries {
 		if entry.Type == wal.Insert || entry.Type == wal.Update || entry.Type == wal.Delete {
 			msg := createMessage(entry)
 
 			msg.PopulateTime = time.Now().UTC()
-			b.populate(msg)
+			b.populate(msg, entry)
 			msg.PopulateDuration = time.Now().UTC().Sub(msg.PopulateTime)
 
 			messages = append(messages, *msg)
+		} else if entry.Type == wal.Truncate || entry.Type == wal.Drop {
+			msg := createMessage(entry)
+
+			msg.PopulateTime = time.Now().UTC()
+			if b.populateRelationChange(msg, created) {
+				msg.PopulateDuration = time.Now().UTC().Sub(msg.PopulateTime)
+				messages = append(messages, *msg)
+			}
 		}
 	}
 
@@ -62,19 +79,26 @@ func (b *PopulatedMessageStream) populateBigTransaction(txn *message.Transaction
 	txn.Tables = tables
 }
 
-//Start begins async selecting on the WAL transaction buffer channel
+//Start begins async selecting on the WAL transaction buffer channel.  With a Watermark the position is recorded as transactions are acknowledged, otherwise it is recorded in the PositionStore as they are delivered.
 func (b *PopulatedMessageStream) Start(serverVersion string, entryChan <-chan []*wal.Entry) (<-chan *message.Transaction, error) {
 	txns := make(chan *message.Transaction)
 	go func() {
 		for entries := range entryChan {
-			if len(entries) > 0 {
+			if len(entries) > 0 && !hasChanges(entries[:len(entries)-1]) {
+				// a transaction that only changed the definitions of relations is not published
+				b.invalidateSchemas(entries)
+			} else if len(entries) > 0 {
 				txn := &message.Transaction{}
 				txn.ServerVersion = serverVersion
 
 				commit := entries[len(entries)-1]
 				txn.TransactionID = commit.TransactionID
 				txn.CommitKey = createKey(commit)
-				txn.CommitTime = time.Unix(0, commit.ParseTime).UTC()
+				txn.CommitTime = commitTime(commit)
+				txn.ParseTime = time.Unix(0, commit.ParseTime).UTC()
+				if commit.CommitData != nil {
+					txn.Subtransactions = commit.CommitData.Subtransactions
+				}
 
 				first := entries[0]
 				txn.FirstKey = createKey(first)
@@ -84,9 +108,18 @@ func (b *PopulatedMessageStream) Start(serverVersion string, entryChan <-chan []
 				} else {
 					b.populateBigTransaction(txn, entries)
 				}
+				b.invalidateSchemas(entries)
 
 				txn.TransactionTime = time.Now().UTC()
-				txns <- txn
+				if b.Watermark != nil {
+					commitKey := txn.CommitKey
+					b.Watermark.Delivered(commitKey)
+					txn.OnAck(func() { b.Watermark.Ack(commitKey) })
+					txns <- txn
+				} else {
+					txns <- txn
+					savePosition(b.PositionStore, txn.CommitKey)
+				}
 			}
 		}
 		close(txns)
@@ -95,12 +128,123 @@ func (b *PopulatedMessageStream) Start(serverVersion string, entryChan <-chan []
 	return txns, nil
 }
 
+//populateRelationChange names the relation a truncate or a dropped relfilenode is of, and finds the relfilenode the
+//transaction created that replaced a dropped one.  The database no longer has a dropped relfilenode, so it is named from
+//the schema cache or by the oid of its relation, which is the relfilenode a relation has until it is first rewritten.
+//Only the indexes and toast tables a rewrite drops along with a table are left out, a dropped relfilenode that cannot be
+//named is published with a population error.
+func (b *PopulatedMessageStream) populateRelationChange(rvMsg *message.Message, created []uint32) bool {
+	rvMsg.DatabaseName = b.SchemaReader.GetDatabaseName(rvMsg.DatabaseID)
+
+	if rvMsg.Type == message.TruncateMessage {
+		rvMsg.Namespace, rvMsg.Relation = b.SchemaReader.GetNamespaceAndTable(rvMsg.DatabaseID, rvMsg.RelationID)
+		return true
+	}
+
+	rvMsg.Namespace, rvMsg.Relation = b.SchemaReader.CachedNamespaceAndTable(rvMsg.DatabaseID, rvMsg.RelationID)
+	if !b.SchemaReader.HaveConnectionToDb(rvMsg.DatabaseID) {
+		if rvMsg.Relation == "" {
+			rvMsg.PopulationError = fmt.Sprintf("no name for dropped relfilenode %v", rvMsg.RelationID)
+		}
+		return true
+	}
+
+	// the catalog only has the relation and the relfilenodes that replaced it once the commit is replayed
+	curLoc, lrl, waits := b.waitForLogToCatchUp(rvMsg)
+	rvMsg.PopulateWait = waits
+	if lrl >= curLoc {
+		rvMsg.PopulateLag = lrl - curLoc
+	}
+
+	if rvMsg.Relation == "" {
+		rel, err := b.SchemaReader.GetRelationByOID(rvMsg.DatabaseID, rvMsg.RelationID)
+		if err != nil {
+			rvMsg.PopulationError = err.Error()
+			return true
+		} else if rel == nil {
+			rvMsg.PopulationError = fmt.Sprintf("no name for dropped relfilenode %v", rvMsg.RelationID)
+			return true
+		} else if rel.IsIndexOrToast() {
+			return false
+		}
+
+		rvMsg.Namespace, rvMsg.Relation = rel.Namespace, rel.Table
+	}
+
+	newRelationID, err := b.newRelationID(rvMsg, created)
+	if err != nil {
+		rvMsg.PopulationError = err.Error()
+	} else if newRelationID != rvMsg.RelationID {
+		rvMsg.NewRelationID = newRelationID
+	}
+
+	return true
+}
+
+//newRelationID finds the relfilenode the transaction created for the relation of a dropped relfilenode.  It is the one
+//the relation has now when the one created has been replaced since, and 0 when the relation was dropped.
+func (b *PopulatedMessageStream) newRelationID(rvMsg *message.Message, created []uint32) (uint32, error) {
+	for _, relationID := range created {
+		rel, err := b.SchemaReader.GetRelationByRelationID(rvMsg.DatabaseID, relationID)
+		if err != nil {
+			return 0, err
+		} else if rel != nil && rel.Namespace == rvMsg.Namespace && rel.Table == rvMsg.Relation {
+			return relationID, nil
+		}
+	}
+
+	return b.SchemaReader.GetRelationID(rvMsg.DatabaseID, rvMsg.Namespace, rvMsg.Relation)
+}
+
+//invalidateSchemas forgets the schemas of the relfilenodes a transaction truncated or dropped, a relfilenode that is
+//reused must not be named or decoded with the schema of the relation that had it before.  The schemas of the relations
+//whose definitions the transaction changed are forgotten once the commit is replayed.  The filters are told to map the
+//relfilenodes that replaced the dropped ones.
+func (b *PopulatedMessageStream) invalidateSchemas(entries []*wal.Entry) {
+	dropped := false
+	for _, entry := range entries {
+		if entry.Type == wal.Truncate || entry.Type == wal.Drop {
+			b.SchemaReader.Invalidate(entry.DatabaseID, entry.RelationID)
+			dropped = dropped || entry.Type == wal.Drop
+		}
+	}
+
+	commit, replayed := entries[len(entries)-1], false
+	if commit.CommitData != nil {
+		for _, invalidated := range commit.CommitData.InvalidatedRelations {
+			if !b.SchemaReader.HaveConnectionToDb(invalidated.DatabaseID) {
+				continue
+			}
+
+			if !replayed {
+				b.waitForReplay(commit.ReadFrom.Offset())
+				replayed = true
+			}
+
+			if err := b.SchemaReader.InvalidateRelation(invalidated.DatabaseID, invalidated.RelationOID); err != nil {
+				// without the relfilenode of the relation every schema of its database is read again
+				b.SchemaReader.InvalidateRelation(invalidated.DatabaseID, 0)
+			}
+		}
+	}
+
+	if invalidator, ok := b.Filters.(filters.Invalidator); ok && dropped {
+		invalidator.InvalidateRelIDs()
+	}
+}
+
 func (b *PopulatedMessageStream) waitForLogToCatchUp(rvMsg *message.Message) (curLoc uint64, lrl uint64, waits int) {
 
 	curLoc = uint64(rvMsg.LogID)<<32 + uint64(rvMsg.RecordOffset)
+	lrl, waits = b.waitForReplay(curLoc)
 
+	return
+}
+
+func (b *PopulatedMessageStream) waitForReplay(curLoc uint64) (lrl uint64, waits int) {
+	// there is nothing to wait for without a replay location
 	lrl = b.SchemaReader.LatestReplayLocation()
-	for curLoc > lrl {
+	for lrl != 0 && curLoc > lrl {
 		<-time.After(time.Second)
 		lrl = b.SchemaReader.LatestReplayLocation()
 		waits++
@@ -109,18 +253,62 @@ func (b *PopulatedMessageStream) waitForLogToCatchUp(rvMsg *message.Message) (cu
 	return
 }
 
-func (b *PopulatedMessageStream) populate(rvMsg *message.Message) {
-	curLoc, lrl, waits := b.waitForLogToCatchUp(rvMsg)
-	rvMsg.PopulateWait = waits
-	rvMsg.PopulateLag = lrl - curLoc
+func (b *PopulatedMessageStream) decodeTuple(rvMsg *message.Message, tuple wal.TupleData, decode func(wal.TupleData, *pg.Schema, int) ([]message.Field, error)) ([]message.Field, error) {
+	if tuple == nil {
+		return nil, fmt.Errorf("no tuple logged")
+	}
 
+	schema, err := b.SchemaReader.GetSchema(rvMsg.DatabaseID, rvMsg.RelationID)
+	if err == nil && schema != nil && tuple.NumberOfAttributes() > len(schema.Attributes) {
+		// columns were added since the schema was read, adding them does not give the relation a new relfilenode
+		b.SchemaReader.Invalidate(rvMsg.DatabaseID, rvMsg.RelationID)
+		schema, err = b.SchemaReader.GetSchema(rvMsg.DatabaseID, rvMsg.RelationID)
+	}
+
+	if err != nil {
+		return nil, err
+	} else if schema == nil {
+		return nil, fmt.Errorf("no schema for %v, %v", rvMsg.DatabaseID, rvMsg.RelationID)
+	}
+
+	return decode(tuple, schema, int(b.SchemaReader.FieldSizeLimit()))
+}
+
+func (b *PopulatedMessageStream) populate(rvMsg *message.Message, entry *wal.Entry) {
 	if rvMsg.Type == message.InsertMessage || rvMsg.Type == message.UpdateMessage || rvMsg.Type == message.DeleteMessage {
 		rvMsg.DatabaseName = b.SchemaReader.GetDatabaseName(rvMsg.DatabaseID)
 		rvMsg.Namespace, rvMsg.Relation = b.SchemaReader.GetNamespaceAndTable(rvMsg.DatabaseID, rvMsg.RelationID)
 	}
 
+	if (rvMsg.Type == message.UpdateMessage || rvMsg.Type == message.DeleteMessage) && entry.OldTuple != nil {
+		if fields, err := b.decodeTuple(rvMsg, entry.OldTuple, wal.DecodeOldTuple); err != nil {
+			rvMsg.PopulationError = fmt.Sprintf("failed to decode old tuple: %v", err)
+		} else {
+			for _, f := range fields {
+				if !b.Filters.FilterColumn(rvMsg.RelFullName(), f.Name) {
+					rvMsg.AppendOldField(f.Name, f.Kind, f.Value)
+				}
+			}
+		}
+	}
+
 	if rvMsg.Type == message.InsertMessage || rvMsg.Type == message.UpdateMessage {
 
+		if fields, err := b.decodeTuple(rvMsg, entry.Tuple, wal.DecodeTuple); err == nil {
+			for _, f := range fields {
+				if !b.Filters.FilterColumn(rvMsg.RelFullName(), f.Name) {
+					rvMsg.AppendField(f.Name, f.Kind, f.Value)
+				}
+			}
+			return
+		}
+
+		curLoc, lrl, waits := b.waitForLogToCatchUp(rvMsg)
+		rvMsg.PopulateWait = waits
+		if lrl >= curLoc {
+			rvMsg.PopulateLag = lrl - curLoc
+		}
+
 		vs, err := b.SchemaReader.GetFieldValues(rvMsg.DatabaseID, rvMsg.RelationID, rvMsg.Block, rvMsg.Offset)
 		if err != nil {
 			rvMsg.PopulationError = fmt.Sprintf("%v - (%v, %v, %v)", err.Error(), curLoc, lrl, waits)
@@ -137,6 +325,15 @@ func (b *PopulatedMessageStream) populate(rvMsg *message.Message) {
 
 }
 
+//commitTime is when postgres committed the transaction of a commit entry, or when the commit was read without the time
+func commitTime(commit *wal.Entry) time.Time {
+	if commit.CommitData == nil {
+		return time.Unix(0, commit.ParseTime).UTC()
+	}
+
+	return commit.CommitData.Time.UTC()
+}
+
 func createKey(entry *wal.Entry) message.Key {
 	return message.NewKey(entry.TimelineID, entry.ReadFrom.LogID(), entry.ReadFrom.RecordOffset())
 }
@@ -185,6 +382,13 @@ func createMessage(entry *wal.Entry) *message.Message {
 	case wal.Commit:
 		msg.Type = message.CommitMessage
 
+	case wal.Truncate:
+		msg.Type = message.TruncateMessage
+		msg.Block = entry.ToBlock
+
+	case wal.Drop:
+		msg.Type = message.RelationRewriteMessage
+
 	default:
 		msg.Type = message.UnknownMessage
 	}
@@ -7,6 +7,9 @@ package streams
 import (
 	"testing"
 
+	"github.com/MediaMath/keryxlib/filters"
+	"github.com/MediaMath/keryxlib/message"
+	"github.com/MediaMath/keryxlib/pg"
 	"github.com/MediaMath/keryxlib/pg/wal"
 )
 
@@ -69,3 +72,53 @@ func TestMessageFactoryCreateMessageXLogCommit(t *testing.T) {
 
 	FailIfTrue(t, message.Type.String() != "CommitMessage", "MessageType.String() broken")
 }
+
+func TestMessageFactoryCreateMessageRelationChanges(t *testing.T) {
+
+	truncate := createMessage(&wal.Entry{Type: wal.Truncate, RelationID: 16385, ToBlock: 3})
+
+	FailIfTrue(t, truncate.Type != message.TruncateMessage || truncate.Block != 3, "Wrong truncate message")
+
+	drop := createMessage(&wal.Entry{Type: wal.Drop, RelationID: 16385})
+
+	FailIfTrue(t, drop.Type != message.RelationRewriteMessage || drop.RelationID != 16385, "Wrong rewrite message")
+}
+
+func TestPopulateRelationChangeWithoutName(t *testing.T) {
+	stream := &PopulatedMessageStream{Filters: filters.FilterNone("populate"), SchemaReader: &pg.SchemaReader{}}
+
+	// a rewrite of a relation that was never read is published even though it cannot be named
+	txn := &message.Transaction{}
+	stream.populateTransaction(txn, []*wal.Entry{
+		{Type: wal.Create, TransactionID: 10, DatabaseID: 16384, RelationID: 16401},
+		{Type: wal.Drop, TransactionID: 10, DatabaseID: 16384, RelationID: 16385},
+		{Type: wal.Commit, TransactionID: 10},
+	})
+
+	FailIfTrue(t, len(txn.Messages) != 1, "Rewrite left out")
+	FailIfTrue(t, txn.Messages[0].Type != message.RelationRewriteMessage || txn.Messages[0].PopulationError == "", "Rewrite without a population error")
+}
+
+func TestDefinitionChangesAreNotPublished(t *testing.T) {
+	stream := &PopulatedMessageStream{Filters: filters.FilterNone("populate"), SchemaReader: &pg.SchemaReader{}}
+
+	entries := make(chan []*wal.Entry, 2)
+	entries <- []*wal.Entry{
+		{Type: wal.Commit, TransactionID: 10, CommitData: &wal.CommitData{InvalidatedRelations: []wal.RelationInvalidation{{DatabaseID: 16384, RelationOID: 16385}}}},
+	}
+	entries <- []*wal.Entry{
+		{Type: wal.Truncate, TransactionID: 11, DatabaseID: 16384, RelationID: 16385},
+		{Type: wal.Commit, TransactionID: 11},
+	}
+	close(entries)
+
+	txns, err := stream.Start("test", entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	txn := <-txns
+	FailIfTrue(t, txn == nil || txn.TransactionID != 11, "Transaction without changes published")
+	_, more := <-txns
+	FailIfTrue(t, more, "Unexpected transaction")
+}
@@ -0,0 +1,105 @@
+package streams
+
+// Copyright 2015 MediaMath <http://www.mediamath.com>.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/MediaMath/keryxlib/message"
+)
+
+//PositionStore keeps the commit key of the last transaction delivered so a stream can resume after it.
+type PositionStore interface {
+	//Load returns the saved commit key or message.EmptyKey if nothing has been saved.
+	Load() (message.Key, error)
+	//Save records the commit key of a delivered transaction.
+	Save(key message.Key) error
+}
+
+//FilePositionStore is a PositionStore that keeps the commit key in a file.
+type FilePositionStore struct {
+	Path string
+}
+
+//NewFilePositionStore creates a PositionStore that keeps the commit key in the file at path.
+func NewFilePositionStore(path string) *FilePositionStore {
+	return &FilePositionStore{path}
+}
+
+//Load reads the commit key from the file, a missing file is message.EmptyKey.
+func (s *FilePositionStore) Load() (message.Key, error) {
+	bs, err := ioutil.ReadFile(s.Path)
+	if os.IsNotExist(err) {
+		return message.EmptyKey, nil
+	} else if err != nil {
+		return message.EmptyKey, err
+	}
+
+	key := message.KeyFromString(strings.TrimSpace(string(bs)))
+	if key == message.EmptyKey {
+		return key, nil
+	}
+
+	if _, _, _, err := message.ParseKey(key); err != nil {
+		return message.EmptyKey, err
+	}
+
+	return key, nil
+}
+
+//Save writes the commit key to a temporary file next to the file and renames it over the file so the file always
+//holds a complete key.
+func (s *FilePositionStore) Save(key message.Key) error {
+	temp, err := ioutil.TempFile(filepath.Dir(s.Path), filepath.Base(s.Path)+".tmp")
+	if err != nil {
+		return err
+	}
+
+	_, err = temp.WriteString(string(key) + "\n")
+	if err == nil {
+		err = temp.Sync()
+	}
+
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = os.Rename(temp.Name(), s.Path)
+	}
+
+	if err != nil {
+		os.Remove(temp.Name())
+	}
+
+	return err
+}
+
+//LoadPosition loads the commit key to resume after from a store, a nil store resumes from nothing.
+func LoadPosition(store PositionStore) (message.Key, error) {
+	if store == nil {
+		return message.EmptyKey, nil
+	}
+
+	return store.Load()
+}
+
+func savePosition(store PositionStore, key message.Key) {
+	if store == nil {
+		return
+	}
+
+	if err := store.Save(key); err != nil {
+		log.Printf("error saving position %v: %v", key, err)
+	}
+}
+
+func isDelivered(resumeAfter message.Key, key message.Key) bool {
+	return resumeAfter != message.EmptyKey && !message.Before(resumeAfter, key)
+}
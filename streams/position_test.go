@@ -0,0 +1,51 @@
+package streams
+
+// Copyright 2015 MediaMath <http://www.mediamath.com>.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/MediaMath/keryxlib/message"
+)
+
+func TestFilePositionStoreRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "position")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store := NewFilePositionStore(filepath.Join(dir, "position"))
+
+	key, err := store.Load()
+	FailIfTrue(t, err != nil || key != message.EmptyKey, "Missing position file should be empty")
+
+	for _, saved := range []message.Key{message.NewKey(1, 0, 0x038cefa8), message.NewKey(2, 1, 0x10)} {
+		FailIfTrue(t, store.Save(saved) != nil, "Save failed")
+
+		key, err = store.Load()
+		FailIfTrue(t, err != nil || key != saved, "Saved position not loaded")
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	FailIfTrue(t, err != nil || len(files) != 1, "Temporary files left behind")
+
+	FailIfTrue(t, ioutil.WriteFile(store.Path, []byte("garbage"), 0644) != nil, "Write failed")
+	_, err = store.Load()
+	FailIfTrue(t, err == nil, "Invalid key should not load")
+}
+
+func TestIsDelivered(t *testing.T) {
+	resumeAfter := message.NewKey(1, 0, 0x200)
+
+	FailIfTrue(t, !isDelivered(resumeAfter, message.NewKey(1, 0, 0x100)), "Earlier commit should be delivered")
+	FailIfTrue(t, !isDelivered(resumeAfter, resumeAfter), "Resume commit should be delivered")
+	FailIfTrue(t, isDelivered(resumeAfter, message.NewKey(1, 0, 0x300)), "Later commit should not be delivered")
+	FailIfTrue(t, isDelivered(resumeAfter, message.NewKey(2, 0, 0x100)), "Commit on a later timeline should not be delivered")
+	FailIfTrue(t, isDelivered(message.EmptyKey, message.NewKey(1, 0, 0x100)), "Nothing is delivered without a position")
+}
@@ -14,6 +14,7 @@ import (
 //SummaryStream returns a stream of message.TxnSummary
 type SummaryStream struct {
 	SchemaMetaInformation
+	PositionStore PositionStore
 }
 
 //SchemaMetaInformation provides textual information from wal log entry ids
@@ -28,14 +29,15 @@ func (s SummaryStream) Start(serverVersion string, entryChan <-chan []*wal.Entry
 
 	go func() {
 		for entries := range entryChan {
-			if len(entries) > 0 {
+			// a transaction that only changed the definitions of relations has nothing to summarize
+			if len(entries) > 0 && hasChanges(entries[:len(entries)-1]) {
 				txn := message.TxnSummary{}
 				txn.ServerVersion = serverVersion
 
 				commit := entries[len(entries)-1]
 				txn.TransactionID = commit.TransactionID
 				txn.CommitKey = createKey(commit)
-				txn.CommitTime = time.Unix(0, commit.ParseTime).UTC()
+				txn.CommitTime = commitTime(commit)
 				txn.MessageCount = len(entries)
 
 				txn.Tables = make(map[message.Table]message.Summary)
@@ -62,6 +64,7 @@ func (s SummaryStream) Start(serverVersion string, entryChan <-chan []*wal.Entry
 
 				txn.PublishTime = time.Now().UTC()
 				txns <- txn
+				savePosition(s.PositionStore, txn.CommitKey)
 			}
 		}
 		close(txns)
@@ -18,6 +18,10 @@ func TestCreateSummary(t *testing.T) {
 
 	entries <- []*wal.Entry{} //skipped
 
+	entries <- []*wal.Entry{
+		&wal.Entry{Type: wal.Commit, TransactionID: 80, CommitData: &wal.CommitData{InvalidatedRelations: []wal.RelationInvalidation{{DatabaseID: 1, RelationOID: 1}}}},
+	} //skipped, it only changed the definition of a relation
+
 	entries <- []*wal.Entry{
 		&wal.Entry{DatabaseID: 1, RelationID: 99, Type: wal.Insert},
 		&wal.Entry{DatabaseID: 1, RelationID: 1, Type: wal.Insert},
@@ -34,7 +38,7 @@ func TestCreateSummary(t *testing.T) {
 
 	close(entries)
 
-	summaries, err := SummaryStream{sr}.Start("boom", entries)
+	summaries, err := SummaryStream{SchemaMetaInformation: sr}.Start("boom", entries)
 
 	if err != nil {
 		t.Fatal(err)
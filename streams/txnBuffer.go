@@ -5,6 +5,8 @@ package streams
 // license that can be found in the LICENSE file.
 
 import (
+	"sort"
+
 	"github.com/MediaMath/keryxlib/filters"
 	"github.com/MediaMath/keryxlib/message"
 	"github.com/MediaMath/keryxlib/pg"
@@ -16,47 +18,47 @@ type TxnBuffer struct {
 	Filters          filters.MessageFilter
 	WorkingDirectory string
 	SchemaReader     *pg.SchemaReader
+	ResumeAfter      message.Key
 }
 
 func (b *TxnBuffer) filterRelation(entry *wal.Entry) bool {
-	return entry.RelationID > 0 && b.Filters.FilterRelID(entry.RelationID)
+	// new storage is not in the filters yet, it is kept to find the relfilenodes that replace the ones a transaction drops
+	return entry.Type != wal.Create && entry.RelationID > 0 && b.Filters.FilterRelID(entry.RelationID)
 }
 
 func (b *TxnBuffer) hasDatabaseConnection(entry *wal.Entry) bool {
 	return b.SchemaReader == nil || b.SchemaReader.HaveConnectionToDb(entry.DatabaseID)
 }
 
-//Start takes a channel of WAL entries and async selects on it.  As it finds a commit for a transaction it publishes a slice of the entries in that transaction.  Aborted transactions are not published. Rel filtering happens in this stream and not downstream.
+//Start takes a channel of WAL entries and async selects on it.  As it finds a commit for a transaction it publishes a slice of the entries in that transaction.  Aborted transactions are not published, nor are transactions committed at or before ResumeAfter as they have been delivered already. Rel filtering happens in this stream and not downstream.
 func (b *TxnBuffer) Start(entryChan <-chan *wal.Entry) (<-chan []*wal.Entry, error) {
 	txns := make(chan []*wal.Entry)
 
 	go func() {
-		buffer := message.NewBuffer(b.WorkingDirectory, 10*1024*wal.EntryBytesSize, wal.EntryBytesSize)
+		buffer := message.NewVariableBuffer(b.WorkingDirectory, 10*1024*wal.EntryBytesSize)
 		var lastEntry *wal.Entry
 		for entry := range entryChan {
 			if lastEntry != nil && lastEntry.ReadFrom.Offset() > entry.ReadFrom.Offset() {
 				continue
 			} else if entry.Type == wal.Unknown {
 				continue
-			} else if entry.Type != wal.Commit && (!b.hasDatabaseConnection(entry) || b.filterRelation(entry)) {
+			} else if entry.TransactionID == 0 {
+				// vacuum truncates relations outside of a transaction, there is nothing that commits them
+				continue
+			} else if entry.Type != wal.Commit && entry.Type != wal.Abort && (!b.hasDatabaseConnection(entry) || b.filterRelation(entry)) {
 				continue
 			}
 
 			lastEntry = entry
 
 			if entry.Type == wal.Commit {
-				entriesBytes := buffer.Remove(entry.TransactionID)
-				var entries []*wal.Entry
-				for _, entryBytes := range entriesBytes {
-					e := wal.EntryFromBytes(entryBytes)
-					entries = append(entries, &e)
-				}
-				if len(entries) != 0 {
+				entries := removeTransaction(buffer, entry)
+				if (hasChanges(entries) || invalidatesRelations(entry)) && !isDelivered(b.ResumeAfter, createKey(entry)) {
 					entries = append(entries, entry)
 					txns <- entries
 				}
 			} else if entry.Type == wal.Abort {
-				buffer.Remove(entry.TransactionID)
+				removeTransaction(buffer, entry)
 			} else {
 				buffer.Add(entry.TransactionID, entry.ToBytes())
 			}
@@ -67,3 +69,45 @@ func (b *TxnBuffer) Start(entryChan <-chan *wal.Entry) (<-chan []*wal.Entry, err
 
 	return txns, nil
 }
+
+//hasChanges is true when a transaction did more than create storage, which alone changes nothing that is published
+func hasChanges(entries []*wal.Entry) bool {
+	for _, entry := range entries {
+		if entry.Type != wal.Create {
+			return true
+		}
+	}
+
+	return false
+}
+
+//invalidatesRelations is true when a commit changed the definitions of relations, which is delivered without changes
+//so that the schemas cached for the relations are forgotten
+func invalidatesRelations(commit *wal.Entry) bool {
+	return commit.CommitData != nil && len(commit.CommitData.InvalidatedRelations) > 0
+}
+
+//removeTransaction removes the entries of the transaction a commit or abort ends from the buffer.  The changes of its
+//subtransactions are buffered by their own ids and are merged back in the order they were written.
+func removeTransaction(buffer *message.Buffer, end *wal.Entry) []*wal.Entry {
+	xids := []uint32{end.TransactionID}
+	if end.CommitData != nil {
+		xids = append(xids, end.CommitData.Subtransactions...)
+	}
+
+	var entries []*wal.Entry
+	for _, xid := range xids {
+		for _, entryBytes := range buffer.Remove(xid) {
+			e := wal.EntryFromBytes(entryBytes)
+			entries = append(entries, &e)
+		}
+	}
+
+	if len(xids) > 1 {
+		sort.SliceStable(entries, func(i, j int) bool {
+			return entries[i].ReadFrom.Offset() < entries[j].ReadFrom.Offset()
+		})
+	}
+
+	return entries
+}
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/MediaMath/keryxlib/filters"
+	"github.com/MediaMath/keryxlib/message"
 	"github.com/MediaMath/keryxlib/pg/wal"
 )
 
@@ -26,7 +27,7 @@ func TestBufferMessageForCommit(t *testing.T) {
 		walLog <- commitEntry
 	}()
 
-	buffer := &TxnBuffer{filters.FilterNone("buffer"), ".", nil}
+	buffer := &TxnBuffer{Filters: filters.FilterNone("buffer"), WorkingDirectory: "."}
 	txns, err := buffer.Start(walLog)
 	if err != nil {
 		t.Fatal(err)
@@ -46,3 +47,123 @@ func TestBufferMessageForCommit(t *testing.T) {
 		t.Fatal("Timedout")
 	}
 }
+
+func TestBufferSkipsDeliveredCommits(t *testing.T) {
+	entryAt := func(typ wal.RecordType, xid uint32, offset uint64) *wal.Entry {
+		return &wal.Entry{Type: typ, TransactionID: xid, TimelineID: 1, ReadFrom: wal.NewLocationWithDefaults(offset)}
+	}
+
+	walLog := make(chan *wal.Entry)
+
+	go func() {
+		walLog <- entryAt(wal.Update, 10, 0x100)
+		walLog <- entryAt(wal.Update, 11, 0x180)
+		walLog <- entryAt(wal.Commit, 10, 0x200)
+		walLog <- entryAt(wal.Commit, 11, 0x280)
+	}()
+
+	buffer := &TxnBuffer{Filters: filters.FilterNone("buffer"), WorkingDirectory: ".", ResumeAfter: message.NewKey(1, 0, 0x200)}
+	txns, err := buffer.Start(walLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case txn := <-txns:
+		FailIfTrue(t, len(txn) != 2, "Txn List not right")
+		FailIfTrue(t, txn[0].TransactionID != 11, "Delivered transaction published again")
+	case <-time.After(time.Second):
+		t.Fatal("Timedout")
+	}
+}
+
+func TestBufferSkipsStorageOutsideTransactions(t *testing.T) {
+	walLog := make(chan *wal.Entry)
+
+	go func() {
+		walLog <- &wal.Entry{Type: wal.Create, TransactionID: 10, RelationID: 16400}
+		walLog <- &wal.Entry{Type: wal.Truncate, TransactionID: 0, RelationID: 16385}
+		walLog <- &wal.Entry{Type: wal.Commit, TransactionID: 10}
+		walLog <- &wal.Entry{Type: wal.Create, TransactionID: 11, RelationID: 16401}
+		walLog <- &wal.Entry{Type: wal.Truncate, TransactionID: 11, RelationID: 16385}
+		walLog <- &wal.Entry{Type: wal.Drop, TransactionID: 11, RelationID: 16399}
+		walLog <- &wal.Entry{Type: wal.Commit, TransactionID: 11}
+	}()
+
+	buffer := &TxnBuffer{Filters: filters.FilterNone("buffer"), WorkingDirectory: "."}
+	txns, err := buffer.Start(walLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the create alone is not a change to deliver and the vacuum truncate is in no transaction, a create along with changes is kept
+	select {
+	case txn := <-txns:
+		FailIfTrue(t, len(txn) != 4, "Txn List not right")
+		FailIfTrue(t, txn[0].Type != wal.Create || txn[1].Type != wal.Truncate || txn[2].Type != wal.Drop || txn[3].TransactionID != 11, "Not matching value")
+	case <-time.After(time.Second):
+		t.Fatal("Timedout")
+	}
+}
+
+func TestBufferDeliversCommitsInvalidatingRelations(t *testing.T) {
+	walLog := make(chan *wal.Entry)
+
+	go func() {
+		walLog <- &wal.Entry{Type: wal.Commit, TransactionID: 10, CommitData: &wal.CommitData{}}
+		walLog <- &wal.Entry{Type: wal.Commit, TransactionID: 11, CommitData: &wal.CommitData{InvalidatedRelations: []wal.RelationInvalidation{{DatabaseID: 16384, RelationOID: 16385}}}}
+	}()
+
+	buffer := &TxnBuffer{Filters: filters.FilterNone("buffer"), WorkingDirectory: "."}
+	txns, err := buffer.Start(walLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a transaction that changed nothing is not delivered unless it changed the definition of a relation
+	select {
+	case txn := <-txns:
+		FailIfTrue(t, len(txn) != 1 || txn[0].TransactionID != 11, "Invalidating commit not delivered")
+	case <-time.After(time.Second):
+		t.Fatal("Timedout")
+	}
+}
+
+func TestBufferMergesSubtransactions(t *testing.T) {
+	entryAt := func(typ wal.RecordType, xid uint32, offset uint64) *wal.Entry {
+		return &wal.Entry{Type: typ, TransactionID: xid, TimelineID: 1, ReadFrom: wal.NewLocationWithDefaults(offset)}
+	}
+
+	walLog := make(chan *wal.Entry)
+
+	go func() {
+		walLog <- entryAt(wal.Insert, 10, 0x100)
+		walLog <- entryAt(wal.Update, 11, 0x180)
+		walLog <- entryAt(wal.Delete, 12, 0x200)
+		walLog <- entryAt(wal.Insert, 10, 0x280)
+
+		abort := entryAt(wal.Abort, 12, 0x300)
+		abort.CommitData = &wal.CommitData{}
+		walLog <- abort
+
+		commit := entryAt(wal.Commit, 10, 0x380)
+		commit.CommitData = &wal.CommitData{Subtransactions: []uint32{11, 12}}
+		walLog <- commit
+	}()
+
+	buffer := &TxnBuffer{Filters: filters.FilterNone("buffer"), WorkingDirectory: "."}
+	txns, err := buffer.Start(walLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the changes of the subtransaction that committed are delivered in the order they were written and those of the one rolled back to its savepoint are not
+	select {
+	case txn := <-txns:
+		FailIfTrue(t, len(txn) != 4, "Txn List not right")
+		FailIfTrue(t, txn[0].ReadFrom.Offset() != 0x100 || txn[1].TransactionID != 11 || txn[2].ReadFrom.Offset() != 0x280, "Not in wal order")
+		FailIfTrue(t, txn[3].Type != wal.Commit, "Not matching value")
+	case <-time.After(time.Second):
+		t.Fatal("Timedout")
+	}
+}
@@ -5,14 +5,41 @@ package streams
 // license that can be found in the LICENSE file.
 
 import (
+	"errors"
 	"fmt"
 	"log"
-	"os"
 	"time"
 
+	"github.com/MediaMath/keryxlib/message"
+	"github.com/MediaMath/keryxlib/pg"
+	"github.com/MediaMath/keryxlib/pg/control"
 	"github.com/MediaMath/keryxlib/pg/wal"
 )
 
+//CorruptRecordPolicy decides what a WalStream does when it reads a record that fails its crc check.
+type CorruptRecordPolicy string
+
+const (
+	//StopOnCorruptRecord ends the stream at the corrupt record.
+	StopOnCorruptRecord CorruptRecordPolicy = "stop"
+	//SkipCorruptRecord continues with the record following the corrupt record.
+	SkipCorruptRecord CorruptRecordPolicy = "skip"
+	//RescanAfterCorruptRecord continues with the first record starting on a page after the corrupt record.
+	RescanAfterCorruptRecord CorruptRecordPolicy = "rescan"
+)
+
+//ParseCorruptRecordPolicy converts a configured policy name to a policy, an empty name is StopOnCorruptRecord.
+func ParseCorruptRecordPolicy(name string) (CorruptRecordPolicy, error) {
+	switch policy := CorruptRecordPolicy(name); policy {
+	case "":
+		return StopOnCorruptRecord, nil
+	case StopOnCorruptRecord, SkipCorruptRecord, RescanAfterCorruptRecord:
+		return policy, nil
+	}
+
+	return "", fmt.Errorf("unknown corrupt record policy %q, expected %v, %v or %v", name, StopOnCorruptRecord, SkipCorruptRecord, RescanAfterCorruptRecord)
+}
+
 //WalStream is an abstraction around WAL entries.
 type WalStream struct {
 	dataDir             string
@@ -20,15 +47,94 @@ type WalStream struct {
 	done                chan interface{}
 	cursor              *wal.Cursor
 	lastOffsetPublished uint64
+	onCorruptRecord     CorruptRecordPolicy
+	resumeAfter         message.Key
+	gaps                *gapQueue
+	stillNeeded         wal.SegmentName
+	archiveDirs         []string
+	source              wal.SegmentSource
+	pollInterval        time.Duration
+	rangeFrom           uint64
+	rangeTo             uint64
+	bounded             bool
 }
 
 // NewWalStream creates a new WalStream pointed at the provided dataDir
 func NewWalStream(dataDir string) (*WalStream, error) {
-	s := &WalStream{dataDir, nil, make(chan interface{}), nil, 0}
+	s := &WalStream{dataDir, nil, make(chan interface{}), nil, 0, StopOnCorruptRecord, message.EmptyKey, newGapQueue(), wal.SegmentName{}, nil, nil, DefaultPollInterval, 0, 0, false}
+
+	return s, nil
+}
+
+// NewWalRangeStream creates a WalStream that reads the entries of the records from the first record at or after fromKey
+// through toKey and then closes its channel, or closes it at the end of the WAL it can read when that comes first.
+// Transactions that began before fromKey are missing the entries written before it.
+func NewWalRangeStream(dataDir string, fromKey, toKey message.Key) (*WalStream, error) {
+	from, err := keyOffset(fromKey)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read from %v: %v", fromKey, err)
+	}
+
+	to, err := keyOffset(toKey)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read to %v: %v", toKey, err)
+	}
+
+	if to < from {
+		return nil, fmt.Errorf("cannot read from %v to %v as it is before", fromKey, toKey)
+	}
+
+	s, err := NewWalStream(dataDir)
+	if err != nil {
+		return nil, err
+	}
+
+	s.rangeFrom, s.rangeTo, s.bounded = from, to, true
+	if from > 0 {
+		s.lastOffsetPublished = from - 1
+	}
 
 	return s, nil
 }
 
+func keyOffset(key message.Key) (uint64, error) {
+	_, logID, recordOffset, err := message.ParseKey(key)
+	return uint64(logID)<<32 + uint64(recordOffset), err
+}
+
+// OnCorruptRecord sets what the stream does when it reads a record that fails its crc check
+func (streamer *WalStream) OnCorruptRecord(policy CorruptRecordPolicy) {
+	streamer.onCorruptRecord = policy
+}
+
+// ResumeAfter makes Start read from the latest redo point at or before the commit key instead of the latest checkpoint
+func (streamer *WalStream) ResumeAfter(key message.Key) {
+	streamer.resumeAfter = key
+}
+
+// ReadArchives makes the stream look for segments that are not in the WAL directory in archive directories, in order
+func (streamer *WalStream) ReadArchives(dirs ...string) {
+	streamer.archiveDirs = dirs
+}
+
+// ReadSegmentsFrom makes the stream read segments from a source instead of the WAL and archive directories, pg_control
+// is still read from the data directory
+func (streamer *WalStream) ReadSegmentsFrom(source wal.SegmentSource) {
+	streamer.source = source
+}
+
+// PollEvery sets how often the WAL is read again when the stream cannot watch the directories segments are written to
+func (streamer *WalStream) PollEvery(interval time.Duration) {
+	streamer.pollInterval = interval
+}
+
+// Gaps returns a channel of the parts of the WAL that were removed before the stream read them.  Gaps are kept until
+// they are read without holding up the stream.  The channel is closed once the stream stops, dropping the gaps that
+// were not read.
+func (streamer *WalStream) Gaps() <-chan message.Gap {
+	return streamer.gaps.out
+}
+
 // Start begins streaming of events in a go routine and returns a channel of WAL entries
 func (streamer *WalStream) Start() (<-chan *wal.Entry, error) {
 	out := make(chan *wal.Entry)
@@ -36,18 +142,21 @@ func (streamer *WalStream) Start() (<-chan *wal.Entry, error) {
 	if streamer.publish == nil {
 		streamer.publish = out
 
-		err := streamer.startAtCheckpoint()
+		err := streamer.startAtResumePoint()
 		if err != nil {
 			return nil, err
 		}
 
-		tick := time.Tick(50 * time.Millisecond)
+		watcher := newWalWatcher(streamer.watchedDirs(), streamer.pollInterval)
 
+		go streamer.gaps.deliver(streamer.done)
 		go func() {
-			for !streamer.publishUntilErrorOrStopped() {
-				<-tick
+			for !streamer.publishUntilErrorOrStopped() && watcher.wait(streamer.done) {
 			}
+			watcher.close()
+			streamer.cursor.Close()
 			close(out)
+			streamer.gaps.close()
 			streamer.publish = nil
 		}()
 	} else {
@@ -63,15 +172,76 @@ func (streamer *WalStream) Stop() {
 	close(streamer.done)
 }
 
+// watchedDirs are the directories segments are read from, there are none to watch when segments come from another source
+func (streamer *WalStream) watchedDirs() []string {
+	if streamer.source != nil {
+		return nil
+	}
+
+	control, err := control.NewControlFromDataDir(streamer.dataDir)
+	if err != nil {
+		return nil
+	}
+
+	return append([]string{pg.WalDirectory(streamer.dataDir, control.Version)}, streamer.archiveDirs...)
+}
+
 func (streamer *WalStream) startAtCheckpoint() error {
-	cursor, err := wal.NewCursorAtCheckpoint(streamer.dataDir)
+	cursor, err := wal.NewCursorAtCheckpoint(streamer.dataDir, streamer.archiveDirs...)
 	if err == nil {
-		streamer.cursor = cursor
+		streamer.useCursor(cursor)
 	}
 
 	return err
 }
 
+func (streamer *WalStream) useCursor(cursor *wal.Cursor) {
+	if streamer.source != nil {
+		*cursor = cursor.WithSource(streamer.source)
+	}
+
+	if streamer.cursor != nil {
+		streamer.cursor.Close()
+	}
+	streamer.cursor = cursor
+}
+
+func (streamer *WalStream) startAtRangeStart() error {
+	cursor, err := wal.NewCursorAtOrAfter(streamer.dataDir, streamer.rangeFrom, streamer.archiveDirs...)
+	if err == nil {
+		streamer.useCursor(cursor)
+	}
+
+	return err
+}
+
+func (streamer *WalStream) startAtResumePoint() error {
+	if streamer.bounded {
+		return streamer.startAtRangeStart()
+	}
+
+	if streamer.resumeAfter == message.EmptyKey {
+		return streamer.startAtCheckpoint()
+	}
+
+	offset, err := keyOffset(streamer.resumeAfter)
+	if err != nil {
+		return fmt.Errorf("cannot resume after %v: %v", streamer.resumeAfter, err)
+	}
+
+	cursor, err := wal.NewCursorAtRedoBefore(streamer.dataDir, offset, streamer.archiveDirs...)
+	if err != nil {
+		return err
+	}
+
+	if cursor.Location().Offset() > offset {
+		log.Printf("resuming at %v which is after %v, transactions committed in between are missed", cursor.Location(), streamer.resumeAfter)
+	}
+
+	streamer.useCursor(cursor)
+	return nil
+}
+
 func (streamer *WalStream) publishUntilErrorOrStopped() (stopped bool) {
 	stopped = false
 
@@ -92,13 +262,20 @@ func (streamer *WalStream) publishUntilErrorOrStopped() (stopped bool) {
 			ents, currentCursor, err = currentCursor.ReadEntries()
 
 			if err == nil && len(ents) > 0 {
-				for _, ent := range ents {
-					if ent.ReadFrom.Offset() > streamer.lastOffsetPublished {
-						streamer.publish <- &ent
-						*streamer.cursor = currentCursor
+				// the entries of a record are all read from it, so they are published together or not at all
+				readFrom := ents[0].ReadFrom.Offset()
+				if streamer.bounded && readFrom > streamer.rangeTo {
+					return true
+				}
 
-						streamer.lastOffsetPublished = ent.ReadFrom.Offset()
+				if readFrom > streamer.lastOffsetPublished {
+					for i := range ents {
+						ent := ents[i]
+						streamer.publish <- &ent
 					}
+					*streamer.cursor = currentCursor
+
+					streamer.lastOffsetPublished = readFrom
 				}
 			} else {
 				keepReading = false
@@ -110,17 +287,140 @@ func (streamer *WalStream) publishUntilErrorOrStopped() (stopped bool) {
 		}
 	}
 
-	if err != nil {
-		//the file can not exist for 2 reasons
-		//1 - can happen a lot, if keryx is staying ahead of the wal log
-		//2 - hopefully not often, if keryx is falling too far behind and the wal is being removed
-		//we are gambling on number 1 being the cause of this error and therefore are not logging it as it is very
-		//noisy if we do
-		if !os.IsNotExist(err) {
-			log.Printf("error while reading wal: %v", err)
-		}
+	if streamer.bounded && err == nil && previousCursor.String() == currentCursor.String() {
+		// a range ends with the wal that can be read
+		return true
+	}
+
+	var corrupt *wal.CorruptRecordError
+	if errors.As(err, &corrupt) {
+		return streamer.handleCorruptRecord(currentCursor, corrupt)
+	}
+
+	if streamer.bounded && err != nil {
+		log.Printf("range ended early at %v: %v", previousCursor, err)
+		return true
+	}
+
+	var notWritten *wal.PageNotWrittenError
+	var recycled *wal.RecycledSegmentError
+	switch {
+	case errors.As(err, &notWritten), errors.Is(err, wal.ErrIncompleteRecord):
+		//keryx is ahead of postgres, the page is read again once the wal changes
+		return
+
+	case errors.As(err, &recycled):
+		log.Printf("lost position in the wal: %v", err)
+		streamer.startAtCheckpoint()
+		return
+	}
+
+	if errors.Is(err, wal.ErrSegmentMissing) {
+		streamer.handleMissingSegment(previousCursor, err)
+	} else if err != nil {
+		log.Printf("error while reading wal: %v", err)
 		streamer.startAtCheckpoint()
 	}
 
 	return
 }
+
+//a segment can not exist for 2 reasons
+//1 - can happen a lot, if keryx is staying ahead of the wal log, the segment is read once postgres creates it
+//2 - hopefully not often, if keryx is falling too far behind and the wal is being removed, which loses data
+func (streamer *WalStream) handleMissingSegment(at wal.Cursor, err error) {
+	wanted, ok := at.MissingSegment(err)
+	if !ok {
+		wanted = at.Location().StartOfFile()
+	}
+
+	oldest, newest, ok, boundsErr := at.SegmentBounds()
+	if boundsErr != nil || !ok {
+		streamer.startAtCheckpoint()
+		return
+	}
+
+	switch {
+	case wanted.Offset() == newest.StartOfNextFile().Offset():
+		return
+
+	case wanted.Offset() > newest.Offset():
+		log.Printf("segment %v is past the newest segment %v", wanted.Filename(), newest.Filename())
+		streamer.startAtCheckpoint()
+		return
+	}
+
+	// postgres keeps the segments from the one holding the redo point of its latest checkpoint, so a segment that is
+	// not before it is still needed and cannot have been removed
+	redo, err := streamer.redoPoint()
+	if err != nil {
+		log.Printf("error reading the redo point after missing segment %v: %v", wanted.Filename(), err)
+		return
+	}
+
+	if wanted.StartOfNextFile().Offset() > redo {
+		// it is looked for again every time the wal changes, which is only worth logging the first time
+		if streamer.stillNeeded != wanted.SegmentName() {
+			log.Printf("segment %v is missing but still needed from the redo point at %v", wanted.Filename(), wanted.At(redo))
+			streamer.stillNeeded = wanted.SegmentName()
+		}
+		return
+	}
+
+	from := at.Location()
+	if err := streamer.startAtCheckpoint(); err != nil {
+		log.Printf("error restarting after missing segment %v: %v", wanted.Filename(), err)
+		return
+	}
+
+	to := streamer.cursor.Location()
+
+	reason := fmt.Sprintf("segment %v was removed before it was read", wanted.Filename())
+	if wanted.Offset() < oldest.Offset() {
+		reason = fmt.Sprintf("segment %v was removed before it was read, the oldest segment left is %v", wanted.Filename(), oldest.Filename())
+	}
+
+	streamer.gap(message.Gap{FromKey: locationKey(from), ToKey: locationKey(to), Reason: reason})
+}
+
+func (streamer *WalStream) gap(gap message.Gap) {
+	log.Printf("lost %v", gap)
+	streamer.gaps.add(gap)
+}
+
+func (streamer *WalStream) redoPoint() (uint64, error) {
+	control, err := control.NewControlFromDataDir(streamer.dataDir)
+	if err != nil {
+		return 0, err
+	}
+
+	return uint64(control.CheckPointCopy.RedoLogID)<<32 + uint64(control.CheckPointCopy.RedoRecordOffset), nil
+}
+
+func locationKey(location wal.Location) message.Key {
+	return message.NewKey(location.TimelineID(), location.LogID(), location.RecordOffset())
+}
+
+func (streamer *WalStream) handleCorruptRecord(at wal.Cursor, corrupt *wal.CorruptRecordError) (stopped bool) {
+	switch streamer.onCorruptRecord {
+	case SkipCorruptRecord:
+		log.Printf("skipping %v", corrupt)
+		*streamer.cursor = at.SkipCorruptRecord(corrupt)
+
+	case RescanAfterCorruptRecord:
+		next, err := at.RescanFromNextPage()
+		if err != nil {
+			log.Printf("error rescanning after %v: %v", corrupt, err)
+			return true
+		}
+
+		log.Printf("rescanning from %v after %v", next, corrupt)
+		*streamer.cursor = next
+
+	default:
+		log.Printf("stopping at %v", corrupt)
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,222 @@
+package streams
+
+// Copyright 2015 MediaMath <http://www.mediamath.com>.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/MediaMath/keryxlib/message"
+	"github.com/MediaMath/keryxlib/pg/control"
+	"github.com/MediaMath/keryxlib/pg/wal"
+	"github.com/MediaMath/keryxlib/pg/wal/waltest"
+)
+
+func TestParseCorruptRecordPolicy(t *testing.T) {
+	expectations := map[string]CorruptRecordPolicy{
+		"":       StopOnCorruptRecord,
+		"stop":   StopOnCorruptRecord,
+		"skip":   SkipCorruptRecord,
+		"rescan": RescanAfterCorruptRecord,
+	}
+
+	for name, expected := range expectations {
+		policy, err := ParseCorruptRecordPolicy(name)
+		if err != nil {
+			t.Errorf("%q: %v", name, err)
+		}
+		if policy != expected {
+			t.Errorf("%q: expected %v but got %v", name, expected, policy)
+		}
+	}
+
+	if _, err := ParseCorruptRecordPolicy("ignore"); err == nil {
+		t.Error("expected unknown policy to be an error")
+	}
+}
+
+func TestNewWalRangeStreamChecksKeys(t *testing.T) {
+	from := message.NewKey(1, 0, 0x13000028)
+	to := message.NewKey(1, 0, 0x13002000)
+
+	s, err := NewWalRangeStream("/nonexistent", from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.rangeFrom != 0x13000028 || s.rangeTo != 0x13002000 || s.lastOffsetPublished != 0x13000027 {
+		t.Errorf("unexpected range %X to %X after %X", s.rangeFrom, s.rangeTo, s.lastOffsetPublished)
+	}
+
+	if _, err := NewWalRangeStream("/nonexistent", to, from); err == nil {
+		t.Error("expected range ending before it starts to be an error")
+	}
+
+	if _, err := NewWalRangeStream("/nonexistent", "bad", to); err == nil {
+		t.Error("expected invalid key to be an error")
+	}
+}
+
+func TestGapsAreKeptUntilRead(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gaps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	w, err := waltest.NewWriter(wal.Magic94, wal.NewLocationWithDefaults(0x13000000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Insert(100, waltest.RelFileNode{TablespaceID: 1663, DatabaseID: 16384, RelationID: 16385}, waltest.ItemPointer{Block: 0, Offset: 1}, waltest.NewTuple(1, []byte("a")))
+
+	if err := w.WriteDataDir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewWalStream(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.PollEvery(10 * time.Millisecond)
+
+	entries, err := s.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// nothing reads the gaps while they are lost, which must not hold up the stream or drop any of them
+	lost := make(chan bool)
+	go func() {
+		for i := uint32(0); i < 100; i++ {
+			s.gap(message.Gap{FromKey: message.NewKey(1, 0, i), ToKey: message.NewKey(1, 0, i+1), Reason: "test"})
+		}
+		close(lost)
+	}()
+
+	select {
+	case <-lost:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out losing gaps nothing reads")
+	}
+
+	for i := uint32(0); i < 100; i++ {
+		if gap := <-s.Gaps(); gap.FromKey != message.NewKey(1, 0, i) {
+			t.Errorf("expected gap %v to be from %v but got %v", i, message.NewKey(1, 0, i), gap)
+		}
+	}
+
+	// a gap nobody reads does not keep the channel open once the stream stops
+	s.gap(message.Gap{FromKey: message.NewKey(1, 0, 100), ToKey: message.NewKey(1, 0, 101), Reason: "test"})
+	s.Stop()
+	for range entries {
+	}
+
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(time.Millisecond) {
+		s.gaps.lock.Lock()
+		pending := len(s.gaps.pending)
+		s.gaps.lock.Unlock()
+
+		if pending == 0 {
+			break
+		} else if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the unread gap to be dropped after the stream stopped")
+		}
+	}
+
+	if gap, ok := <-s.Gaps(); ok {
+		t.Errorf("expected the gaps to be closed after the stream stopped but got %v", gap)
+	}
+}
+
+func TestMissingSegmentComparedWithRedoPoint(t *testing.T) {
+	for _, removed := range []bool{false, true} {
+		dir, err := ioutil.TempDir("", "missing")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		// segments of 64k hold a few dozen of these inserts
+		w, err := waltest.NewWriter(wal.Magic94, wal.NewLocationWithDefaults(0x13000000).WithGeometry(64*1024, 0, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var records []wal.Location
+		for i := uint16(1); i <= 100; i++ {
+			records = append(records, w.Insert(100, waltest.RelFileNode{TablespaceID: 1663, DatabaseID: 16384, RelationID: 16385}, waltest.ItemPointer{Block: 0, Offset: i}, waltest.NewTuple(1, bytes.Repeat([]byte("a"), 2000))))
+		}
+
+		if err := w.WriteDataDir(dir); err != nil {
+			t.Fatal(err)
+		}
+
+		// the checkpoint is in the third segment, its redo point in the second unless it was removed
+		from, missing, checkpoint := records[1], records[1].StartOfNextFile(), records[len(records)-1]
+		if checkpoint.Offset() < missing.StartOfNextFile().Offset() {
+			t.Fatalf("expected the inserts to span three segments but the last is at %v", checkpoint)
+		}
+
+		redo := checkpoint
+		for _, record := range records {
+			if !removed && record.Offset() >= missing.Offset() {
+				redo = record
+				break
+			}
+		}
+
+		c, err := control.NewControlFromDataDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.CheckPointLogID, c.CheckPointRecordOffset = checkpoint.LogID(), checkpoint.RecordOffset()
+		c.CheckPointCopy.RedoLogID, c.CheckPointCopy.RedoRecordOffset = redo.LogID(), redo.RecordOffset()
+
+		bs, err := c.Bytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, "global", "pg_control"), bs, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Remove(filepath.Join(dir, "pg_xlog", missing.Filename())); err != nil {
+			t.Fatal(err)
+		}
+
+		s, err := NewWalStream(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		at, err := wal.NewCursorAtOrAfter(dir, from.Offset())
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.useCursor(at)
+
+		s.handleMissingSegment(*at, &wal.SegmentMissingError{Segment: missing.SegmentName(), Err: os.ErrNotExist})
+		s.gaps.close()
+		go s.gaps.deliver(s.done)
+
+		var gaps []message.Gap
+		for gap := range s.Gaps() {
+			gaps = append(gaps, gap)
+		}
+
+		switch {
+		case removed && (len(gaps) != 1 || s.cursor.Location().Offset() != checkpoint.Offset()):
+			t.Errorf("expected a gap and a restart at the checkpoint %v but got %v at %v", checkpoint, gaps, s.cursor.Location())
+
+		case !removed && (len(gaps) != 0 || s.cursor.Location().Offset() != from.Offset()):
+			t.Errorf("expected segment %v to be waited for from the redo point %v but got %v at %v", missing.Filename(), redo, gaps, s.cursor.Location())
+		}
+
+		s.cursor.Close()
+	}
+}
@@ -0,0 +1,72 @@
+package streams
+
+// Copyright 2015 MediaMath <http://www.mediamath.com>.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+import (
+	"log"
+	"time"
+)
+
+//DefaultPollInterval is how often a WalStream reads the WAL again when it cannot be told the WAL changed.
+const DefaultPollInterval = 50 * time.Millisecond
+
+//watchedPollInterval is how often a watched WAL is read again without being told it changed, to cover changes a
+//watcher misses like those on network filesystems.
+const watchedPollInterval = time.Second
+
+//walWatcher waits for the WAL to change
+type walWatcher interface {
+	//wait returns true once the WAL may have changed, or false once done is closed
+	wait(done <-chan interface{}) bool
+	close()
+}
+
+//pollWatcher assumes the WAL changed every interval
+type pollWatcher struct {
+	ticker *time.Ticker
+}
+
+func newPollWatcher(interval time.Duration) *pollWatcher {
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+
+	return &pollWatcher{time.NewTicker(interval)}
+}
+
+func (p *pollWatcher) wait(done <-chan interface{}) bool {
+	select {
+	case <-p.ticker.C:
+		return true
+	case <-done:
+		return false
+	}
+}
+
+func (p *pollWatcher) close() {
+	p.ticker.Stop()
+}
+
+//newWalWatcher watches the directories segments are written to, falling back to polling every interval when they
+//cannot be watched
+func newWalWatcher(dirs []string, interval time.Duration) walWatcher {
+	if len(dirs) == 0 {
+		return newPollWatcher(interval)
+	}
+
+	// the directories are only read on a timer in case a write is missed, which need not be often
+	safetyNet := interval
+	if safetyNet < watchedPollInterval {
+		safetyNet = watchedPollInterval
+	}
+
+	watcher, err := newNotifyWatcher(dirs, safetyNet)
+	if err != nil {
+		log.Printf("polling the wal as it cannot be watched: %v", err)
+		return newPollWatcher(interval)
+	}
+
+	return watcher
+}
@@ -0,0 +1,75 @@
+//go:build linux
+// +build linux
+
+package streams
+
+// Copyright 2015 MediaMath <http://www.mediamath.com>.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+)
+
+const notifyMask = syscall.IN_MODIFY | syscall.IN_CREATE | syscall.IN_MOVED_TO | syscall.IN_CLOSE_WRITE
+
+//notifyWatcher is told by inotify when a segment is written, created or moved into a watched directory
+type notifyWatcher struct {
+	events  *os.File
+	changed chan struct{}
+	poll    *pollWatcher
+}
+
+func newNotifyWatcher(dirs []string, interval time.Duration) (walWatcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_NONBLOCK | syscall.IN_CLOEXEC)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start inotify: %v", err)
+	}
+
+	for _, dir := range dirs {
+		if _, err := syscall.InotifyAddWatch(fd, dir, notifyMask); err != nil {
+			syscall.Close(fd)
+			return nil, fmt.Errorf("failed to watch %v: %v", dir, err)
+		}
+	}
+
+	n := &notifyWatcher{os.NewFile(uintptr(fd), "inotify"), make(chan struct{}, 1), newPollWatcher(interval)}
+	go n.readEvents()
+
+	return n, nil
+}
+
+//readEvents marks the WAL changed for every batch of events until the watcher is closed, the events themselves do not
+//matter as the cursor knows what to read next
+func (n *notifyWatcher) readEvents() {
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		if _, err := n.events.Read(buf); err != nil {
+			return
+		}
+
+		select {
+		case n.changed <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (n *notifyWatcher) wait(done <-chan interface{}) bool {
+	select {
+	case <-n.changed:
+		return true
+	case <-n.poll.ticker.C:
+		return true
+	case <-done:
+		return false
+	}
+}
+
+func (n *notifyWatcher) close() {
+	n.events.Close()
+	n.poll.close()
+}
@@ -0,0 +1,17 @@
+//go:build !linux
+// +build !linux
+
+package streams
+
+// Copyright 2015 MediaMath <http://www.mediamath.com>.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+import (
+	"fmt"
+	"time"
+)
+
+func newNotifyWatcher(dirs []string, interval time.Duration) (walWatcher, error) {
+	return nil, fmt.Errorf("watching directories is only supported on linux")
+}
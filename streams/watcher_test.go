@@ -0,0 +1,84 @@
+package streams
+
+// Copyright 2015 MediaMath <http://www.mediamath.com>.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestPollWatcherStopsWhenDone(t *testing.T) {
+	watcher := newPollWatcher(time.Millisecond)
+	defer watcher.close()
+
+	if !watcher.wait(make(chan interface{})) {
+		t.Error("expected poll to wake")
+	}
+
+	done := make(chan interface{})
+	close(done)
+	watcher.ticker.Stop()
+	if watcher.wait(done) {
+		t.Error("expected wait to end when done")
+	}
+}
+
+func TestWatcherWakesOnSegmentWrite(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("directories are only watched on linux")
+	}
+
+	dir, err := ioutil.TempDir("", "watcher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	watcher := newWalWatcher([]string{dir}, time.Hour)
+	defer watcher.close()
+
+	if _, ok := watcher.(*notifyWatcher); !ok {
+		t.Fatalf("expected directory to be watched but got %T", watcher)
+	}
+
+	woke := make(chan bool)
+	go func() { woke <- watcher.wait(make(chan interface{})) }()
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "000000010000000000000001"), []byte{1}, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case ok := <-woke:
+		if !ok {
+			t.Error("expected write to wake the watcher")
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("expected write to wake the watcher before polling would")
+	}
+}
+
+func TestUnwatchedWalPollsAtInterval(t *testing.T) {
+	watcher := newWalWatcher([]string{filepath.Join(os.TempDir(), "keryx-no-such-wal-dir")}, 10*time.Millisecond)
+	defer watcher.close()
+
+	if _, ok := watcher.(*pollWatcher); !ok {
+		t.Fatalf("expected a missing directory to be polled but got %T", watcher)
+	}
+
+	// polling keeps the interval asked for rather than that of a watched wal
+	woke := make(chan bool)
+	go func() { woke <- watcher.wait(make(chan interface{})) }()
+
+	select {
+	case <-woke:
+	case <-time.After(watchedPollInterval / 2):
+		t.Error("expected the poll to wake at its interval")
+	}
+}
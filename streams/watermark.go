@@ -0,0 +1,71 @@
+package streams
+
+// Copyright 2015 MediaMath <http://www.mediamath.com>.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+import (
+	"sync"
+
+	"github.com/MediaMath/keryxlib/message"
+)
+
+//Watermark tracks delivered transactions and records the commit key of the latest one that was acknowledged along
+//with every transaction delivered before it, so the recorded position never passes an unacknowledged transaction.
+type Watermark struct {
+	store    PositionStore
+	lock     sync.Mutex
+	pending  []*pendingCommit
+	position message.Key
+}
+
+type pendingCommit struct {
+	key   message.Key
+	acked bool
+}
+
+//NewWatermark creates a Watermark that records its position in store, a nil store only tracks the position.
+func NewWatermark(store PositionStore) *Watermark {
+	return &Watermark{store: store, position: message.EmptyKey}
+}
+
+//Delivered adds a transaction to the ones waiting for an acknowledgement, transactions must be delivered in commit order.
+func (w *Watermark) Delivered(key message.Key) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.pending = append(w.pending, &pendingCommit{key: key})
+}
+
+//Ack acknowledges the transaction committed at key and advances the position past every contiguous acknowledged
+//transaction.  Acknowledging a transaction again or one that was not delivered does nothing.
+func (w *Watermark) Ack(key message.Key) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	for _, commit := range w.pending {
+		if commit.key == key {
+			commit.acked = true
+			break
+		}
+	}
+
+	advanced := false
+	for len(w.pending) > 0 && w.pending[0].acked {
+		w.position = w.pending[0].key
+		w.pending = w.pending[1:]
+		advanced = true
+	}
+
+	if advanced {
+		savePosition(w.store, w.position)
+	}
+}
+
+//Position is the commit key of the latest transaction that was acknowledged along with every transaction before it.
+func (w *Watermark) Position() message.Key {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	return w.position
+}
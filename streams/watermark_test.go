@@ -0,0 +1,66 @@
+package streams
+
+// Copyright 2015 MediaMath <http://www.mediamath.com>.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+import (
+	"testing"
+
+	"github.com/MediaMath/keryxlib/message"
+)
+
+type memoryPositionStore struct {
+	saved []message.Key
+}
+
+func (s *memoryPositionStore) Load() (message.Key, error) {
+	if len(s.saved) == 0 {
+		return message.EmptyKey, nil
+	}
+
+	return s.saved[len(s.saved)-1], nil
+}
+
+func (s *memoryPositionStore) Save(key message.Key) error {
+	s.saved = append(s.saved, key)
+	return nil
+}
+
+func TestWatermarkAdvancesToLowestContiguousAck(t *testing.T) {
+	store := &memoryPositionStore{}
+	watermark := NewWatermark(store)
+
+	first, second, third := message.NewKey(1, 0, 0x100), message.NewKey(1, 0, 0x200), message.NewKey(1, 0, 0x300)
+	watermark.Delivered(first)
+	watermark.Delivered(second)
+	watermark.Delivered(third)
+
+	watermark.Ack(second)
+	FailIfTrue(t, watermark.Position() != message.EmptyKey, "Position passed an unacknowledged transaction")
+	FailIfTrue(t, len(store.saved) != 0, "Position saved before first transaction was acknowledged")
+
+	watermark.Ack(first)
+	FailIfTrue(t, watermark.Position() != second, "Position did not advance past contiguous acknowledgements")
+	FailIfTrue(t, len(store.saved) != 1 || store.saved[0] != second, "Position not saved once")
+
+	watermark.Ack(first)
+	watermark.Ack(message.NewKey(1, 0, 0x400))
+	FailIfTrue(t, len(store.saved) != 1, "Repeated or unknown acknowledgements saved a position")
+
+	watermark.Ack(third)
+	FailIfTrue(t, watermark.Position() != third, "Position did not advance to the last acknowledgement")
+}
+
+func TestTransactionAckUsesWatermark(t *testing.T) {
+	watermark := NewWatermark(nil)
+	key := message.NewKey(1, 0, 0x100)
+	watermark.Delivered(key)
+
+	txn := &message.Transaction{CommitKey: key}
+	txn.OnAck(func() { watermark.Ack(key) })
+	txn.Ack()
+
+	FailIfTrue(t, watermark.Position() != key, "Ack did not reach the watermark")
+	(&message.Transaction{}).Ack()
+}
@@ -0,0 +1,259 @@
+package walstats
+
+// Copyright 2015 MediaMath <http://www.mediamath.com>.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/MediaMath/keryxlib/pg/wal"
+)
+
+//resourceManagerNames are the names postgres gives its resource managers, in the order of their ids
+var resourceManagerNames = []string{
+	"XLOG", "Transaction", "Storage", "CLOG", "Database", "Tablespace", "MultiXact", "RelMap", "Standby", "Heap2", "Heap",
+	"Btree", "Hash", "Gin", "Gist", "Sequence", "SPGist", "BRIN", "CommitTs", "ReplicationOrigin", "Generic", "LogicalMessage",
+}
+
+//ResourceManagerName is the name postgres gives the resource manager with an id
+func ResourceManagerName(id uint8) string {
+	if int(id) < len(resourceManagerNames) {
+		return resourceManagerNames[id]
+	}
+
+	return fmt.Sprintf("resource manager %d", id)
+}
+
+//Volume is how many records there are and how many bytes of WAL they take up
+type Volume struct {
+	Records uint64 `json:"records"`
+	Bytes   uint64 `json:"bytes"`
+}
+
+func (v Volume) add(bytes uint32) Volume {
+	return Volume{v.Records + 1, v.Bytes + uint64(bytes)}
+}
+
+//RelFileNode identifies the file of a relation
+type RelFileNode struct {
+	TablespaceID uint32
+	DatabaseID   uint32
+	RelationID   uint32
+}
+
+func (r RelFileNode) String() string {
+	return fmt.Sprintf("%v/%v/%v", r.TablespaceID, r.DatabaseID, r.RelationID)
+}
+
+//Stats is the volume of the records read, in total and by resource manager, record type, database and relfilenode.
+//The bytes of a record are its total length.  From 9.5 on every record is counted by the databases and relfilenodes of
+//the blocks it references, before 9.5 only the heap records keryx decodes the heap data of are.
+type Stats struct {
+	First            wal.Location
+	Last             wal.Location
+	Total            Volume
+	ResourceManagers map[uint8]Volume
+	RecordTypes      map[wal.RecordType]Volume
+	Databases        map[uint32]Volume
+	Relations        map[RelFileNode]Volume
+}
+
+//NewStats creates stats without any records
+func NewStats() *Stats {
+	return &Stats{
+		ResourceManagers: make(map[uint8]Volume),
+		RecordTypes:      make(map[wal.RecordType]Volume),
+		Databases:        make(map[uint32]Volume),
+		Relations:        make(map[RelFileNode]Volume),
+	}
+}
+
+//Add counts a record read at a location
+func (s *Stats) Add(location wal.Location, record *wal.Record) {
+	if s.Total.Records == 0 {
+		s.First = location
+	}
+	s.Last = location
+
+	header := record.Header
+	bytes := header.TotalLength()
+
+	s.Total = s.Total.add(bytes)
+	s.ResourceManagers[header.ResourceManagerID()] = s.ResourceManagers[header.ResourceManagerID()].add(bytes)
+	s.RecordTypes[header.Type()] = s.RecordTypes[header.Type()].add(bytes)
+
+	relations, err := relationsOf(record)
+	if err != nil {
+		return
+	}
+
+	databases := make(map[uint32]bool)
+	for relation := range relations {
+		s.Relations[relation] = s.Relations[relation].add(bytes)
+
+		if !databases[relation.DatabaseID] {
+			databases[relation.DatabaseID] = true
+			s.Databases[relation.DatabaseID] = s.Databases[relation.DatabaseID].add(bytes)
+		}
+	}
+}
+
+//relationsOf are the relfilenodes a record changes, named by its block references from 9.5 on and by its heap data
+//before.  A record touching several blocks of a relation, like a multi insert, names it once.
+func relationsOf(record *wal.Record) (map[RelFileNode]bool, error) {
+	relations := make(map[RelFileNode]bool)
+
+	if wal.HasBlockReferences(record.Page.Magic()) {
+		blocks, err := record.Body.BlockReferences()
+		for _, block := range blocks {
+			relations[RelFileNode{block.TablespaceID, block.DatabaseID, block.RelationID}] = true
+		}
+
+		return relations, err
+	}
+
+	heapData, err := record.Body.HeapData()
+	for _, data := range heapData {
+		relations[RelFileNode{data.TablespaceID(), data.DatabaseID(), data.RelationID()}] = true
+	}
+
+	return relations, err
+}
+
+//Collect counts the records read from the cursor until the end of the WAL, or until the first record at or after end
+//when end is not zero
+func (s *Stats) Collect(cursor *wal.Cursor, end uint64) error {
+	next, err := cursor.ReadRecords(end, func(location wal.Location, record *wal.Record) error {
+		s.Add(location, record)
+		return nil
+	})
+
+	*cursor = next
+	return err
+}
+
+//NameResolver provides the names of databases and relations, a *pg.SchemaReader is one
+type NameResolver interface {
+	GetDatabaseName(databaseID uint32) string
+	GetNamespaceAndTable(databaseID uint32, relationID uint32) (string, string)
+}
+
+//Row is the volume of the records of one group
+type Row struct {
+	Name string `json:"name"`
+	Volume
+}
+
+//Report is the stats with a name for every group, each grouping sorted from the group with the most bytes
+type Report struct {
+	First            string `json:"first"`
+	Last             string `json:"last"`
+	Total            Volume `json:"total"`
+	ResourceManagers []Row  `json:"resource_managers"`
+	RecordTypes      []Row  `json:"record_types"`
+	Databases        []Row  `json:"databases"`
+	Relations        []Row  `json:"relations"`
+}
+
+//Report names the groups of the stats.  Databases and relations are named by names when it is not nil and knows them,
+//and by their ids otherwise.
+func (s *Stats) Report(names NameResolver) Report {
+	report := Report{First: s.First.String(), Last: s.Last.String(), Total: s.Total}
+
+	for id, volume := range s.ResourceManagers {
+		report.ResourceManagers = append(report.ResourceManagers, Row{ResourceManagerName(id), volume})
+	}
+
+	for recordType, volume := range s.RecordTypes {
+		report.RecordTypes = append(report.RecordTypes, Row{recordType.String(), volume})
+	}
+
+	for id, volume := range s.Databases {
+		report.Databases = append(report.Databases, Row{databaseName(names, id), volume})
+	}
+
+	for relation, volume := range s.Relations {
+		report.Relations = append(report.Relations, Row{relationName(names, relation), volume})
+	}
+
+	for _, rows := range [][]Row{report.ResourceManagers, report.RecordTypes, report.Databases, report.Relations} {
+		sortRows(rows)
+	}
+
+	return report
+}
+
+func databaseName(names NameResolver, id uint32) string {
+	if names != nil {
+		if name := names.GetDatabaseName(id); name != "" {
+			return name
+		}
+	}
+
+	return fmt.Sprintf("%v", id)
+}
+
+func relationName(names NameResolver, relation RelFileNode) string {
+	if names != nil {
+		database := names.GetDatabaseName(relation.DatabaseID)
+		namespace, table := names.GetNamespaceAndTable(relation.DatabaseID, relation.RelationID)
+		if database != "" && namespace != "" && table != "" {
+			return fmt.Sprintf("%v.%v.%v", database, namespace, table)
+		}
+	}
+
+	return relation.String()
+}
+
+func sortRows(rows []Row) {
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Bytes != rows[j].Bytes {
+			return rows[i].Bytes > rows[j].Bytes
+		}
+
+		return rows[i].Name < rows[j].Name
+	})
+}
+
+//WriteTable writes the report as a table for each grouping
+func (r Report) WriteTable(out io.Writer) error {
+	if _, err := fmt.Fprintf(out, "%v records and %v bytes from %v to %v\n", r.Total.Records, r.Total.Bytes, r.First, r.Last); err != nil {
+		return err
+	}
+
+	groupings := []struct {
+		title string
+		rows  []Row
+	}{
+		{"resource manager", r.ResourceManagers},
+		{"record type", r.RecordTypes},
+		{"database", r.Databases},
+		{"relation", r.Relations},
+	}
+
+	for _, grouping := range groupings {
+		w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+		fmt.Fprintf(w, "\n%v\trecords\tbytes\t%% of bytes\n", grouping.title)
+		for _, row := range grouping.rows {
+			fmt.Fprintf(w, "%v\t%v\t%v\t%.1f%%\n", row.Name, row.Records, row.Bytes, r.share(row.Bytes))
+		}
+
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r Report) share(bytes uint64) float64 {
+	if r.Total.Bytes == 0 {
+		return 0
+	}
+
+	return 100 * float64(bytes) / float64(r.Total.Bytes)
+}
@@ -0,0 +1,231 @@
+package walstats
+
+// Copyright 2015 MediaMath <http://www.mediamath.com>.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MediaMath/keryxlib/pg/wal"
+	"github.com/MediaMath/keryxlib/pg/wal/waltest"
+)
+
+var (
+	users  = waltest.RelFileNode{TablespaceID: 1663, DatabaseID: 16384, RelationID: 16385}
+	orders = waltest.RelFileNode{TablespaceID: 1663, DatabaseID: 16384, RelationID: 16390}
+	events = waltest.RelFileNode{TablespaceID: 1663, DatabaseID: 16500, RelationID: 16501}
+	now    = time.Date(2015, time.June, 1, 12, 0, 0, 0, time.UTC)
+)
+
+type testNames struct{}
+
+func (testNames) GetDatabaseName(databaseID uint32) string {
+	if databaseID == 16384 {
+		return "shop"
+	}
+
+	return ""
+}
+
+func (testNames) GetNamespaceAndTable(databaseID uint32, relationID uint32) (string, string) {
+	if databaseID == 16384 && relationID == 16385 {
+		return "public", "users"
+	}
+
+	return "", ""
+}
+
+func collect(t *testing.T, version uint16) (*Stats, []wal.Location) {
+	start := wal.NewLocationWithDefaults(0x13000000)
+	w, err := waltest.NewWriter(version, start)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tuple := waltest.NewTuple(1, bytes.Repeat([]byte("x"), 100))
+	locations := []wal.Location{
+		w.Insert(1, users, waltest.ItemPointer{Block: 0, Offset: 1}, tuple),
+		w.Insert(1, users, waltest.ItemPointer{Block: 0, Offset: 2}, tuple),
+		w.Update(1, users, waltest.ItemPointer{Block: 0, Offset: 1}, waltest.ItemPointer{Block: 0, Offset: 3}, tuple),
+		w.MultiInsert(1, orders, 0, 1, 2, 3),
+		w.Delete(2, events, waltest.ItemPointer{Block: 0, Offset: 1}),
+		w.Commit(1, now),
+		w.Abort(2, now),
+	}
+
+	cursor, err := wal.NewCursorAt(w.Source(), start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cursor.Close()
+
+	stats := NewStats()
+	if err := stats.Collect(cursor, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	return stats, locations
+}
+
+func TestCollect(t *testing.T) {
+	for _, version := range []uint16{wal.Magic91, wal.Magic94} {
+		stats, locations := collect(t, version)
+
+		if stats.Total.Records != 7 || stats.First != locations[0] || stats.Last != locations[6] {
+			t.Fatalf("%.4X: expected 7 records from %v to %v but got %v from %v to %v", version, locations[0], locations[6], stats.Total.Records, stats.First, stats.Last)
+		}
+
+		var heapBytes uint64
+		for _, rm := range []uint8{waltest.RmXact, waltest.RmHeap, waltest.RmHeap2} {
+			heapBytes += stats.ResourceManagers[rm].Bytes
+		}
+		if heapBytes != stats.Total.Bytes {
+			t.Errorf("%.4X: expected the bytes of every resource manager to add up to %v but got %v", version, stats.Total.Bytes, heapBytes)
+		}
+
+		if stats.ResourceManagers[waltest.RmHeap].Records != 4 || stats.ResourceManagers[waltest.RmHeap2].Records != 1 || stats.ResourceManagers[waltest.RmXact].Records != 2 {
+			t.Errorf("%.4X: expected 4 heap, 1 heap2 and 2 transaction records but got %v", version, stats.ResourceManagers)
+		}
+
+		if stats.RecordTypes[wal.Insert].Records != 2 || stats.RecordTypes[wal.MultiInsert].Records != 1 || stats.RecordTypes[wal.Commit].Records != 1 {
+			t.Errorf("%.4X: expected 2 inserts, a multi insert and a commit but got %v", version, stats.RecordTypes)
+		}
+
+		// the multi insert inserts three tuples but is one record
+		if v := stats.Relations[RelFileNode(orders)]; v.Records != 1 {
+			t.Errorf("%.4X: expected the multi insert to count once but got %v", version, v)
+		}
+
+		if v := stats.Relations[RelFileNode(users)]; v.Records != 3 || v.Bytes <= 300 {
+			t.Errorf("%.4X: expected 3 records of more than 300 bytes for users but got %v", version, v)
+		}
+
+		if stats.Databases[16384].Records != 4 || stats.Databases[16500].Records != 1 || len(stats.Databases) != 2 {
+			t.Errorf("%.4X: expected 4 records in 16384 and 1 in 16500 but got %v", version, stats.Databases)
+		}
+	}
+}
+
+func TestCollectCountsBlockReferences(t *testing.T) {
+	start := wal.NewLocationWithDefaults(0x13000000)
+	w, err := waltest.NewWriter(wal.Magic95, start)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	index := waltest.RelFileNode{TablespaceID: 1663, DatabaseID: 16384, RelationID: 16386}
+	w.ReferencingRecord(waltest.RmHeap, waltest.HeapInsert, 1, make([]byte, 3), waltest.BlockReference{Relation: users, Block: 0})
+	// a btree insert, whose data keryx does not decode
+	w.ReferencingRecord(11, 0x00, 1, make([]byte, 2), waltest.BlockReference{Relation: index, Block: 1})
+	// an update moving a tuple to another block references the relation twice but counts once
+	w.ReferencingRecord(waltest.RmHeap, waltest.HeapUpdate, 1, make([]byte, 14),
+		waltest.BlockReference{Relation: users, Block: 1}, waltest.BlockReference{Relation: users, Block: 0})
+	w.Commit(1, now)
+
+	cursor, err := wal.NewCursorAt(w.Source(), start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cursor.Close()
+
+	stats := NewStats()
+	if err := stats.Collect(cursor, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.Total.Records != 4 {
+		t.Fatalf("expected 4 records but got %v", stats.Total.Records)
+	}
+
+	if v := stats.Relations[RelFileNode(users)]; v.Records != 2 {
+		t.Errorf("expected 2 records for users but got %v", v)
+	}
+
+	if v := stats.Relations[RelFileNode(index)]; v.Records != 1 {
+		t.Errorf("expected the btree insert to count for the index but got %v", v)
+	}
+
+	if stats.Databases[16384].Records != 3 || len(stats.Databases) != 1 {
+		t.Errorf("expected 3 records in 16384 but got %v", stats.Databases)
+	}
+}
+
+func TestCollectStopsAtEnd(t *testing.T) {
+	start := wal.NewLocationWithDefaults(0x13000000)
+	w, err := waltest.NewWriter(wal.Magic94, start)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w.Insert(1, users, waltest.ItemPointer{Block: 0, Offset: 1}, nil)
+	end := w.Commit(1, now)
+	w.Insert(2, users, waltest.ItemPointer{Block: 0, Offset: 2}, nil)
+
+	cursor, err := wal.NewCursorAt(w.Source(), start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cursor.Close()
+
+	stats := NewStats()
+	if err := stats.Collect(cursor, end.Offset()); err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.Total.Records != 1 || cursor.Location() != end {
+		t.Errorf("expected one record before %v but got %v stopping at %v", end, stats.Total.Records, cursor.Location())
+	}
+}
+
+func TestReport(t *testing.T) {
+	stats, _ := collect(t, wal.Magic94)
+
+	report := stats.Report(testNames{})
+	if len(report.ResourceManagers) != 3 || report.ResourceManagers[0].Name != "Heap" {
+		t.Errorf("expected heap to write the most but got %v", report.ResourceManagers)
+	}
+
+	names := make(map[string]bool)
+	for _, row := range append(report.Databases, report.Relations...) {
+		names[row.Name] = true
+	}
+
+	for _, name := range []string{"shop", "16500", "shop.public.users", "1663/16384/16390", "1663/16500/16501"} {
+		if !names[name] {
+			t.Errorf("expected a row for %v but got %v", name, names)
+		}
+	}
+
+	if unnamed := stats.Report(nil); unnamed.Relations[0].Name != "1663/16384/16385" {
+		t.Errorf("expected relations to be named by relfilenode without names but got %v", unnamed.Relations)
+	}
+
+	js, err := json.Marshal(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(js), `{"name":"shop.public.users","records":3,"bytes":`) {
+		t.Errorf("expected rows with their volume in the json but got %s", js)
+	}
+
+	var table bytes.Buffer
+	if err := report.WriteTable(&table); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(table.String(), "7 records and ") || !strings.Contains(table.String(), "shop.public.users") || !strings.Contains(table.String(), "Transaction") {
+		t.Errorf("expected a table of every grouping but got\n%v", table.String())
+	}
+}
+
+func TestResourceManagerName(t *testing.T) {
+	if ResourceManagerName(10) != "Heap" || ResourceManagerName(1) != "Transaction" || ResourceManagerName(200) != "resource manager 200" {
+		t.Errorf("unexpected resource manager names %v %v %v", ResourceManagerName(10), ResourceManagerName(1), ResourceManagerName(200))
+	}
+}